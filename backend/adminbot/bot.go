@@ -2,6 +2,7 @@ package adminbot
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/Rastaiha/bermudia/api/handler"
 	"github.com/Rastaiha/bermudia/internal/config"
@@ -11,6 +12,7 @@ import (
 	"github.com/go-telegram/bot"
 	"github.com/go-telegram/bot/models"
 	"log/slog"
+	"maps"
 	"os"
 	"path/filepath"
 	"regexp"
@@ -30,13 +32,14 @@ type Bot struct {
 	correction    *service.Correction
 	player        *service.Player
 	admin         *service.Admin
+	files         *service.File
 	userStore     domain.UserStore
 	gameState     domain.GameStateStore
 	cancel        context.CancelFunc
 	wg            sync.WaitGroup
 }
 
-func NewBot(cfg config.Config, b *bot.Bot, apiGateway *handler.Handler, islandService *service.Island, correction *service.Correction, player *service.Player, adminService *service.Admin, userStore domain.UserStore, gameState domain.GameStateStore) *Bot {
+func NewBot(cfg config.Config, b *bot.Bot, apiGateway *handler.Handler, islandService *service.Island, correction *service.Correction, player *service.Player, adminService *service.Admin, files *service.File, userStore domain.UserStore, gameState domain.GameStateStore) *Bot {
 	m := &Bot{
 		cfg:           cfg,
 		bot:           b,
@@ -45,6 +48,7 @@ func NewBot(cfg config.Config, b *bot.Bot, apiGateway *handler.Handler, islandSe
 		correction:    correction,
 		player:        player,
 		admin:         adminService,
+		files:         files,
 		userStore:     userStore,
 		gameState:     gameState,
 	}
@@ -59,6 +63,8 @@ const (
 	wrongCB       = "wrong|"
 	revertCB      = "revert|"
 	finalizeCB    = "finalize|"
+	templateCB    = "tpl|"
+	resolveCB     = "resolve|"
 	iGoCB         = "iGo|"
 	didHelpCB     = "didHelp|"
 	didNotHelpCB  = "didNotHelp|"
@@ -78,9 +84,6 @@ func prefix(cb string) bot.Middleware {
 }
 
 func (m *Bot) Start() {
-	m.islandService.OnNewAnswer(m.HandleNewAnswer)
-	m.islandService.OnHelpRequest(m.HandleHelpRequest)
-
 	m.bot.RegisterHandlerMatchFunc(func(update *models.Update) bool {
 		return update.Message != nil && update.Message.Document != nil && update.Message.Chat.ID == m.cfg.AdminsGroup
 	}, m.handleGameContent)
@@ -90,6 +93,13 @@ func (m *Bot) Start() {
 	m.bot.RegisterHandler(bot.HandlerTypeMessageText, "resume_game", bot.MatchTypeCommand, m.resume)
 	m.bot.RegisterHandler(bot.HandlerTypeMessageText, "connections", bot.MatchTypeCommand, m.connection)
 	m.bot.RegisterHandler(bot.HandlerTypeMessageText, "resolve_investment_session", bot.MatchTypeCommand, m.resolveInvestmentSession)
+	m.bot.RegisterHandler(bot.HandlerTypeMessageText, "unclaim", bot.MatchTypeCommand, m.unclaim)
+	m.bot.RegisterHandler(bot.HandlerTypeMessageText, "corrector_stats", bot.MatchTypeCommand, m.correctorStats)
+	m.bot.RegisterHandler(bot.HandlerTypeMessageText, "save_template", bot.MatchTypeCommand, m.saveTemplate)
+	m.bot.RegisterHandler(bot.HandlerTypeMessageText, "set_role", bot.MatchTypeCommand, m.setRole)
+	m.bot.RegisterHandler(bot.HandlerTypeMessageText, "export_content", bot.MatchTypeCommand, m.exportContent)
+	m.bot.RegisterHandler(bot.HandlerTypeMessageText, "content_versions", bot.MatchTypeCommand, m.contentVersions)
+	m.bot.RegisterHandler(bot.HandlerTypeMessageText, "rollback_content", bot.MatchTypeCommand, m.rollbackContent)
 
 	m.bot.RegisterHandler(bot.HandlerTypeCallbackQueryData, tagCB, bot.MatchTypePrefix, m.handleTag, prefix(tagCB))
 	m.bot.RegisterHandler(bot.HandlerTypeCallbackQueryData, correctCB, bot.MatchTypePrefix, m.handleCorrect, prefix(correctCB))
@@ -97,6 +107,8 @@ func (m *Bot) Start() {
 	m.bot.RegisterHandler(bot.HandlerTypeCallbackQueryData, wrongCB, bot.MatchTypePrefix, m.handleWrong, prefix(wrongCB))
 	m.bot.RegisterHandler(bot.HandlerTypeCallbackQueryData, revertCB, bot.MatchTypePrefix, m.handleRevert, prefix(revertCB))
 	m.bot.RegisterHandler(bot.HandlerTypeCallbackQueryData, finalizeCB, bot.MatchTypePrefix, m.handleFinalize, prefix(finalizeCB))
+	m.bot.RegisterHandler(bot.HandlerTypeCallbackQueryData, templateCB, bot.MatchTypePrefix, m.handleTemplate, prefix(templateCB))
+	m.bot.RegisterHandler(bot.HandlerTypeCallbackQueryData, resolveCB, bot.MatchTypePrefix, m.handleResolve, prefix(resolveCB))
 	m.bot.RegisterHandler(bot.HandlerTypeMessageText, "", bot.MatchTypePrefix, m.handleFeedback)
 	m.bot.RegisterHandler(bot.HandlerTypeCallbackQueryData, iGoCB, bot.MatchTypePrefix, m.handleIGo, prefix(iGoCB))
 	m.bot.RegisterHandler(bot.HandlerTypeCallbackQueryData, didHelpCB, bot.MatchTypePrefix, m.handleDidHelp, prefix(didHelpCB))
@@ -120,9 +132,6 @@ func (m *Bot) HandleNewAnswer(username string, territory string, question domain
 	go func() {
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		defer cancel()
-		if m.cfg.DevMode && m.correction.AutoCorrect(ctx, answer) {
-			return
-		}
 		keyboard := models.InlineKeyboardMarkup{
 			InlineKeyboard: [][]models.InlineKeyboardButton{{
 				{
@@ -135,12 +144,18 @@ func (m *Bot) HandleNewAnswer(username string, territory string, question domain
 		territory, group := m.getGroup(territory)
 		caption := m.getMetaData(territory, username, question)
 		if answer.FileID.Valid {
-			_, err = m.bot.SendDocument(ctx, &bot.SendDocumentParams{
-				ChatID:      group,
-				Document:    &models.InputFileString{Data: answer.FileID.String},
-				Caption:     caption,
-				ReplyMarkup: keyboard,
-			})
+			var document models.InputFile
+			var release func()
+			document, release, err = m.answerDocument(ctx, answer.FileID.String)
+			if err == nil {
+				_, err = m.bot.SendDocument(ctx, &bot.SendDocumentParams{
+					ChatID:      group,
+					Document:    document,
+					Caption:     caption,
+					ReplyMarkup: keyboard,
+				})
+				release()
+			}
 		} else if utf8.RuneCount([]byte(answer.TextContent.String)) > 1024 {
 			_, err = m.bot.SendDocument(ctx, &bot.SendDocumentParams{
 				ChatID: group,
@@ -164,6 +179,25 @@ func (m *Bot) HandleNewAnswer(username string, territory string, question domain
 	}()
 }
 
+// answerDocument returns the answer file to send and a function that releases it once it is sent.
+// The file is streamed from the file store while it is uploaded. Answers submitted before files were kept
+// in our own file store refer to the file by its bot file id.
+func (m *Bot) answerDocument(ctx context.Context, fileId string) (models.InputFile, func(), error) {
+	if !domain.IdHasType(fileId, domain.ResourceTypeAnswerFile) {
+		return &models.InputFileString{Data: fileId}, func() {}, nil
+	}
+	file, content, err := m.files.Open(ctx, fileId)
+	if err != nil {
+		return nil, nil, err
+	}
+	release := func() {
+		if err := content.Close(); err != nil {
+			slog.Error("failed to close answer file", "error", err)
+		}
+	}
+	return &models.InputFileUpload{Filename: file.Filename, Data: content}, release, nil
+}
+
 func (m *Bot) HandleHelpRequest(territory string, user *domain.User, question domain.BookQuestion) error {
 	territory, group := m.getGroup(territory)
 	msg := m.getMetaData(territory, user.Username, question)
@@ -185,6 +219,80 @@ func (m *Bot) HandleHelpRequest(territory string, user *domain.User, question do
 	return err
 }
 
+func (m *Bot) HandlePendingBacklog(backlog map[string]int) {
+	var sb strings.Builder
+	sb.WriteString("⚠️ #صف_تصحیح\nتعداد پاسخ های بررسی نشده:\n\n")
+	m.writeBacklog(&sb, backlog)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err := m.bot.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: m.cfg.AdminsGroup,
+		Text:   sb.String(),
+	})
+	if err != nil {
+		slog.Error("failed to send pending backlog escalation", "error", err)
+	}
+}
+
+func (m *Bot) writeBacklog(sb *strings.Builder, backlog map[string]int) {
+	territories := make([]string, 0, len(backlog))
+	for territory := range backlog {
+		territories = append(territories, territory)
+	}
+	slices.Sort(territories)
+	for _, territory := range territories {
+		name, _ := m.getGroup(territory)
+		mark := ""
+		if backlog[territory] > m.cfg.PendingBacklogLimit {
+			mark = " 🔴"
+		}
+		sb.WriteString(fmt.Sprintf("#%s: %d%s\n", name, backlog[territory], mark))
+	}
+	if len(territories) == 0 {
+		sb.WriteString("-\n")
+	}
+}
+
+func (m *Bot) correctorStatsText(ctx context.Context, stats []domain.CorrectorStats, since time.Time) string {
+	var sb strings.Builder
+	if since.IsZero() {
+		sb.WriteString("📊 #آمار_مصححین\n\n")
+	} else {
+		sb.WriteString(fmt.Sprintf("📊 #آمار_مصححین از %s\n\n", since.Format(time.DateOnly)))
+	}
+	for _, s := range stats {
+		sb.WriteString(fmt.Sprintf("%s: %d تصحیح | میانه زمان: %s |", s.Corrector.Name, s.Count, s.MedianDuration.Round(time.Minute)))
+		for _, status := range domain.CorrectionAllowedNewStatuses {
+			sb.WriteString(fmt.Sprintf(" %s %d", statusToEmoji(status), s.StatusCounts[status]))
+		}
+		sb.WriteString("\n")
+	}
+	if len(stats) == 0 {
+		sb.WriteString("تصحیحی ثبت نشده است.\n")
+	}
+	sb.WriteString("\nصف تصحیح:\n")
+	backlog, err := m.islandService.GetPendingBacklog(ctx)
+	if err != nil {
+		sb.WriteString("error occurred: " + err.Error())
+	} else {
+		m.writeBacklog(&sb, backlog)
+	}
+	return sb.String()
+}
+
+func (m *Bot) HandleStatsDigest(stats []domain.CorrectorStats, since time.Time) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	_, err := m.bot.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: m.cfg.AdminsGroup,
+		Text:   m.correctorStatsText(ctx, stats, since),
+	})
+	if err != nil {
+		slog.Error("failed to send corrector stats digest", "error", err)
+	}
+}
+
 func (m *Bot) getGroup(territory string) (string, int64) {
 	if territory == "" {
 		territory = "challenge"
@@ -204,7 +312,30 @@ func (m *Bot) getMetaData(territory string, username string, question domain.Boo
 	return fmt.Sprintf("#%s\nUser: #%s\nQuestion: #%s%s\n\nمتن سؤال:\n%s", territory, username, question.QuestionID, ctx, question.Text)
 }
 
+func correctorOf(user models.User) domain.Corrector {
+	name := user.FirstName
+	if user.Username != "" {
+		name = "@" + user.Username
+	}
+	return domain.Corrector{ID: user.ID, Name: name}
+}
+
 func (m *Bot) handleTag(ctx context.Context, b *bot.Bot, update *models.Update) {
+	var userId int32
+	var questionId string
+	_, err := fmt.Sscanf(update.CallbackQuery.Data, "%d %s", &userId, &questionId)
+	if err != nil {
+		err = fmt.Errorf("failed to parse callback query data: %w", err)
+		_, _ = b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{CallbackQueryID: update.CallbackQuery.ID, Text: err.Error(), ShowAlert: true})
+		slog.Error("failed to handle update", "error", err)
+		return
+	}
+	corrector := correctorOf(update.CallbackQuery.From)
+	_, err = m.correction.Claim(ctx, corrector, userId, questionId, update.CallbackQuery.Message.Message.Chat.ID, update.CallbackQuery.Message.Message.ID)
+	if err != nil {
+		_, _ = b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{CallbackQueryID: update.CallbackQuery.ID, Text: err.Error(), ShowAlert: true})
+		return
+	}
 	keyboard := models.InlineKeyboardMarkup{
 		InlineKeyboard: [][]models.InlineKeyboardButton{
 			{{
@@ -221,12 +352,7 @@ func (m *Bot) handleTag(ctx context.Context, b *bot.Bot, update *models.Update)
 			}},
 		},
 	}
-	username := update.CallbackQuery.From.FirstName
-	if update.CallbackQuery.From.Username != "" {
-		username = "@" + update.CallbackQuery.From.Username
-	}
-	suffix := fmt.Sprintf("\n\n✏️ %s داره تصحیح میکنه", username)
-	var err error
+	suffix := fmt.Sprintf("\n\n✏️ %s داره تصحیح میکنه", corrector.Name)
 	if update.CallbackQuery.Message.Message.Document != nil {
 		_, err = b.EditMessageCaption(ctx, &bot.EditMessageCaptionParams{
 			ChatID:      update.CallbackQuery.Message.Message.Chat.ID,
@@ -259,7 +385,7 @@ func (m *Bot) handleCorrection(ctx context.Context, b *bot.Bot, update *models.U
 		slog.Error("failed to handle update", "error", err)
 		return
 	}
-	correctionId, err := m.correction.CreateCorrection(ctx, userId, questionId, newStatus)
+	correctionId, err := m.correction.CreateCorrection(ctx, correctorOf(update.CallbackQuery.From), userId, questionId, newStatus)
 	if err != nil {
 		_, _ = b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{CallbackQueryID: update.CallbackQuery.ID, Text: err.Error(), ShowAlert: true})
 		slog.Error("failed to handle update", "error", err)
@@ -308,8 +434,32 @@ func statusToEmoji(status domain.AnswerStatus) string {
 	}
 }
 
-func revertKeyboard(correctionId string, currentNewStatus domain.AnswerStatus, gottenFeedback bool) models.InlineKeyboardMarkup {
+const maxTemplateButtons = 5
+
+func templateButtonText(text string) string {
+	text = strings.Join(strings.Fields(text), " ")
+	runes := []rune(text)
+	if len(runes) > 30 {
+		return "💬 " + string(runes[:30]) + "…"
+	}
+	return "💬 " + text
+}
+
+func revertKeyboard(correctionId string, currentNewStatus domain.AnswerStatus, gottenFeedback bool, templates []domain.FeedbackTemplate) models.InlineKeyboardMarkup {
 	keyboard := models.InlineKeyboardMarkup{}
+	if !gottenFeedback {
+		for i, t := range templates {
+			if i >= maxTemplateButtons {
+				break
+			}
+			keyboard.InlineKeyboard = append(keyboard.InlineKeyboard, []models.InlineKeyboardButton{
+				{
+					Text:         templateButtonText(t.Text),
+					CallbackData: templateCB + fmt.Sprintf("%s %s", t.ID, correctionId),
+				},
+			})
+		}
+	}
 	for _, a := range domain.CorrectionAllowedNewStatuses {
 		if currentNewStatus != a {
 			keyboard.InlineKeyboard = append(keyboard.InlineKeyboard, []models.InlineKeyboardButton{
@@ -334,13 +484,18 @@ func revertKeyboard(correctionId string, currentNewStatus domain.AnswerStatus, g
 }
 
 func (m *Bot) showRevert(ctx context.Context, b *bot.Bot, update *models.Update, correctionId string, currentNewStatus domain.AnswerStatus, fromRevert bool) {
-	keyboard := revertKeyboard(
-		correctionId,
-		currentNewStatus,
-		strings.Contains(update.CallbackQuery.Message.Message.Caption, feedbackSavedText) || strings.Contains(update.CallbackQuery.Message.Message.Text, feedbackSavedText),
-	)
+	gottenFeedback := strings.Contains(update.CallbackQuery.Message.Message.Caption, feedbackSavedText) || strings.Contains(update.CallbackQuery.Message.Message.Text, feedbackSavedText)
+	var templates []domain.FeedbackTemplate
+	if !gottenFeedback {
+		var err error
+		templates, err = m.correction.GetFeedbackTemplates(ctx, correctionId)
+		if err != nil {
+			slog.Error("failed to get feedback templates", "error", err)
+		}
+	}
+	keyboard := revertKeyboard(correctionId, currentNewStatus, gottenFeedback, templates)
 
-	suffix := fmt.Sprintf("```[ID]%s```\n", correctionId) + "✍️ با ریپلای به این پیام، برای دانش آموز یک متن بازخورد ثبت کنید.\n\n" +
+	suffix := fmt.Sprintf("```[ID]%s```\n", correctionId) + "✍️ با ریپلای به این پیام، برای دانش آموز یک متن بازخورد ثبت کنید یا یکی از بازخوردهای آماده را انتخاب کنید.\n\n" +
 		fmt.Sprintf("%s نتیجه تصحیح: *%s*", statusToEmoji(currentNewStatus), statusToString(currentNewStatus))
 	if fromRevert {
 		suffix = fmt.Sprintf("↩️%s نتیجه تصحیح به *%s* تغییر کرد", statusToEmoji(currentNewStatus), statusToString(currentNewStatus))
@@ -381,7 +536,7 @@ func (m *Bot) handleRevert(ctx context.Context, b *bot.Bot, update *models.Updat
 
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
-	err = m.correction.UpdateCorrectionNewStatus(ctx, correctionId, newStatus)
+	err = m.correction.UpdateCorrectionNewStatus(ctx, correctorOf(update.CallbackQuery.From), correctionId, newStatus)
 	if err != nil {
 		err = fmt.Errorf("failed to update correction: %w", err)
 		_, _ = b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{CallbackQueryID: update.CallbackQuery.ID, Text: err.Error(), ShowAlert: true})
@@ -395,28 +550,105 @@ func (m *Bot) handleRevert(ctx context.Context, b *bot.Bot, update *models.Updat
 
 func (m *Bot) handleFinalize(ctx context.Context, b *bot.Bot, update *models.Update) {
 	correctionId := update.CallbackQuery.Data
-	err := m.correction.FinalizeCorrection(ctx, correctionId)
+	status, err := m.correction.FinalizeCorrection(ctx, correctorOf(update.CallbackQuery.From), correctionId)
 	if err != nil {
-		err = fmt.Errorf("failed to parse callback query data: %w", err)
+		err = fmt.Errorf("failed to finalize correction: %w", err)
 		_, _ = b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{CallbackQueryID: update.CallbackQuery.ID, Text: err.Error(), ShowAlert: true})
 		slog.Error("failed to handle update", "error", err)
 		return
 	}
+	caption := update.CallbackQuery.Message.Message.Caption
+	text := update.CallbackQuery.Message.Message.Text
 	suffix := "☑️ نتیجه نهایی تصحیح ثبت شد."
+	switch status {
+	case domain.CorrectionStatusBlind:
+		// hide the first grade from the second corrector
+		caption = hideGrade(caption)
+		text = hideGrade(text)
+		suffix = "☑️ تصحیح اول ثبت شد. پاسخ برای تصحیح مستقل دوم دوباره ارسال شد."
+	case domain.CorrectionStatusDisputed:
+		suffix = "⚖️ نتیجه این تصحیح با تصحیح اول متفاوت بود و برای داوری به گروه ادمین ها ارسال شد."
+	}
 	suffix = "\n\n" + suffix
 	if update.CallbackQuery.Message.Message.Document != nil {
 		_, err = b.EditMessageCaption(ctx, &bot.EditMessageCaptionParams{
 			ChatID:    update.CallbackQuery.Message.Message.Chat.ID,
 			MessageID: update.CallbackQuery.Message.Message.ID,
-			Caption:   update.CallbackQuery.Message.Message.Caption + suffix,
+			Caption:   caption + suffix,
 		})
 	} else {
 		_, err = b.EditMessageText(ctx, &bot.EditMessageTextParams{
 			ChatID:    update.CallbackQuery.Message.Message.Chat.ID,
 			MessageID: update.CallbackQuery.Message.Message.ID,
-			Text:      update.CallbackQuery.Message.Message.Text + suffix,
+			Text:      text + suffix,
 		})
 	}
+	_, _ = b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{CallbackQueryID: update.CallbackQuery.ID})
+}
+
+// hideGrade removes the correction details that showRevert and handleFeedback append to an answer message.
+func hideGrade(text string) string {
+	if i := strings.Index(text, "\n\n```[ID]"); i >= 0 {
+		return text[:i]
+	}
+	return text
+}
+
+func (m *Bot) HandleCorrectionDispute(dispute domain.CorrectionDispute) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		username := strconv.Itoa(int(dispute.UserID))
+		if user, err := m.userStore.Get(ctx, dispute.UserID); err == nil {
+			username = user.Username
+		}
+		var sb strings.Builder
+		sb.WriteString("⚖️ اختلاف در تصحیح دوگانه\n\n")
+		sb.WriteString(fmt.Sprintf("User: #%s\nQuestion: #%s\n\nمتن سؤال:\n%s\n", username, dispute.Question.QuestionID, dispute.Question.Text))
+		keyboard := models.InlineKeyboardMarkup{}
+		for i, c := range dispute.Corrections {
+			sb.WriteString(fmt.Sprintf("\n%d. %s %s: *%s*", i+1, statusToEmoji(c.NewStatus), c.Corrector.Name, statusToString(c.NewStatus)))
+			if c.Feedback != "" {
+				sb.WriteString("\nبازخورد: " + c.Feedback)
+			}
+			keyboard.InlineKeyboard = append(keyboard.InlineKeyboard, []models.InlineKeyboardButton{
+				{
+					Text:         fmt.Sprintf("%s تأیید نتیجه '%s' (%s)", statusToEmoji(c.NewStatus), statusToString(c.NewStatus), c.Corrector.Name),
+					CallbackData: resolveCB + c.ID,
+				},
+			})
+		}
+		_, err := m.bot.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID:      m.cfg.AdminsGroup,
+			Text:        sb.String(),
+			ReplyMarkup: keyboard,
+		})
+		if err != nil {
+			slog.Error("failed to send correction dispute", "error", err)
+		}
+	}()
+}
+
+func (m *Bot) handleResolve(ctx context.Context, b *bot.Bot, update *models.Update) {
+	if update.CallbackQuery.Message.Message == nil || update.CallbackQuery.Message.Message.Chat.ID != m.cfg.AdminsGroup {
+		return
+	}
+	correction, err := m.correction.ResolveDispute(ctx, update.CallbackQuery.Data)
+	if err != nil {
+		_, _ = b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{CallbackQueryID: update.CallbackQuery.ID, Text: err.Error(), ShowAlert: true})
+		slog.Error("failed to handle update", "error", err)
+		return
+	}
+	_, err = b.EditMessageText(ctx, &bot.EditMessageTextParams{
+		ChatID:    update.CallbackQuery.Message.Message.Chat.ID,
+		MessageID: update.CallbackQuery.Message.Message.ID,
+		Text: update.CallbackQuery.Message.Message.Text + fmt.Sprintf("\n\n☑️ نتیجه %s %s توسط %s تأیید شد.",
+			statusToEmoji(correction.NewStatus), statusToString(correction.NewStatus), correctorOf(update.CallbackQuery.From).Name),
+	})
+	if err != nil {
+		slog.Error("failed to edit message on dispute resolution", "error", err)
+	}
+	_, _ = b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{CallbackQueryID: update.CallbackQuery.ID})
 }
 
 var correctionIdPattern = regexp.MustCompile("```\\[ID](\\w+)```")
@@ -443,9 +675,19 @@ func (m *Bot) handleFeedback(ctx context.Context, b *bot.Bot, update *models.Upd
 		return
 	}
 
-	currentNewStatus, err := m.correction.UpdateCorrectionFeedback(ctx, id, update.Message.Text)
+	if update.Message.From == nil {
+		return
+	}
+	currentNewStatus, err := m.correction.UpdateCorrectionFeedback(ctx, correctorOf(*update.Message.From), id, update.Message.Text)
 	if err != nil {
 		slog.Error("failed to update correction feedback", "error", err)
+		if errors.Is(err, domain.ErrAnswerClaimed) {
+			_, _ = b.SendMessage(ctx, &bot.SendMessageParams{
+				ChatID:          update.Message.Chat.ID,
+				Text:            err.Error(),
+				ReplyParameters: &models.ReplyParameters{MessageID: update.Message.ID},
+			})
+		}
 		return
 	}
 	suffix := "\n\n" + feedbackSavedText
@@ -454,24 +696,179 @@ func (m *Bot) handleFeedback(ctx context.Context, b *bot.Bot, update *models.Upd
 			ChatID:      update.Message.ReplyToMessage.Chat.ID,
 			MessageID:   update.Message.ReplyToMessage.ID,
 			Caption:     update.Message.ReplyToMessage.Caption + suffix,
-			ReplyMarkup: revertKeyboard(id, currentNewStatus, true),
+			ReplyMarkup: revertKeyboard(id, currentNewStatus, true, nil),
 		})
 	} else {
 		_, err = b.EditMessageText(ctx, &bot.EditMessageTextParams{
 			ChatID:      update.Message.ReplyToMessage.Chat.ID,
 			MessageID:   update.Message.ReplyToMessage.ID,
 			Text:        update.Message.ReplyToMessage.Text + suffix,
-			ReplyMarkup: revertKeyboard(id, currentNewStatus, true),
+			ReplyMarkup: revertKeyboard(id, currentNewStatus, true, nil),
 		})
 	}
 }
 
-func (m *Bot) handleIGo(ctx context.Context, b *bot.Bot, update *models.Update) {
-	username := update.CallbackQuery.From.FirstName
-	if update.CallbackQuery.From.Username != "" {
-		username = "@" + update.CallbackQuery.From.Username
+func (m *Bot) handleTemplate(ctx context.Context, b *bot.Bot, update *models.Update) {
+	var templateId, correctionId string
+	_, err := fmt.Sscanf(update.CallbackQuery.Data, "%s %s", &templateId, &correctionId)
+	if err != nil {
+		err = fmt.Errorf("failed to parse callback query data: %w", err)
+		_, _ = b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{CallbackQueryID: update.CallbackQuery.ID, Text: err.Error(), ShowAlert: true})
+		slog.Error("failed to handle update", "error", err)
+		return
+	}
+	currentNewStatus, err := m.correction.ApplyFeedbackTemplate(ctx, correctorOf(update.CallbackQuery.From), correctionId, templateId)
+	if err != nil {
+		_, _ = b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{CallbackQueryID: update.CallbackQuery.ID, Text: err.Error(), ShowAlert: true})
+		slog.Error("failed to handle update", "error", err)
+		return
 	}
-	suffix := fmt.Sprintf("🤙 %s جواب میده", username)
+	suffix := "\n\n" + feedbackSavedText
+	if update.CallbackQuery.Message.Message.Document != nil {
+		_, err = b.EditMessageCaption(ctx, &bot.EditMessageCaptionParams{
+			ChatID:      update.CallbackQuery.Message.Message.Chat.ID,
+			MessageID:   update.CallbackQuery.Message.Message.ID,
+			Caption:     update.CallbackQuery.Message.Message.Caption + suffix,
+			ReplyMarkup: revertKeyboard(correctionId, currentNewStatus, true, nil),
+		})
+	} else {
+		_, err = b.EditMessageText(ctx, &bot.EditMessageTextParams{
+			ChatID:      update.CallbackQuery.Message.Message.Chat.ID,
+			MessageID:   update.CallbackQuery.Message.Message.ID,
+			Text:        update.CallbackQuery.Message.Message.Text + suffix,
+			ReplyMarkup: revertKeyboard(correctionId, currentNewStatus, true, nil),
+		})
+	}
+	if err != nil {
+		slog.Error("failed to edit message on feedback template", "error", err)
+	}
+	_, _ = b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{CallbackQueryID: update.CallbackQuery.ID})
+}
+
+// saveTemplate saves a feedback template for the question of the replied correction message.
+// The template text comes after the command: "/save_template <text>" saves it for the question
+// and "/save_template territory <text>" saves it for the whole territory.
+func (m *Bot) saveTemplate(ctx context.Context, b *bot.Bot, update *models.Update) {
+	if update.Message.From == nil {
+		return
+	}
+	reply := func(text string) {
+		_, _ = b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID:          update.Message.Chat.ID,
+			Text:            text,
+			ReplyParameters: &models.ReplyParameters{MessageID: update.Message.ID},
+		})
+	}
+	if update.Message.ReplyToMessage == nil {
+		reply("reply to a correction message")
+		return
+	}
+	repliedText := update.Message.ReplyToMessage.Text
+	if repliedText == "" {
+		repliedText = update.Message.ReplyToMessage.Caption
+	}
+	groups := correctionIdPattern.FindStringSubmatch(repliedText)
+	if len(groups) < 2 || !domain.IdHasType(groups[1], domain.ResourceTypeCorrection) {
+		reply("reply to a correction message")
+		return
+	}
+	_, text, _ := strings.Cut(update.Message.Text, " ")
+	text = strings.TrimSpace(text)
+	forTerritory := false
+	if rest, ok := strings.CutPrefix(text, "territory"); ok && (rest == "" || rest[0] == ' ' || rest[0] == '\n') {
+		forTerritory = true
+		text = strings.TrimSpace(rest)
+	}
+	template, err := m.correction.SaveFeedbackTemplate(ctx, correctorOf(*update.Message.From), groups[1], text, forTerritory)
+	if err != nil {
+		slog.Error("failed to save feedback template", "error", err)
+		reply(err.Error())
+		return
+	}
+	if template.TerritoryID != "" {
+		reply(fmt.Sprintf("بازخورد آماده برای قلمرو %s ذخیره شد.", template.TerritoryID))
+	} else {
+		reply("بازخورد آماده برای این سؤال ذخیره شد.")
+	}
+}
+
+var answerMetaDataPattern = regexp.MustCompile(`User: #(\S+)\nQuestion: #(\S+)`)
+
+// unclaim releases the claim on an answer and re-posts it to its correction group.
+// In a correction group, the claimant replies to the answer message with /unclaim.
+// In the admins group, any claim can be released with "/unclaim <username> <questionId>".
+func (m *Bot) unclaim(ctx context.Context, b *bot.Bot, update *models.Update) {
+	if update.Message.From == nil {
+		return
+	}
+	reply := func(text string) {
+		_, _ = b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID:          update.Message.Chat.ID,
+			Text:            text,
+			ReplyParameters: &models.ReplyParameters{MessageID: update.Message.ID},
+		})
+	}
+
+	var username, questionId string
+	force := false
+	if update.Message.Chat.ID == m.cfg.AdminsGroup {
+		parts := strings.Fields(update.Message.Text)
+		if len(parts) != 3 {
+			reply("Usage:\n\n/unclaim username qst_C0B869257687000")
+			return
+		}
+		username, questionId = parts[1], parts[2]
+		force = true
+	} else {
+		if update.Message.ReplyToMessage == nil {
+			reply("برای آزاد کردن یک پاسخ، روی پیام آن ریپلای کنید.")
+			return
+		}
+		text := update.Message.ReplyToMessage.Text
+		if text == "" {
+			text = update.Message.ReplyToMessage.Caption
+		}
+		groups := answerMetaDataPattern.FindStringSubmatch(text)
+		if len(groups) < 3 {
+			return
+		}
+		username, questionId = groups[1], groups[2]
+	}
+
+	user, err := m.userStore.GetByUsername(ctx, username)
+	if err != nil {
+		reply("error occurred: " + err.Error())
+		return
+	}
+	err = m.correction.Unclaim(ctx, correctorOf(*update.Message.From), user.ID, questionId, force)
+	if err != nil {
+		reply("error occurred: " + err.Error())
+		return
+	}
+	reply("🔓 پاسخ آزاد شد و دوباره ارسال شد.")
+}
+
+func (m *Bot) HandleClaimReleased(claim domain.AnswerClaim) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if claim.ChatID != 0 {
+			_, _ = m.bot.EditMessageReplyMarkup(ctx, &bot.EditMessageReplyMarkupParams{
+				ChatID:      claim.ChatID,
+				MessageID:   claim.MessageID,
+				ReplyMarkup: models.InlineKeyboardMarkup{InlineKeyboard: [][]models.InlineKeyboardButton{}},
+			})
+			_, _ = m.bot.SendMessage(ctx, &bot.SendMessageParams{
+				ChatID:          claim.ChatID,
+				Text:            fmt.Sprintf("⌛️ تصحیح این پاسخ توسط %s آزاد شد و پاسخ دوباره ارسال شد.", claim.Corrector.Name),
+				ReplyParameters: &models.ReplyParameters{MessageID: claim.MessageID, AllowSendingWithoutReply: true},
+			})
+		}
+	}()
+}
+
+func (m *Bot) handleIGo(ctx context.Context, b *bot.Bot, update *models.Update) {
+	suffix := fmt.Sprintf("🤙 %s جواب میده", correctorOf(update.CallbackQuery.From).Name)
 	suffix = "\n\n" + suffix
 	_, _ = b.EditMessageText(ctx, &bot.EditMessageTextParams{
 		ChatID:    update.CallbackQuery.Message.Message.Chat.ID,
@@ -553,13 +950,33 @@ func (m *Bot) handleGameContent(ctx context.Context, b *bot.Bot, update *models.
 		return
 	}
 
+	// the caption may hold the options "dry_run" and "force"
+	options := strings.Fields(update.Message.Caption)
+	force := slices.Contains(options, "force")
+	if slices.Contains(options, "dry_run") {
+		diff, err := mock.PreviewGameContent(m.admin, files, "", force)
+		if err != nil {
+			sendError(fmt.Errorf("content is invalid: %w", err))
+			return
+		}
+		_, _ = b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: update.Message.Chat.ID,
+			Text:   formatContentDiff(diff),
+		})
+		return
+	}
+
 	writeBackDir := filepath.Join(os.TempDir(), fmt.Sprintf("data_%d", time.Now().Unix()-1758018000))
 
 	_, _ = b.SendMessage(ctx, &bot.SendMessageParams{
 		ChatID: update.Message.Chat.ID,
 		Text:   "Processing...",
 	})
-	err = mock.SetGameContent(m.admin, files, writeBackDir, "")
+	author := "admin bot"
+	if update.Message.From != nil {
+		author = correctorOf(*update.Message.From).Name
+	}
+	err = mock.SetGameContent(m.admin, files, writeBackDir, "", author, force)
 	if err != nil {
 		sendError(fmt.Errorf("failed to set game content: %w", err))
 		return
@@ -581,6 +998,59 @@ func (m *Bot) handleGameContent(ctx context.Context, b *bot.Bot, update *models.
 	})
 }
 
+const maxMessageLength = 4000
+
+func formatContentDiff(diff service.ContentDiff) string {
+	var sb strings.Builder
+	sb.WriteString("Content is valid. Nothing was applied.\n")
+	for _, t := range diff.Territories {
+		if t.New {
+			fmt.Fprintf(&sb, "\nnew territory %s", t.TerritoryID)
+		} else {
+			fmt.Fprintf(&sb, "\nterritory %s", t.TerritoryID)
+		}
+		if len(t.AddedIslands) > 0 {
+			fmt.Fprintf(&sb, "\n  added islands: %s", strings.Join(t.AddedIslands, ", "))
+		}
+		if len(t.RemovedIslands) > 0 {
+			fmt.Fprintf(&sb, "\n  removed islands: %s", strings.Join(t.RemovedIslands, ", "))
+		}
+	}
+	for _, d := range diff.Books {
+		if d.New {
+			fmt.Fprintf(&sb, "\nnew book for %s with %d questions", d.Target, d.AddedQuestions)
+		} else {
+			fmt.Fprintf(&sb, "\nbook %s of %s", d.BookID, d.Target)
+			if d.AddedQuestions > 0 {
+				fmt.Fprintf(&sb, "\n  added questions: %d", d.AddedQuestions)
+			}
+			if len(d.RemovedQuestions) > 0 {
+				fmt.Fprintf(&sb, "\n  removed questions: %s", strings.Join(d.RemovedQuestions, ", "))
+			}
+			for _, q := range d.ChangedQuestions {
+				fmt.Fprintf(&sb, "\n  changed question %s: %s", q.QuestionID, strings.Join(q.Fields, ", "))
+			}
+		}
+		if d.ReplacedBookID != "" {
+			fmt.Fprintf(&sb, "\n  replaces book %s", d.ReplacedBookID)
+		}
+		if d.Answers > 0 {
+			fmt.Fprintf(&sb, "\n  ⚠️ affects %d submitted answers", d.Answers)
+		}
+	}
+	if len(diff.NewUsers) > 0 {
+		fmt.Fprintf(&sb, "\n\nnew users: %d", len(diff.NewUsers))
+	}
+	if len(diff.UpdatedUsers) > 0 {
+		fmt.Fprintf(&sb, "\nupdated users: %d", len(diff.UpdatedUsers))
+	}
+	text := sb.String()
+	if len(text) > maxMessageLength {
+		text = strings.ToValidUTF8(text[:maxMessageLength], "") + "\n..."
+	}
+	return text
+}
+
 func (m *Bot) broadcastMessage(ctx context.Context, b *bot.Bot, update *models.Update) {
 	if update.Message.Chat.ID != m.cfg.AdminsGroup {
 		return
@@ -654,18 +1124,144 @@ func (m *Bot) connection(ctx context.Context, b *bot.Bot, update *models.Update)
 	}
 	stats := m.apiGateway.Actives()
 	var sb strings.Builder
-	for name, value := range stats {
+	for name, value := range stats.Counts {
 		sb.WriteString(name)
 		sb.WriteString(": ")
 		sb.WriteString(fmt.Sprint(value))
 		sb.WriteString("\n")
 	}
+	// users by their number of sessions, e.g. "2 sessions: 7 users"
+	usersBySessions := make(map[int]int)
+	for _, count := range stats.Sessions {
+		usersBySessions[count]++
+	}
+	for _, count := range slices.Sorted(maps.Keys(usersBySessions)) {
+		sb.WriteString(fmt.Sprintf("%d sessions: %d users\n", count, usersBySessions[count]))
+	}
+	for _, reason := range slices.Sorted(maps.Keys(stats.Disconnects)) {
+		sb.WriteString(fmt.Sprintf("disconnects (%s): %d\n", reason, stats.Disconnects[reason]))
+	}
 	_, _ = b.SendMessage(ctx, &bot.SendMessageParams{
 		ChatID: update.Message.Chat.ID,
 		Text:   sb.String(),
 	})
 }
 
+func (m *Bot) setRole(ctx context.Context, b *bot.Bot, update *models.Update) {
+	if update.Message.Chat.ID != m.cfg.AdminsGroup {
+		return
+	}
+	reply := func(text string) {
+		_, _ = b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID:          update.Message.Chat.ID,
+			Text:            text,
+			ReplyParameters: &models.ReplyParameters{MessageID: update.Message.ID},
+		})
+	}
+	parts := strings.Fields(update.Message.Text)
+	if len(parts) != 3 {
+		reply("Usage:\n\n/set_role username corrector\n\nRoles: player, corrector, mentor, admin")
+		return
+	}
+	user, err := m.admin.SetUserRole(ctx, parts[1], domain.Role(parts[2]))
+	if err != nil {
+		reply("error occurred: " + err.Error())
+		return
+	}
+	reply(fmt.Sprintf("role of %s is now %s", user.Username, user.Role))
+}
+
+func (m *Bot) exportContent(ctx context.Context, b *bot.Bot, update *models.Update) {
+	if update.Message.Chat.ID != m.cfg.AdminsGroup {
+		return
+	}
+	sendError := func(err error) {
+		_, _ = b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: update.Message.Chat.ID,
+			Text:   "error occurred: " + err.Error(),
+		})
+	}
+
+	dir := filepath.Join(os.TempDir(), fmt.Sprintf("export_%d", time.Now().Unix()-1758018000))
+	if err := mock.ExportGameContent(m.admin, dir); err != nil {
+		sendError(err)
+		return
+	}
+	f, filename, err := mock.CreateZipFromDirectory(dir)
+	if err != nil {
+		sendError(fmt.Errorf("failed to create zip file: %w", err))
+		return
+	}
+
+	_, _ = b.SendDocument(ctx, &bot.SendDocumentParams{
+		ChatID: update.Message.Chat.ID,
+		Document: &models.InputFileUpload{
+			Filename: filename,
+			Data:     f,
+		},
+		Caption: "Current content. users.json is empty because passwords can not be exported.",
+	})
+}
+
+func (m *Bot) contentVersions(ctx context.Context, b *bot.Bot, update *models.Update) {
+	if update.Message.Chat.ID != m.cfg.AdminsGroup {
+		return
+	}
+	versions, err := m.admin.ListContentVersions(ctx)
+	text := ""
+	if err != nil {
+		text = "error occurred: " + err.Error()
+	} else if len(versions) == 0 {
+		text = "no content versions"
+	} else {
+		var sb strings.Builder
+		for _, v := range versions {
+			fmt.Fprintf(&sb, "%d. %s by %s\n   %s\n", v.Version, v.CreatedAt.Format(time.DateTime), v.Author, v.Checksum[:12])
+		}
+		text = sb.String()
+		if len(text) > maxMessageLength {
+			text = strings.ToValidUTF8(text[:maxMessageLength], "") + "\n..."
+		}
+	}
+	_, _ = b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: update.Message.Chat.ID,
+		Text:   text,
+	})
+}
+
+func (m *Bot) rollbackContent(ctx context.Context, b *bot.Bot, update *models.Update) {
+	if update.Message.Chat.ID != m.cfg.AdminsGroup {
+		return
+	}
+	reply := func(text string) {
+		_, _ = b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID:          update.Message.Chat.ID,
+			Text:            text,
+			ReplyParameters: &models.ReplyParameters{MessageID: update.Message.ID},
+		})
+	}
+	parts := strings.Fields(update.Message.Text)
+	if len(parts) < 2 || len(parts) > 3 || (len(parts) == 3 && parts[2] != "force") {
+		reply("Usage:\n\n/rollback_content 3\n/rollback_content 3 force")
+		return
+	}
+	version, err := strconv.ParseInt(parts[1], 10, 32)
+	if err != nil {
+		reply("Bad version\n\nUsage:\n\n/rollback_content 3")
+		return
+	}
+	author := "admin bot"
+	if update.Message.From != nil {
+		author = correctorOf(*update.Message.From).Name
+	}
+	result, err := m.admin.RollbackContent(ctx, int32(version), author, len(parts) == 3)
+	if err != nil {
+		reply("error occurred: " + err.Error())
+		return
+	}
+	reply(fmt.Sprintf("content rolled back to version %d; saved as version %d", version, result.Version))
+}
+
 func (m *Bot) resolveInvestmentSession(ctx context.Context, b *bot.Bot, update *models.Update) {
 	if update.Message.Chat.ID != m.cfg.AdminsGroup {
 		return
@@ -703,3 +1299,37 @@ func (m *Bot) resolveInvestmentSession(ctx context.Context, b *bot.Bot, update *
 		Text:   fmt.Sprintf("affected players: %d\ntotal coin readded: %d", players, rewards),
 	})
 }
+
+func (m *Bot) correctorStats(ctx context.Context, b *bot.Bot, update *models.Update) {
+	if update.Message.Chat.ID != m.cfg.AdminsGroup {
+		return
+	}
+
+	since := time.Time{}
+	parts := strings.Fields(update.Message.Text)
+	if len(parts) == 2 {
+		days, err := strconv.Atoi(parts[1])
+		if err != nil || days <= 0 {
+			_, _ = b.SendMessage(ctx, &bot.SendMessageParams{
+				ChatID: update.Message.Chat.ID,
+				Text:   "Bad number of days\n\nUsage:\n\n/corrector_stats 7",
+			})
+			return
+		}
+		since = time.Now().UTC().AddDate(0, 0, -days)
+	}
+
+	stats, err := m.correction.GetCorrectorStats(ctx, since)
+	if err != nil {
+		_, _ = b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: update.Message.Chat.ID,
+			Text:   "error occurred: " + err.Error(),
+		})
+		return
+	}
+
+	_, _ = b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: update.Message.Chat.ID,
+		Text:   m.correctorStatsText(ctx, stats, since),
+	})
+}
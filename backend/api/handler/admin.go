@@ -0,0 +1,323 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Rastaiha/bermudia/internal/domain"
+	"github.com/Rastaiha/bermudia/internal/mock"
+	"github.com/go-chi/chi/v5"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+const (
+	maxGameContentSize = 64 << 20
+)
+
+func (h *Handler) setGamePaused(w http.ResponseWriter, r *http.Request, paused bool) {
+	if err := h.authService.SetGamePaused(r.Context(), paused); err != nil {
+		handleError(w, err)
+		return
+	}
+	sendResult(w, map[string]any{
+		"paused": paused,
+	})
+}
+
+func (h *Handler) PauseGame(w http.ResponseWriter, r *http.Request) {
+	h.setGamePaused(w, r, true)
+}
+
+func (h *Handler) ResumeGame(w http.ResponseWriter, r *http.Request) {
+	h.setGamePaused(w, r, false)
+}
+
+type broadcastRequest struct {
+	Message string `json:"message"`
+}
+
+func (h *Handler) BroadcastMessage(w http.ResponseWriter, r *http.Request) {
+	var req broadcastRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendDecodeError(w)
+		return
+	}
+	if req.Message == "" {
+		sendError(w, http.StatusBadRequest, "message is required")
+		return
+	}
+	// the message is sent to all the players in one transaction, so a failure means it is sent to none
+	count, err := h.playerService.BroadcastMessage(r.Context(), req.Message)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+	sendResult(w, map[string]any{
+		"sent": count,
+	})
+}
+
+type resolveInvestmentRequest struct {
+	Coefficient float64 `json:"coefficient"`
+}
+
+func (h *Handler) ResolveInvestmentSession(w http.ResponseWriter, r *http.Request) {
+	var req resolveInvestmentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendDecodeError(w)
+		return
+	}
+	players, rewards, err := h.playerService.ResolveInvestmentSession(r.Context(), chi.URLParam(r, "sessionID"), req.Coefficient)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+	sendResult(w, map[string]any{
+		"affectedPlayers": players,
+		"totalReward":     rewards,
+	})
+}
+
+func (h *Handler) GetConnections(w http.ResponseWriter, r *http.Request) {
+	sendResult(w, h.Actives())
+}
+
+func (h *Handler) GetCorrectorStats(w http.ResponseWriter, r *http.Request) {
+	since := time.Time{}
+	if s := r.URL.Query().Get("days"); s != "" {
+		days, err := strconv.Atoi(s)
+		if err != nil || days <= 0 {
+			sendError(w, http.StatusBadRequest, "days must be a positive number")
+			return
+		}
+		since = time.Now().UTC().AddDate(0, 0, -days)
+	}
+	stats, err := h.correctionService.GetCorrectorStats(r.Context(), since)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+	backlog, err := h.islandService.GetPendingBacklog(r.Context())
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+	type correctorStats struct {
+		CorrectorID    int64          `json:"correctorId"`
+		CorrectorName  string         `json:"correctorName"`
+		Count          int            `json:"count"`
+		MedianDuration int64          `json:"medianDurationSeconds"`
+		StatusCounts   map[string]int `json:"statusCounts"`
+	}
+	result := make([]correctorStats, 0, len(stats))
+	for _, s := range stats {
+		statusCounts := make(map[string]int)
+		for status, count := range s.StatusCounts {
+			statusCounts[status.String()] = count
+		}
+		result = append(result, correctorStats{
+			CorrectorID:    s.Corrector.ID,
+			CorrectorName:  s.Corrector.Name,
+			Count:          s.Count,
+			MedianDuration: int64(s.MedianDuration.Seconds()),
+			StatusCounts:   statusCounts,
+		})
+	}
+	sendResult(w, map[string]any{
+		"stats":   result,
+		"backlog": backlog,
+	})
+}
+
+// UploadGameContent applies a content zip, the same one the admin bot accepts.
+// With ?writeBack=true the response is the zip with the generated ids filled in,
+// which must be used for later uploads. With ?dryRun=true nothing is applied and
+// the response describes how the content differs from the stored one.
+// Questions that have answers are only deleted or rebound with ?force=true.
+func (h *Handler) UploadGameContent(w http.ResponseWriter, r *http.Request) {
+	user, err := getUser(r.Context())
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "application/zip" && mediaType != "application/x-zip-compressed" {
+		sendError(w, http.StatusUnsupportedMediaType, "request body must be a zip file")
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxGameContentSize)
+	contentDir, err := mock.DirFromZip(r.Body)
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			sendError(w, http.StatusRequestEntityTooLarge, "content zip is too large")
+			return
+		}
+		sendError(w, http.StatusBadRequest, "invalid zip file: "+err.Error())
+		return
+	}
+	defer removeTempDir(contentDir)
+	files := os.DirFS(contentDir)
+
+	force := r.URL.Query().Get("force") == "true"
+	if r.URL.Query().Get("dryRun") == "true" {
+		diff, err := mock.PreviewGameContent(h.adminService, files, "", force)
+		if err != nil {
+			sendContentError(w, "content is invalid: ", err)
+			return
+		}
+		sendResult(w, diff)
+		return
+	}
+
+	writeBackDir := filepath.Join(os.TempDir(), fmt.Sprintf("data_%d", time.Now().UnixNano()))
+	defer removeTempDir(writeBackDir)
+	if err := mock.SetGameContent(h.adminService, files, writeBackDir, "", user.Username, force); err != nil {
+		sendContentError(w, "failed to set game content: ", err)
+		return
+	}
+	if r.URL.Query().Get("writeBack") != "true" {
+		sendResult(w, map[string]any{
+			"applied": true,
+		})
+		return
+	}
+
+	f, filename, err := mock.CreateZipFromDirectory(writeBackDir)
+	if err != nil {
+		handleError(w, fmt.Errorf("failed to create zip file: %w", err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	w.WriteHeader(http.StatusOK)
+	if _, err := io.Copy(w, f); err != nil {
+		slog.Error("Error sending content zip", slog.String("error", err.Error()))
+	}
+}
+
+func sendContentError(w http.ResponseWriter, prefix string, err error) {
+	if errors.Is(err, domain.ErrAnsweredQuestionChange) {
+		sendError(w, http.StatusConflict, prefix+err.Error())
+		return
+	}
+	sendError(w, http.StatusUnprocessableEntity, prefix+err.Error())
+}
+
+func (h *Handler) ListContentVersions(w http.ResponseWriter, r *http.Request) {
+	versions, err := h.adminService.ListContentVersions(r.Context())
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+	if versions == nil {
+		versions = []domain.ContentVersion{}
+	}
+	sendResult(w, versions)
+}
+
+// RollbackContent applies the content of a stored version. Like uploads,
+// it only deletes or rebinds questions that have answers with ?force=true.
+func (h *Handler) RollbackContent(w http.ResponseWriter, r *http.Request) {
+	user, err := getUser(r.Context())
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+	version, err := strconv.ParseInt(chi.URLParam(r, "version"), 10, 32)
+	if err != nil {
+		sendError(w, http.StatusBadRequest, "invalid version")
+		return
+	}
+	result, err := h.adminService.RollbackContent(r.Context(), int32(version), user.Username, r.URL.Query().Get("force") == "true")
+	if err != nil {
+		if errors.Is(err, domain.ErrContentVersionNotFound) {
+			handleError(w, err)
+			return
+		}
+		sendContentError(w, "failed to roll back content: ", err)
+		return
+	}
+	sendResult(w, result)
+}
+
+type setRoleRequest struct {
+	Role string `json:"role"`
+}
+
+func (h *Handler) SetUserRole(w http.ResponseWriter, r *http.Request) {
+	var req setRoleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendDecodeError(w)
+		return
+	}
+	user, err := h.adminService.SetUserRole(r.Context(), chi.URLParam(r, "username"), domain.Role(req.Role))
+	if err != nil {
+		if errors.Is(err, domain.ErrUserNotFound) {
+			sendError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		sendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	sendResult(w, user)
+}
+
+type forceUnclaimRequest struct {
+	Username   string `json:"username"`
+	QuestionID string `json:"questionId"`
+}
+
+func (h *Handler) ForceUnclaimAnswer(w http.ResponseWriter, r *http.Request) {
+	user, err := getUser(r.Context())
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+	var req forceUnclaimRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendDecodeError(w)
+		return
+	}
+	player, err := h.adminService.GetUser(r.Context(), req.Username)
+	if err != nil {
+		if errors.Is(err, domain.ErrUserNotFound) {
+			sendError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		handleError(w, err)
+		return
+	}
+	if err := h.correctionService.Unclaim(r.Context(), user.AsCorrector(), player.ID, req.QuestionID, true); err != nil {
+		handleCorrectionError(w, err)
+		return
+	}
+	sendResult(w, map[string]any{})
+}
+
+func (h *Handler) ResolveCorrectionDispute(w http.ResponseWriter, r *http.Request) {
+	correction, err := h.correctionService.ResolveDispute(r.Context(), chi.URLParam(r, "correctionID"))
+	if err != nil {
+		handleCorrectionError(w, err)
+		return
+	}
+	sendResult(w, map[string]any{
+		"id":         correction.ID,
+		"userId":     correction.UserId,
+		"questionId": correction.QuestionId,
+		"newStatus":  correction.NewStatus.String(),
+		"feedback":   correction.Feedback,
+	})
+}
+
+func removeTempDir(dir string) {
+	if err := os.RemoveAll(dir); err != nil {
+		slog.Error("Error removing temporary directory", slog.String("error", err.Error()))
+	}
+}
@@ -32,6 +32,24 @@ func (h *Handler) authMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// requireRole rejects users that have none of the roles. It must come after authMiddleware.
+func (h *Handler) requireRole(roles ...domain.Role) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, err := getUser(r.Context())
+			if err != nil {
+				handleError(w, err)
+				return
+			}
+			if !user.HasRole(roles...) {
+				sendError(w, http.StatusForbidden, "You do not have access to this endpoint")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
 func (h *Handler) pauseCheckMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		isPaused, err := h.authService.IsGamePaused(r.Context())
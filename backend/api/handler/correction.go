@@ -0,0 +1,32 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+func (h *Handler) correctionQueueAuthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tokenStr := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if h.cfg.WebQueueToken == "" || subtle.ConstantTimeCompare([]byte(tokenStr), []byte(h.cfg.WebQueueToken)) != 1 {
+			sendError(w, http.StatusUnauthorized, "Invalid correction queue token")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (h *Handler) GetCorrectionQueue(w http.ResponseWriter, r *http.Request) {
+	var after int64
+	if s := r.URL.Query().Get("after"); s != "" {
+		var err error
+		after, err = strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			sendError(w, http.StatusBadRequest, "invalid after")
+			return
+		}
+	}
+	sendResult(w, h.correctionQueue.Events(after))
+}
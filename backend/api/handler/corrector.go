@@ -0,0 +1,372 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/Rastaiha/bermudia/api/hub"
+	"github.com/Rastaiha/bermudia/internal/domain"
+	"github.com/Rastaiha/bermudia/internal/notifier"
+	"github.com/go-chi/chi/v5"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// correctorRoles can use the corrector console, its queue and answer files. Mentors grade answers as well.
+var correctorRoles = []domain.Role{domain.RoleCorrector, domain.RoleMentor, domain.RoleAdmin}
+
+func handleCorrectionError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, domain.ErrCorrectionNotFound), errors.Is(err, domain.ErrFeedbackTemplateNotFound):
+		sendError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, domain.ErrAnswerNotPending),
+		errors.Is(err, domain.ErrAnswerClaimed),
+		errors.Is(err, domain.ErrSecondGradeBySameCorrector),
+		errors.Is(err, domain.ErrCorrectionStatusChanged):
+		sendError(w, http.StatusConflict, err.Error())
+	default:
+		handleError(w, err)
+	}
+}
+
+type queuedAnswerView struct {
+	UserID       int32      `json:"userId"`
+	Username     string     `json:"username"`
+	Territory    string     `json:"territory"`
+	Pool         string     `json:"pool,omitempty"`
+	QuestionID   string     `json:"questionId"`
+	QuestionText string     `json:"questionText"`
+	Hint         string     `json:"correctionHintMessage,omitempty"`
+	FileID       string     `json:"fileId,omitempty"`
+	Filename     string     `json:"filename,omitempty"`
+	TextContent  string     `json:"textContent,omitempty"`
+	SubmittedAt  int64      `json:"submittedAt"`
+	Claim        *claimView `json:"claim,omitempty"`
+}
+
+type claimView struct {
+	CorrectorID   int64  `json:"correctorId"`
+	CorrectorName string `json:"correctorName"`
+	ClaimedAt     int64  `json:"claimedAt"`
+	ExpiresAt     int64  `json:"expiresAt"`
+}
+
+func toClaimView(claim domain.AnswerClaim) *claimView {
+	return &claimView{
+		CorrectorID:   claim.Corrector.ID,
+		CorrectorName: claim.Corrector.Name,
+		ClaimedAt:     claim.ClaimedAt.UnixMilli(),
+		ExpiresAt:     claim.ExpiresAt.UnixMilli(),
+	}
+}
+
+func toQueuedAnswerView(a domain.QueuedAnswer) queuedAnswerView {
+	v := queuedAnswerView{
+		UserID:       a.Answer.UserID,
+		Username:     a.Username,
+		Territory:    a.Territory,
+		Pool:         a.Pool,
+		QuestionID:   a.Question.QuestionID,
+		QuestionText: a.Question.Text,
+		Hint:         a.Question.Context,
+		FileID:       a.Answer.FileID.String,
+		Filename:     a.Answer.Filename.String,
+		TextContent:  a.Answer.TextContent.String,
+		SubmittedAt:  a.Answer.UpdatedAt.UnixMilli(),
+	}
+	if a.Claim != nil {
+		v.Claim = toClaimView(*a.Claim)
+	}
+	return v
+}
+
+func (h *Handler) GetCorrectorQueue(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	queue, err := h.correctionService.GetQueue(r.Context(), domain.CorrectionQueueFilter{
+		Territory:  query.Get("territory"),
+		Pool:       query.Get("pool"),
+		QuestionID: query.Get("question"),
+	})
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+	result := make([]queuedAnswerView, 0, len(queue))
+	for _, a := range queue {
+		result = append(result, toQueuedAnswerView(a))
+	}
+	sendResult(w, result)
+}
+
+type answerRequest struct {
+	UserID     int32  `json:"userId"`
+	QuestionID string `json:"questionId"`
+}
+
+func (h *Handler) ClaimAnswer(w http.ResponseWriter, r *http.Request) {
+	user, err := getUser(r.Context())
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+	var req answerRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendDecodeError(w)
+		return
+	}
+	// there is no bot message behind a claim made from the console
+	claim, err := h.correctionService.Claim(r.Context(), user.AsCorrector(), req.UserID, req.QuestionID, 0, 0)
+	if err != nil {
+		handleCorrectionError(w, err)
+		return
+	}
+	queued, err := h.correctionService.GetQueuedAnswer(r.Context(), req.UserID, req.QuestionID)
+	if err != nil {
+		handleCorrectionError(w, err)
+		return
+	}
+	queued.Claim = &claim
+	sendResult(w, toQueuedAnswerView(queued))
+}
+
+func (h *Handler) UnclaimAnswer(w http.ResponseWriter, r *http.Request) {
+	user, err := getUser(r.Context())
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+	var req answerRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendDecodeError(w)
+		return
+	}
+	if err := h.correctionService.Unclaim(r.Context(), user.AsCorrector(), req.UserID, req.QuestionID, false); err != nil {
+		handleCorrectionError(w, err)
+		return
+	}
+	sendResult(w, map[string]any{})
+}
+
+type correctionStatusRequest struct {
+	Status string `json:"status"`
+}
+
+func parseAnswerStatus(s string) (domain.AnswerStatus, bool) {
+	switch s {
+	case "correct":
+		return domain.AnswerStatusCorrect, true
+	case "half-correct":
+		return domain.AnswerStatusHalfCorrect, true
+	case "wrong":
+		return domain.AnswerStatusWrong, true
+	}
+	return 0, false
+}
+
+type createCorrectionRequest struct {
+	answerRequest
+	correctionStatusRequest
+}
+
+func (h *Handler) CreateCorrection(w http.ResponseWriter, r *http.Request) {
+	user, err := getUser(r.Context())
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+	var req createCorrectionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendDecodeError(w)
+		return
+	}
+	status, ok := parseAnswerStatus(req.Status)
+	if !ok {
+		sendError(w, http.StatusBadRequest, "status must be one of correct, half-correct or wrong")
+		return
+	}
+	id, err := h.correctionService.CreateCorrection(r.Context(), user.AsCorrector(), req.UserID, req.QuestionID, status)
+	if err != nil {
+		handleCorrectionError(w, err)
+		return
+	}
+	sendResult(w, map[string]any{
+		"id": id,
+	})
+}
+
+func (h *Handler) UpdateCorrectionStatus(w http.ResponseWriter, r *http.Request) {
+	user, err := getUser(r.Context())
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+	var req correctionStatusRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendDecodeError(w)
+		return
+	}
+	status, ok := parseAnswerStatus(req.Status)
+	if !ok {
+		sendError(w, http.StatusBadRequest, "status must be one of correct, half-correct or wrong")
+		return
+	}
+	if err := h.correctionService.UpdateCorrectionNewStatus(r.Context(), user.AsCorrector(), chi.URLParam(r, "correctionID"), status); err != nil {
+		handleCorrectionError(w, err)
+		return
+	}
+	sendResult(w, map[string]any{})
+}
+
+type correctionFeedbackRequest struct {
+	Feedback   string `json:"feedback"`
+	TemplateID string `json:"templateId"`
+}
+
+func (h *Handler) UpdateCorrectionFeedback(w http.ResponseWriter, r *http.Request) {
+	user, err := getUser(r.Context())
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+	var req correctionFeedbackRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendDecodeError(w)
+		return
+	}
+	correctionId := chi.URLParam(r, "correctionID")
+	if req.TemplateID != "" {
+		_, err = h.correctionService.ApplyFeedbackTemplate(r.Context(), user.AsCorrector(), correctionId, req.TemplateID)
+	} else {
+		_, err = h.correctionService.UpdateCorrectionFeedback(r.Context(), user.AsCorrector(), correctionId, req.Feedback)
+	}
+	if err != nil {
+		handleCorrectionError(w, err)
+		return
+	}
+	sendResult(w, map[string]any{})
+}
+
+func (h *Handler) FinalizeCorrection(w http.ResponseWriter, r *http.Request) {
+	user, err := getUser(r.Context())
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+	status, err := h.correctionService.FinalizeCorrection(r.Context(), user.AsCorrector(), chi.URLParam(r, "correctionID"))
+	if err != nil {
+		handleCorrectionError(w, err)
+		return
+	}
+	var result string
+	switch status {
+	case domain.CorrectionStatusBlind:
+		result = "awaiting_second_grade"
+	case domain.CorrectionStatusDisputed:
+		result = "disputed"
+	default:
+		result = "applied"
+	}
+	sendResult(w, map[string]any{
+		"result": result,
+	})
+}
+
+type feedbackTemplateView struct {
+	ID          string `json:"id"`
+	Text        string `json:"text"`
+	TerritoryID string `json:"territoryId,omitempty"`
+	FromContent bool   `json:"fromContent"`
+	UsageCount  int    `json:"usageCount"`
+}
+
+func toFeedbackTemplateView(t domain.FeedbackTemplate) feedbackTemplateView {
+	return feedbackTemplateView{
+		ID:          t.ID,
+		Text:        t.Text,
+		TerritoryID: t.TerritoryID,
+		FromContent: t.FromContent,
+		UsageCount:  t.UsageCount,
+	}
+}
+
+func (h *Handler) GetFeedbackTemplates(w http.ResponseWriter, r *http.Request) {
+	templates, err := h.correctionService.GetFeedbackTemplates(r.Context(), chi.URLParam(r, "correctionID"))
+	if err != nil {
+		handleCorrectionError(w, err)
+		return
+	}
+	result := make([]feedbackTemplateView, 0, len(templates))
+	for _, t := range templates {
+		result = append(result, toFeedbackTemplateView(t))
+	}
+	sendResult(w, result)
+}
+
+type saveFeedbackTemplateRequest struct {
+	Text         string `json:"text"`
+	ForTerritory bool   `json:"forTerritory"`
+}
+
+func (h *Handler) SaveFeedbackTemplate(w http.ResponseWriter, r *http.Request) {
+	user, err := getUser(r.Context())
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+	var req saveFeedbackTemplateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendDecodeError(w)
+		return
+	}
+	template, err := h.correctionService.SaveFeedbackTemplate(r.Context(), user.AsCorrector(), chi.URLParam(r, "correctionID"), req.Text, req.ForTerritory)
+	if err != nil {
+		handleCorrectionError(w, err)
+		return
+	}
+	sendResult(w, toFeedbackTemplateView(template))
+}
+
+func (h *Handler) HandleCorrectorEvent(e notifier.Event) {
+	h.correctorHub.Broadcast(channelCorrector, func(userId int32, c *hub.Connection) {
+		h.correctorHub.SendOnConn(c, userId, channelCorrector, 0, e)
+	})
+}
+
+// StreamCorrectorEvents sends the current queue to the corrector and then pushes
+// every correction related event, e.g. new answers, as it happens.
+func (h *Handler) StreamCorrectorEvents(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.authService.ValidateToken(r.Context(), r.URL.Query().Get("token"))
+	if !ok {
+		sendError(w, http.StatusUnauthorized, "Invalid auth token")
+		return
+	}
+	if !user.HasRole(correctorRoles...) {
+		sendError(w, http.StatusForbidden, "You do not have access to this endpoint")
+		return
+	}
+	conn, err := h.wsUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		slog.Error("websocket upgrade failed", slog.String("error", err.Error()))
+		return
+	}
+	c := h.correctorHub.RegisterChannel(user.ID, conn, channelCorrector)
+
+	// the events pushed after this one are at most reflected twice, never missed
+	seq := h.correctionQueue.LastSeq()
+	queue, err := h.correctionService.GetQueue(r.Context(), domain.CorrectionQueueFilter{})
+	if err != nil {
+		slog.Error("get initial corrector queue failed", slog.String("error", err.Error()))
+		h.correctorHub.RemoveConnection(user.ID, c, errors.New("failed to get initial queue"))
+		return
+	}
+	views := make([]queuedAnswerView, 0, len(queue))
+	for _, a := range queue {
+		views = append(views, toQueuedAnswerView(a))
+	}
+	h.correctorHub.SendOnConn(c, user.ID, channelCorrector, 0, notifier.Event{
+		Seq:     seq,
+		Type:    notifier.EventQueue,
+		Time:    time.Now().UTC(),
+		Payload: views,
+	})
+}
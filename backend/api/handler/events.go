@@ -1,32 +1,121 @@
 package handler
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"github.com/Rastaiha/bermudia/api/hub"
 	"github.com/Rastaiha/bermudia/internal/domain"
 	"log/slog"
 	"net/http"
+	"strconv"
 	"time"
 )
 
+// Topics of the event bus that carry the events of the event hub, so that they reach
+// the connections of a user on any replica.
 const (
-	eventSendTimeout = 15 * time.Second
+	topicPlayerEvents = "player_events"
+	topicTradeEvents  = "trade_events"
+	topicInboxEvents  = "inbox_events"
 )
 
-func (h *Handler) createConnection(w http.ResponseWriter, r *http.Request, hb *hub.Hub) (*domain.User, *hub.Connection) {
+// userEvent is an event of a channel for one user on the event bus.
+type userEvent struct {
+	UserId  int32           `json:"userId"`
+	Seq     int64           `json:"seq"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+func newUserEvent(userId int32, seq int64, payload any) (userEvent, error) {
+	data, err := json.Marshal(payload)
+	return userEvent{UserId: userId, Seq: seq, Payload: data}, err
+}
+
+func (h *Handler) publish(topic string, payload any) error {
+	if err := h.bus.Publish(context.Background(), topic, payload); err != nil {
+		return fmt.Errorf("publish event of topic %q: %w", topic, err)
+	}
+	return nil
+}
+
+func (h *Handler) publishUserEvents(topic string, events ...userEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+	return h.publish(topic, events)
+}
+
+// deliverUserEvents sends the events of the topic to the local connections of their users.
+func (h *Handler) deliverUserEvents(channel string) func(payload []byte) {
+	return func(payload []byte) {
+		var events []userEvent
+		if err := json.Unmarshal(payload, &events); err != nil {
+			slog.Error("invalid user events",
+				slog.String("channel", channel),
+				slog.String("error", err.Error()),
+			)
+			return
+		}
+		for _, e := range events {
+			h.eventHub.Send(e.UserId, channel, e.Seq, e.Payload)
+		}
+	}
+}
+
+// Channels of the event hub. The corrector channel lives in its own hub.
+const (
+	channelPlayer    = "player"
+	channelTrade     = "trade"
+	channelInbox     = "inbox"
+	channelPresence  = "presence"
+	channelCorrector = "corrector"
+)
+
+// authenticateStream authenticates the player opening a stream by the token in the query,
+// since neither browser websockets nor EventSource can set headers.
+func (h *Handler) authenticateStream(w http.ResponseWriter, r *http.Request) (*domain.User, string, bool) {
 	token := r.URL.Query().Get("token")
 	user, ok := h.authService.ValidateToken(r.Context(), token)
 	if !ok {
 		sendError(w, http.StatusUnauthorized, "Invalid auth token")
+		return nil, "", false
+	}
+	if !user.HasRole(domain.RolePlayer) {
+		sendError(w, http.StatusForbidden, "You do not have access to this endpoint")
+		return nil, "", false
+	}
+	return user, token, true
+}
+
+// createConnection upgrades the request of a player to a websocket in the event hub.
+// An empty channel makes a multiplexed connection.
+func (h *Handler) createConnection(w http.ResponseWriter, r *http.Request, channel string) (*domain.User, *hub.Connection) {
+	user, token, ok := h.authenticateStream(w, r)
+	if !ok {
 		return nil, nil
 	}
 	conn, err := h.wsUpgrader.Upgrade(w, r, nil)
 	if err != nil {
-		slog.Error("websocket upgrade failed", err)
+		slog.Error("websocket upgrade failed", slog.String("error", err.Error()))
 		return user, nil
 	}
-	connection := hb.Register(user.ID, conn)
-	return user, connection
+	if channel == "" {
+		return user, h.eventHub.Register(user.ID, conn, h.rpcHandler(token))
+	}
+	return user, h.eventHub.RegisterChannel(user.ID, conn, channel)
+}
+
+// StreamEvents opens a single connection for all channels. Every message is an envelope
+// {channel, seq, payload}; the client picks channels by sending {"action": "subscribe", "channel": "trade"}
+// and {"action": "unsubscribe", ...}. Subscribing sends the initial events of the channel.
+// After a reconnect, a client subscribes with {"action": "subscribe", "channel": "inbox", "lastSeq": 42},
+// where 42 is the last seq it received on the channel, to receive the events it missed instead.
+// Game actions can be sent as requests too: {"id": "1", "action": "travel", "params": {...}} is answered
+// on the rpc channel with {id, status, ok, result|error}, the same as POST /travel would.
+func (h *Handler) StreamEvents(w http.ResponseWriter, r *http.Request) {
+	h.createConnection(w, r, "")
 }
 
 type playerEvent struct {
@@ -34,70 +123,168 @@ type playerEvent struct {
 	Timestamp    int64                         `json:"timestamp,string"`
 }
 
-func (h *Handler) HandlePlayerUpdateEvent(e *domain.FullPlayerUpdateEvent) {
-	event := &playerEvent{
-		PlayerUpdate: e,
-		Timestamp:    time.Now().UTC().UnixMilli(),
+func toPlayerEvent(e *domain.FullPlayerUpdateEvent) hub.Event {
+	return hub.Event{
+		Seq: e.Seq,
+		Payload: &playerEvent{
+			PlayerUpdate: e,
+			Timestamp:    time.Now().UTC().UnixMilli(),
+		},
 	}
-	go h.playerHub.Send(e.Player.UserId, event, eventSendTimeout)
 }
 
-func (h *Handler) StreamPlayerEvents(w http.ResponseWriter, r *http.Request) {
-	user, c := h.createConnection(w, r, h.playerHub)
-	if c == nil {
-		return
+func (h *Handler) HandlePlayerUpdateEvent(e *domain.FullPlayerUpdateEvent) error {
+	event := toPlayerEvent(e)
+	ue, err := newUserEvent(e.Player.UserId, event.Seq, event.Payload)
+	if err != nil {
+		return fmt.Errorf("marshal player event: %w", err)
 	}
-	if err := h.playerService.SendInitialEvents(r.Context(), user.ID); err != nil {
-		slog.Error("send initial events failed", slog.String("error", err.Error()))
-		h.playerHub.RemoveConnection(user.ID, c, errors.New("failed to send initial events"))
+	return h.publishUserEvents(topicPlayerEvents, ue)
+}
+
+func (h *Handler) initialPlayerEvents(userId int32) ([]hub.Event, error) {
+	e, err := h.playerService.GetInitialPlayerEvent(context.Background(), userId)
+	if err != nil {
+		return nil, fmt.Errorf("get initial player event: %w", err)
 	}
+	return []hub.Event{toPlayerEvent(e)}, nil
 }
 
-func (h *Handler) HandleTradeEventBroadcast(eventProvider func(userId int32) *domain.TradeEvent) {
-	h.tradeHub.Broadcast(func(userId int32, c *hub.Connection) {
-		event := eventProvider(userId)
-		go h.tradeHub.SendOnConn(c, userId, event, eventSendTimeout)
-	})
+func (h *Handler) replayPlayerEvents(userId int32, lastSeq int64, limit int) ([]hub.Event, bool, error) {
+	events, ok, err := h.playerService.GetPlayerEventsAfter(context.Background(), userId, lastSeq, limit)
+	if err != nil || !ok {
+		return nil, ok, err
+	}
+	result := make([]hub.Event, 0, len(events))
+	for i := range events {
+		result = append(result, toPlayerEvent(&events[i]))
+	}
+	return result, true, nil
 }
 
-func (h *Handler) StreamTradeEvents(w http.ResponseWriter, r *http.Request) {
-	user, c := h.createConnection(w, r, h.tradeHub)
+func (h *Handler) StreamPlayerEvents(w http.ResponseWriter, r *http.Request) {
+	h.streamChannel(w, r, channelPlayer)
+}
+
+func (h *Handler) StreamPlayerEventsSSE(w http.ResponseWriter, r *http.Request) {
+	h.streamChannelSSE(w, r, channelPlayer)
+}
+
+// streamChannel opens a single channel websocket and sends it the initial events of the channel.
+func (h *Handler) streamChannel(w http.ResponseWriter, r *http.Request, channel string) {
+	user, c := h.createConnection(w, r, channel)
 	if c == nil {
 		return
 	}
+	h.openChannel(user.ID, c, nil)
+}
 
-	event, err := h.playerService.GetInitialTradeEvent(r.Context())
+// streamChannelSSE serves a single channel as Server-Sent Events, for networks that block websockets.
+// The id of an event is its seq, so after a reconnect, EventSource sends the last one it received
+// as Last-Event-ID and the events it missed are sent instead of the initial events.
+func (h *Handler) streamChannelSSE(w http.ResponseWriter, r *http.Request, channel string) {
+	user, _, ok := h.authenticateStream(w, r)
+	if !ok {
+		return
+	}
+	var lastSeq *int64
+	if id := r.Header.Get("Last-Event-ID"); id != "" {
+		seq, err := strconv.ParseInt(id, 10, 64)
+		if err != nil {
+			sendError(w, http.StatusBadRequest, "Invalid Last-Event-ID")
+			return
+		}
+		lastSeq = &seq
+	}
+	c, err := h.eventHub.RegisterStream(user.ID, w, r, channel)
 	if err != nil {
-		slog.Error("get initial trade event failed", slog.String("error", err.Error()))
-		h.tradeHub.RemoveConnection(user.ID, c, errors.New("failed to get initial trade events"))
+		slog.Error("event stream failed", slog.String("error", err.Error()))
 		return
 	}
-	h.tradeHub.SendOnConn(c, user.ID, event, eventSendTimeout)
+	h.openChannel(user.ID, c, lastSeq)
+	<-c.Done()
+}
+
+func (h *Handler) openChannel(userId int32, c *hub.Connection, lastSeq *int64) {
+	if err := h.eventHub.Open(userId, c, lastSeq); err != nil {
+		slog.Error("get initial events failed",
+			slog.String("error", err.Error()),
+		)
+		h.eventHub.RemoveConnection(userId, c, errors.New("failed to get initial events"))
+	}
 }
 
-func (h *Handler) HandleInboxEvent(e *domain.InboxEvent) {
-	go h.inboxHub.Send(e.UserId, e, eventSendTimeout)
+func (h *Handler) HandleTradeEventBroadcast(e domain.TradeEventBroadcast) error {
+	return h.publish(topicTradeEvents, e)
 }
 
-func (h *Handler) StreamInboxEvents(w http.ResponseWriter, r *http.Request) {
-	user, c := h.createConnection(w, r, h.inboxHub)
-	if c == nil {
+func (h *Handler) deliverTradeEvent(payload []byte) {
+	var e domain.TradeEventBroadcast
+	if err := json.Unmarshal(payload, &e); err != nil {
+		slog.Error("invalid trade event", slog.String("error", err.Error()))
 		return
 	}
-	event, err := h.playerService.GetInitialInboxEvent(r.Context(), user.ID)
+	h.eventHub.Broadcast(channelTrade, func(userId int32, c *hub.Connection) {
+		event := e.ForOthers
+		if userId == e.Offerer {
+			event = e.ForOfferer
+		}
+		h.eventHub.SendOnConn(c, userId, channelTrade, 0, event)
+	})
+}
+
+func (h *Handler) initialTradeEvents(_ int32) ([]hub.Event, error) {
+	event, err := h.playerService.GetInitialTradeEvent(context.Background())
 	if err != nil {
-		slog.Error("get initial inbox event failed", slog.String("error", err.Error()))
-		h.inboxHub.RemoveConnection(user.ID, c, errors.New("failed to get initial inbox events"))
-		return
+		return nil, fmt.Errorf("get initial trade event: %w", err)
 	}
-	h.inboxHub.SendOnConn(c, user.ID, event, eventSendTimeout)
+	return []hub.Event{{Payload: event}}, nil
 }
 
-func (h *Handler) HandleBroadcastMessage(eventProvider func(userId int32) *domain.InboxMessageView) {
-	h.inboxHub.Broadcast(func(userId int32, c *hub.Connection) {
-		event := eventProvider(userId)
-		if event != nil {
-			go h.inboxHub.SendOnConn(c, userId, event, eventSendTimeout)
+func (h *Handler) StreamTradeEvents(w http.ResponseWriter, r *http.Request) {
+	h.streamChannel(w, r, channelTrade)
+}
+
+func (h *Handler) StreamTradeEventsSSE(w http.ResponseWriter, r *http.Request) {
+	h.streamChannelSSE(w, r, channelTrade)
+}
+
+func (h *Handler) initialInboxEvents(userId int32) ([]hub.Event, error) {
+	event, err := h.playerService.GetInitialInboxEvent(context.Background(), userId)
+	if err != nil {
+		return nil, fmt.Errorf("get initial inbox event: %w", err)
+	}
+	return []hub.Event{{Seq: event.Seq, Payload: event}}, nil
+}
+
+func (h *Handler) replayInboxEvents(userId int32, lastSeq int64, limit int) ([]hub.Event, bool, error) {
+	events, ok, err := h.playerService.GetInboxEventsAfter(context.Background(), userId, lastSeq, limit)
+	if err != nil || !ok {
+		return nil, ok, err
+	}
+	result := make([]hub.Event, 0, len(events))
+	for _, e := range events {
+		result = append(result, hub.Event{Seq: e.Seq, Payload: e})
+	}
+	return result, true, nil
+}
+
+func (h *Handler) StreamInboxEvents(w http.ResponseWriter, r *http.Request) {
+	h.streamChannel(w, r, channelInbox)
+}
+
+func (h *Handler) StreamInboxEventsSSE(w http.ResponseWriter, r *http.Request) {
+	h.streamChannelSSE(w, r, channelInbox)
+}
+
+func (h *Handler) HandleBroadcastMessage(events []*domain.InboxEvent) error {
+	userEvents := make([]userEvent, 0, len(events))
+	for _, e := range events {
+		ue, err := newUserEvent(e.UserId, e.Seq, e)
+		if err != nil {
+			return fmt.Errorf("marshal inbox event: %w", err)
 		}
-	})
+		userEvents = append(userEvents, ue)
+	}
+	return h.publishUserEvents(topicInboxEvents, userEvents...)
 }
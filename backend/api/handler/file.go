@@ -0,0 +1,72 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"github.com/Rastaiha/bermudia/internal/domain"
+	"github.com/go-chi/chi/v5"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// DownloadFile sends an uploaded answer file. Players can only download their own files;
+// correctors, authenticated either with their own token or the correction queue token, can download any file.
+func (h *Handler) DownloadFile(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "fileID")
+	if id == "" {
+		sendError(w, http.StatusBadRequest, "file ID is required")
+		return
+	}
+	tokenStr := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if tokenStr == "" {
+		sendError(w, http.StatusUnauthorized, "Missing auth token")
+		return
+	}
+
+	var file domain.StoredFile
+	var content io.ReadCloser
+	var err error
+	if h.cfg.WebQueueToken != "" && subtle.ConstantTimeCompare([]byte(tokenStr), []byte(h.cfg.WebQueueToken)) == 1 {
+		file, content, err = h.fileService.Open(r.Context(), id)
+	} else {
+		user, ok := h.authService.ValidateToken(r.Context(), tokenStr)
+		if !ok {
+			sendError(w, http.StatusUnauthorized, "Invalid auth token")
+			return
+		}
+		if user.HasRole(correctorRoles...) {
+			file, content, err = h.fileService.Open(r.Context(), id)
+		} else {
+			file, content, err = h.fileService.OpenOwned(r.Context(), user.ID, id)
+		}
+	}
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+	defer func() {
+		if err := content.Close(); err != nil {
+			slog.Error("Error closing stored file", slog.String("error", err.Error()))
+		}
+	}()
+
+	// the type is detected from the uploaded content, so browsers must neither sniff another one
+	// nor render anything but raster images in place
+	disposition := "attachment"
+	if strings.HasPrefix(file.MimeType, "image/") && !strings.HasPrefix(file.MimeType, "image/svg") {
+		disposition = "inline"
+	}
+	w.Header().Set("Content-Type", file.MimeType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Length", strconv.FormatInt(file.Size, 10))
+	w.Header().Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": file.Filename}))
+	w.Header().Set("ETag", fmt.Sprintf("%q", file.SHA256))
+	w.WriteHeader(http.StatusOK)
+	if _, err := io.Copy(w, content); err != nil {
+		slog.Error("Error sending stored file", slog.String("error", err.Error()))
+	}
+}
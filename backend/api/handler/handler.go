@@ -5,6 +5,8 @@ import (
 	"errors"
 	"github.com/Rastaiha/bermudia/api/hub"
 	"github.com/Rastaiha/bermudia/internal/config"
+	"github.com/Rastaiha/bermudia/internal/domain"
+	"github.com/Rastaiha/bermudia/internal/notifier"
 	"github.com/Rastaiha/bermudia/internal/service"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
@@ -14,33 +16,73 @@ import (
 	"net/http"
 	"os"
 	"regexp"
+	"sync"
 	"time"
 )
 
+// shutdownTimeout bounds how long Stop waits for the requests in progress.
+const shutdownTimeout = 30 * time.Second
+
 type Handler struct {
-	cfg              config.Config
-	server           *http.Server
-	wsUpgrader       websocket.Upgrader
-	authService      *service.Auth
-	territoryService *service.Territory
-	islandService    *service.Island
-	playerService    *service.Player
-	playerHub        *hub.Hub
-	tradeHub         *hub.Hub
-	inboxHub         *hub.Hub
+	cfg               config.Config
+	server            *http.Server
+	wsUpgrader        websocket.Upgrader
+	authService       *service.Auth
+	territoryService  *service.Territory
+	islandService     *service.Island
+	playerService     *service.Player
+	fileService       *service.File
+	adminService      *service.Admin
+	correctionService *service.Correction
+	correctionQueue   *notifier.WebQueue
+	// bus carries the events of the event hub to the handlers of every replica
+	bus domain.EventBus
+	// eventHub carries the player, trade, inbox and presence channels
+	eventHub     *hub.Hub
+	correctorHub *hub.Hub
+	// rpcRouter serves the requests on player sockets
+	rpcRouter chi.Router
+	// presenceTerritories is the territory of every presence subscriber, whose map they are sent
+	presenceLock        sync.Mutex
+	presenceTerritories map[int32]string
 }
 
-func New(cfg config.Config, authService *service.Auth, territoryService *service.Territory, islandService *service.Island, playerService *service.Player) *Handler {
-	return &Handler{
-		cfg:              cfg,
-		authService:      authService,
-		territoryService: territoryService,
-		islandService:    islandService,
-		playerService:    playerService,
-		playerHub:        hub.NewHub(),
-		tradeHub:         hub.NewHub(),
-		inboxHub:         hub.NewHub(),
+func New(cfg config.Config, authService *service.Auth, territoryService *service.Territory, islandService *service.Island, playerService *service.Player, fileService *service.File, adminService *service.Admin, correctionService *service.Correction, correctionQueue *notifier.WebQueue, bus domain.EventBus) *Handler {
+	h := &Handler{
+		cfg:                 cfg,
+		authService:         authService,
+		territoryService:    territoryService,
+		islandService:       islandService,
+		playerService:       playerService,
+		fileService:         fileService,
+		adminService:        adminService,
+		correctionService:   correctionService,
+		correctionQueue:     correctionQueue,
+		bus:                 bus,
+		eventHub:            hub.NewHub(cfg.WebSocket),
+		correctorHub:        hub.NewHub(cfg.WebSocket),
+		rpcRouter:           chi.NewRouter(),
+		presenceTerritories: make(map[int32]string),
 	}
+	h.rpcRouter.Use(middleware.Recoverer)
+	h.rpcRouter.Group(h.playerRoutes)
+	h.eventHub.AddChannel(channelPlayer, hub.Channel{
+		Initial:  h.initialPlayerEvents,
+		Replay:   h.replayPlayerEvents,
+		Snapshot: true,
+	})
+	h.eventHub.AddChannel(channelTrade, hub.Channel{
+		Initial: h.initialTradeEvents,
+	})
+	h.eventHub.AddChannel(channelInbox, hub.Channel{
+		Initial: h.initialInboxEvents,
+		Replay:  h.replayInboxEvents,
+	})
+	h.eventHub.AddChannel(channelPresence, hub.Channel{
+		Initial: h.initialPresenceEvents,
+		Ended:   h.endPresence,
+	})
+	return h
 }
 
 func (h *Handler) Start() {
@@ -51,57 +93,72 @@ func (h *Handler) Start() {
 	}
 	r.Use(corsMiddleware)
 	r.Use(middleware.Recoverer)
-	r.Use(middleware.Timeout(30 * time.Second))
 
 	// Routes
 	r.Route("/api/v1", func(r chi.Router) {
-		r.Post("/login", h.Login)
-
-		// ws endpoints
+		// Streams stay open, so they are kept out of the request timeout
+		r.HandleFunc("/ws", h.StreamEvents)
 		r.HandleFunc("/events", h.StreamPlayerEvents)
 		r.HandleFunc("/trade/events", h.StreamTradeEvents)
 		r.HandleFunc("/inbox/events", h.StreamInboxEvents)
+		r.HandleFunc("/corrector/events", h.StreamCorrectorEvents)
+		// Server-Sent Events for networks that block websockets
+		r.Get("/events/sse", h.StreamPlayerEventsSSE)
+		r.Get("/trade/events/sse", h.StreamTradeEventsSSE)
+		r.Get("/inbox/events/sse", h.StreamInboxEventsSSE)
 
-		// Authenticated but not paused
 		r.Group(func(r chi.Router) {
-			r.Use(h.authMiddleware)
-			r.Get("/me", func(w http.ResponseWriter, r *http.Request) {
-				user, err := getUser(r.Context())
-				if err != nil {
-					handleError(w, err)
-					return
-				}
-				sendResult(w, user)
+			r.Use(middleware.Timeout(30 * time.Second))
+			r.Post("/login", h.Login)
+			r.Get("/files/{fileID}", h.DownloadFile)
+
+			// Authenticated with any role
+			r.Group(func(r chi.Router) {
+				r.Use(h.authMiddleware)
+				r.Get("/me", func(w http.ResponseWriter, r *http.Request) {
+					user, err := getUser(r.Context())
+					if err != nil {
+						handleError(w, err)
+						return
+					}
+					sendResult(w, user)
+				})
 			})
-			r.Get("/territories/{territoryID}", h.GetTerritory)
-			r.Get("/territories/{territoryID}/players", h.GetPlayerLocations)
-			r.Get("/islands/{islandID}", h.GetIsland)
-			r.Get("/player", h.GetPlayer)
-			r.Post("/travel_check", h.TravelCheck)
-			r.Post("/refuel_check", h.RefuelCheck)
-			r.Post("/anchor_check", h.AnchorCheck)
-			r.Post("/migrate_check", h.MigrateCheck)
-			r.Post("/unlock_treasure_check", h.UnlockTreasureCheck)
-			r.Post("/trade/make_offer_check", h.MakeOfferCheck)
-			r.Get("/trade/offers", h.GetTradeOffers)
-			r.Post("/invest_check", h.InvestCheck)
-			r.Get("/inbox/messages", h.GetInboxMessages)
-		})
 
-		// Authenticated and paused endpoints
-		r.Group(func(r chi.Router) {
-			r.Use(h.authMiddleware, h.pauseCheckMiddleware)
-			r.Post("/answer/{inputID}", h.SubmitAnswer)
-			r.Get("/answer/{inputID}/help", h.GetAnswerHelp)
-			r.Post("/travel", h.Travel)
-			r.Post("/refuel", h.Refuel)
-			r.Post("/anchor", h.Anchor)
-			r.Post("/migrate", h.Migrate)
-			r.Post("/unlock_treasure", h.UnlockTreasure)
-			r.Post("/trade/make_offer", h.MakeOffer)
-			r.Post("/trade/accept_offer", h.AcceptOffer)
-			r.Post("/trade/delete_offer", h.DeleteOffer)
-			r.Post("/invest", h.Invest)
+			r.Group(h.playerRoutes)
+
+			r.With(h.correctionQueueAuthMiddleware).Get("/corrections/queue", h.GetCorrectionQueue)
+
+			// Corrector console
+			r.Route("/corrector", func(r chi.Router) {
+				r.Use(h.authMiddleware, h.requireRole(correctorRoles...))
+				r.Get("/queue", h.GetCorrectorQueue)
+				r.Post("/claim", h.ClaimAnswer)
+				r.Post("/unclaim", h.UnclaimAnswer)
+				r.Post("/corrections", h.CreateCorrection)
+				r.Post("/corrections/{correctionID}/status", h.UpdateCorrectionStatus)
+				r.Post("/corrections/{correctionID}/feedback", h.UpdateCorrectionFeedback)
+				r.Post("/corrections/{correctionID}/finalize", h.FinalizeCorrection)
+				r.Get("/corrections/{correctionID}/templates", h.GetFeedbackTemplates)
+				r.Post("/corrections/{correctionID}/templates", h.SaveFeedbackTemplate)
+			})
+
+			// Admin endpoints mirroring the admin bot commands
+			r.Route("/admin", func(r chi.Router) {
+				r.Use(h.authMiddleware, h.requireRole(domain.RoleAdmin))
+				r.Post("/pause", h.PauseGame)
+				r.Post("/resume", h.ResumeGame)
+				r.Post("/broadcast", h.BroadcastMessage)
+				r.Post("/investments/{sessionID}/resolve", h.ResolveInvestmentSession)
+				r.Get("/connections", h.GetConnections)
+				r.Get("/corrector_stats", h.GetCorrectorStats)
+				r.Post("/content", h.UploadGameContent)
+				r.Get("/content/versions", h.ListContentVersions)
+				r.Post("/content/versions/{version}/rollback", h.RollbackContent)
+				r.Post("/users/{username}/role", h.SetUserRole)
+				r.Post("/unclaim", h.ForceUnclaimAnswer)
+				r.Post("/disputes/{correctionID}/resolve", h.ResolveCorrectionDispute)
+			})
 		})
 	})
 
@@ -113,8 +170,13 @@ func (h *Handler) Start() {
 
 	h.playerService.OnPlayerUpdate(h.HandlePlayerUpdateEvent)
 	h.playerService.OnTradeEventBroadcast(h.HandleTradeEventBroadcast)
-	h.playerService.OnInboxEvent(h.HandleInboxEvent)
 	h.playerService.OnBroadcastMessage(h.HandleBroadcastMessage)
+	h.playerService.OnPresence(h.HandlePresenceEvent)
+	h.bus.Subscribe(topicPlayerEvents, h.deliverUserEvents(channelPlayer))
+	h.bus.Subscribe(topicTradeEvents, h.deliverTradeEvent)
+	h.bus.Subscribe(topicInboxEvents, h.deliverUserEvents(channelInbox))
+	h.bus.Subscribe(topicPresenceEvents, h.deliverPresenceEvent)
+	h.correctionQueue.OnEvent(h.HandleCorrectorEvent)
 
 	slog.Info("Server starting")
 	h.server = &http.Server{
@@ -134,17 +196,84 @@ func (h *Handler) Start() {
 	}()
 }
 
+// playerRoutes are the endpoints of players. They are served over HTTP and to the requests on the player socket.
+func (h *Handler) playerRoutes(r chi.Router) {
+	r.Use(h.authMiddleware, h.requireRole(domain.RolePlayer))
+
+	// Authenticated players but not paused
+	r.Group(func(r chi.Router) {
+		r.Get("/territories/{territoryID}", h.GetTerritory)
+		r.Get("/territories/{territoryID}/players", h.GetPlayerLocations)
+		r.Get("/islands/{islandID}", h.GetIsland)
+		r.Get("/player", h.GetPlayer)
+		r.Post("/travel_check", h.TravelCheck)
+		r.Post("/refuel_check", h.RefuelCheck)
+		r.Post("/anchor_check", h.AnchorCheck)
+		r.Post("/migrate_check", h.MigrateCheck)
+		r.Post("/unlock_treasure_check", h.UnlockTreasureCheck)
+		r.Post("/trade/make_offer_check", h.MakeOfferCheck)
+		r.Get("/trade/offers", h.GetTradeOffers)
+		r.Post("/invest_check", h.InvestCheck)
+		r.Get("/inbox/messages", h.GetInboxMessages)
+		r.Post("/map_visibility", h.SetMapVisibility)
+	})
+
+	// Authenticated and paused endpoints
+	r.Group(func(r chi.Router) {
+		r.Use(h.pauseCheckMiddleware)
+		r.Post("/answer/{inputID}", h.SubmitAnswer)
+		r.Get("/answer/{inputID}/help", h.GetAnswerHelp)
+		r.Post("/travel", h.Travel)
+		r.Post("/refuel", h.Refuel)
+		r.Post("/anchor", h.Anchor)
+		r.Post("/migrate", h.Migrate)
+		r.Post("/unlock_treasure", h.UnlockTreasure)
+		r.Post("/trade/make_offer", h.MakeOffer)
+		r.Post("/trade/accept_offer", h.AcceptOffer)
+		r.Post("/trade/delete_offer", h.DeleteOffer)
+		r.Post("/invest", h.Invest)
+	})
+}
+
 func (h *Handler) Stop() {
-	if err := h.server.Shutdown(context.Background()); err != nil {
-		slog.Error("Error stopping server:", err)
+	// the handlers of event streams return once their connections are closed, which the shutdown waits for
+	h.eventHub.Close()
+	h.correctorHub.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := h.server.Shutdown(ctx); err != nil {
+		slog.Error("Error stopping server", slog.String("error", err.Error()))
 	}
 }
 
-func (h *Handler) Actives() map[string]int {
-	return map[string]int{
-		"players": h.playerHub.Actives(),
-		"market":  h.tradeHub.Actives(),
-		"inbox":   h.inboxHub.Actives(),
+type ActiveStats struct {
+	Counts map[string]int `json:"counts"`
+	// Sessions is the number of open connections of every connected user.
+	Sessions map[int32]int `json:"sessions"`
+	// Disconnects is the number of closed connections by their reason since the start.
+	Disconnects map[string]int64 `json:"disconnects"`
+}
+
+func (h *Handler) Actives() ActiveStats {
+	sessions := h.eventHub.Sessions()
+	for userId, count := range h.correctorHub.Sessions() {
+		sessions[userId] += count
+	}
+	disconnects := h.eventHub.Disconnects()
+	for reason, count := range h.correctorHub.Disconnects() {
+		disconnects[reason] += count
+	}
+	return ActiveStats{
+		Counts: map[string]int{
+			"players":    h.eventHub.Actives(channelPlayer),
+			"market":     h.eventHub.Actives(channelTrade),
+			"inbox":      h.eventHub.Actives(channelInbox),
+			"correctors": h.correctorHub.Actives(channelCorrector),
+			"sockets":    h.eventHub.Connections() + h.correctorHub.Connections(),
+			"dropped":    int(h.eventHub.DroppedMessages() + h.correctorHub.DroppedMessages()),
+		},
+		Sessions:    sessions,
+		Disconnects: disconnects,
 	}
 }
 
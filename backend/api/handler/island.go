@@ -49,8 +49,17 @@ func (h *Handler) SubmitAnswer(w http.ResponseWriter, r *http.Request) {
 		sendError(w, http.StatusBadRequest, "input ID is required")
 		return
 	}
+	if h.cfg.MaxAnswerFileSize > 0 {
+		// leave room for the other parts of the form
+		r.Body = http.MaxBytesReader(w, r.Body, h.cfg.MaxAnswerFileSize+1<<20)
+	}
 	err = r.ParseMultipartForm(1 << 20)
 	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			handleError(w, domain.ErrFileTooLarge(h.cfg.MaxAnswerFileSize))
+			return
+		}
 		sendError(w, http.StatusBadRequest, "Error parsing multipart form")
 		return
 	}
@@ -75,7 +84,7 @@ func (h *Handler) SubmitAnswer(w http.ResponseWriter, r *http.Request) {
 		}
 		defer func() {
 			if err := f.Close(); err != nil {
-				slog.Error("Error closing multipart file", err)
+				slog.Error("Error closing multipart file", slog.String("error", err.Error()))
 			}
 		}()
 		file = &tempReadCloser{f}
@@ -0,0 +1,178 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/Rastaiha/bermudia/api/hub"
+	"github.com/Rastaiha/bermudia/internal/service"
+	"log/slog"
+	"net/http"
+)
+
+const topicPresenceEvents = "presence_events"
+
+// presenceEvent updates the map of a territory. A full event has all islands with players;
+// otherwise it has the new players of the changed islands, which may be none.
+type presenceEvent struct {
+	TerritoryID string                    `json:"territoryId"`
+	Full        bool                      `json:"full"`
+	Islands     []service.PlayersLocation `json:"islands"`
+}
+
+// presenceBusEvent is service.PresenceEvent on the event bus, keeping the user ids of the players.
+type presenceBusEvent struct {
+	UserId      int32                  `json:"userId"`
+	TerritoryID string                 `json:"territoryId"`
+	Changes     []presenceBusTerritory `json:"changes"`
+}
+
+type presenceBusTerritory struct {
+	TerritoryID string              `json:"territoryId"`
+	Islands     []presenceBusIsland `json:"islands"`
+}
+
+type presenceBusIsland struct {
+	IslandID string              `json:"islandId"`
+	Players  []presenceBusPlayer `json:"players"`
+}
+
+type presenceBusPlayer struct {
+	UserId int32  `json:"userId"`
+	Name   string `json:"name"`
+}
+
+func (h *Handler) HandlePresenceEvent(e service.PresenceEvent) {
+	event := presenceBusEvent{UserId: e.UserId, TerritoryID: e.TerritoryID}
+	for _, c := range e.Changes {
+		t := presenceBusTerritory{TerritoryID: c.TerritoryID}
+		for _, island := range c.Islands {
+			i := presenceBusIsland{IslandID: island.IslandID}
+			for _, player := range island.Players {
+				i.Players = append(i.Players, presenceBusPlayer{UserId: player.UserID, Name: player.Name})
+			}
+			t.Islands = append(t.Islands, i)
+		}
+		event.Changes = append(event.Changes, t)
+	}
+	if err := h.publish(topicPresenceEvents, event); err != nil {
+		slog.Error("failed to publish presence event", slog.String("error", err.Error()))
+	}
+}
+
+// deliverPresenceEvent sends the changes of each territory to the subscribers that are in it.
+// A subscriber that moved to another territory gets the full map of the new one instead.
+func (h *Handler) deliverPresenceEvent(payload []byte) {
+	var e presenceBusEvent
+	if err := json.Unmarshal(payload, &e); err != nil {
+		slog.Error("invalid presence event", slog.String("error", err.Error()))
+		return
+	}
+	moved := h.setPresenceTerritory(e.UserId, e.TerritoryID, false)
+	for _, c := range e.Changes {
+		islands := make([]service.PlayersLocation, 0, len(c.Islands))
+		for _, island := range c.Islands {
+			l := service.PlayersLocation{IslandID: island.IslandID}
+			for _, player := range island.Players {
+				l.Players = append(l.Players, service.LocatedPlayer{UserID: player.UserId, Name: player.Name})
+			}
+			islands = append(islands, l)
+		}
+		h.eventHub.Broadcast(channelPresence, func(userId int32, conn *hub.Connection) {
+			if (moved && userId == e.UserId) || h.presenceTerritory(userId) != c.TerritoryID {
+				return
+			}
+			h.eventHub.SendOnConn(conn, userId, channelPresence, 0, presenceEvent{
+				TerritoryID: c.TerritoryID,
+				Islands:     service.FilterPlayerLocations(islands, userId, true),
+			})
+		})
+	}
+	if !moved {
+		return
+	}
+	locations, err := h.playerService.GetPlayerLocations(context.Background(), e.UserId, e.TerritoryID)
+	if err != nil {
+		slog.Error("failed to get player locations",
+			slog.Int("userId", int(e.UserId)),
+			slog.String("error", err.Error()),
+		)
+		return
+	}
+	h.eventHub.Broadcast(channelPresence, func(userId int32, conn *hub.Connection) {
+		if userId == e.UserId {
+			h.eventHub.SendOnConn(conn, userId, channelPresence, 0, presenceEvent{
+				TerritoryID: e.TerritoryID,
+				Full:        true,
+				Islands:     locations,
+			})
+		}
+	})
+}
+
+// setPresenceTerritory keeps the territory of a presence subscriber and reports whether it changed.
+// Territories of other players are only kept when force is set.
+func (h *Handler) setPresenceTerritory(userId int32, territoryID string, force bool) bool {
+	h.presenceLock.Lock()
+	defer h.presenceLock.Unlock()
+	current, ok := h.presenceTerritories[userId]
+	if !ok && !force {
+		return false
+	}
+	h.presenceTerritories[userId] = territoryID
+	return ok && current != territoryID
+}
+
+func (h *Handler) presenceTerritory(userId int32) string {
+	h.presenceLock.Lock()
+	defer h.presenceLock.Unlock()
+	return h.presenceTerritories[userId]
+}
+
+// endPresence forgets the territory of the user once none of their connections is subscribed to presence.
+func (h *Handler) endPresence(userId int32) {
+	h.presenceLock.Lock()
+	defer h.presenceLock.Unlock()
+	if !h.eventHub.Subscribed(userId, channelPresence) {
+		delete(h.presenceTerritories, userId)
+	}
+}
+
+func (h *Handler) initialPresenceEvents(userId int32) ([]hub.Event, error) {
+	territoryID, locations, err := h.playerService.GetInitialPresence(context.Background(), userId)
+	if err != nil {
+		return nil, fmt.Errorf("get initial presence: %w", err)
+	}
+	h.setPresenceTerritory(userId, territoryID, true)
+	return []hub.Event{{Payload: presenceEvent{
+		TerritoryID: territoryID,
+		Full:        true,
+		Islands:     locations,
+	}}}, nil
+}
+
+type mapVisibilityRequest struct {
+	Hidden bool `json:"hidden"`
+}
+
+func (h *Handler) SetMapVisibility(w http.ResponseWriter, r *http.Request) {
+	user, err := getUser(r.Context())
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	var req mapVisibilityRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendDecodeError(w)
+		return
+	}
+
+	err = h.playerService.SetMapVisibility(r.Context(), user.ID, req.Hidden)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	sendResult(w, struct{}{})
+}
@@ -0,0 +1,134 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/Rastaiha/bermudia/api/hub"
+	"github.com/go-chi/chi/v5"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// rpcRequestTimeout matches the timeout of HTTP requests.
+const rpcRequestTimeout = 30 * time.Second
+
+// rpcResponse is the response to a request on a player socket. Besides the fields of APIResponse,
+// it has the id of the request and the HTTP status the same request would get.
+type rpcResponse struct {
+	ID     string          `json:"id"`
+	Status int             `json:"status"`
+	OK     bool            `json:"ok"`
+	Error  string          `json:"error,omitempty"`
+	Result json.RawMessage `json:"result,omitempty"`
+}
+
+// rpcMultipartRoutes are the routes of endpoints that take multipart forms, which requests cannot carry.
+var rpcMultipartRoutes = map[string]bool{
+	"/answer/{inputID}": true,
+}
+
+// rpcHandler handles the requests on the socket of a player. The action of a request names a player
+// endpoint, e.g. "travel" or "trade/make_offer", which is called with its own method and params.
+// So a request goes through the same authentication, pause check and services as over HTTP,
+// without paying for a round trip of its own.
+func (h *Handler) rpcHandler(token string) hub.RequestFunc {
+	return func(_ int32, req hub.Request) any {
+		ctx, cancel := context.WithTimeout(context.Background(), rpcRequestTimeout)
+		defer cancel()
+		r, status, err := h.newRPCRequest(ctx, "/"+strings.TrimPrefix(req.Action, "/"), req.Params)
+		if err != nil {
+			return rpcResponse{ID: req.ID, Status: status, Error: err.Error()}
+		}
+		r.Header.Set("Authorization", "Bearer "+token)
+
+		w := &rpcResponseWriter{header: make(http.Header)}
+		h.rpcRouter.ServeHTTP(w, r)
+
+		// an APIResponse whose result is kept as it is
+		var response struct {
+			OK     bool            `json:"ok"`
+			Error  string          `json:"error"`
+			Result json.RawMessage `json:"result"`
+		}
+		if err := json.Unmarshal(w.body.Bytes(), &response); err != nil {
+			// responses of the router itself are plain text
+			return rpcResponse{ID: req.ID, Status: w.status, Error: strings.TrimSpace(w.body.String())}
+		}
+		return rpcResponse{
+			ID:     req.ID,
+			Status: w.status,
+			OK:     response.OK,
+			Error:  response.Error,
+			Result: response.Result,
+		}
+	}
+}
+
+// newRPCRequest makes the request to the player endpoint at path. An endpoint taking POST gets the params
+// as its JSON body, and one taking GET gets them as its query, e.g. {"limit": 10} as ?limit=10.
+// It returns the status of the response to send instead if the action cannot be called.
+func (h *Handler) newRPCRequest(ctx context.Context, path string, params json.RawMessage) (*http.Request, int, error) {
+	if pattern := h.rpcRouter.Find(chi.NewRouteContext(), http.MethodPost, path); pattern != "" {
+		if rpcMultipartRoutes[pattern] {
+			return nil, http.StatusBadRequest, errors.New("this action takes a multipart form; send it over HTTP")
+		}
+		body := []byte(params)
+		if len(body) == 0 {
+			body = []byte("{}")
+		}
+		r, err := http.NewRequestWithContext(ctx, http.MethodPost, path, bytes.NewReader(body))
+		if err != nil {
+			return nil, http.StatusBadRequest, errors.New("invalid action")
+		}
+		r.Header.Set("Content-Type", "application/json")
+		return r, 0, nil
+	}
+	if h.rpcRouter.Find(chi.NewRouteContext(), http.MethodGet, path) != "" {
+		query := url.Values{}
+		if len(params) > 0 {
+			var values map[string]json.RawMessage
+			if err := json.Unmarshal(params, &values); err != nil {
+				return nil, http.StatusBadRequest, errors.New("params must be an object")
+			}
+			for key, value := range values {
+				var s string
+				if json.Unmarshal(value, &s) != nil {
+					s = string(value)
+				}
+				query.Set(key, s)
+			}
+		}
+		r, err := http.NewRequestWithContext(ctx, http.MethodGet, path+"?"+query.Encode(), nil)
+		if err != nil {
+			return nil, http.StatusBadRequest, errors.New("invalid action")
+		}
+		return r, 0, nil
+	}
+	return nil, http.StatusNotFound, errors.New("unknown action")
+}
+
+// rpcResponseWriter keeps the response of an endpoint called for a request.
+type rpcResponseWriter struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (w *rpcResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *rpcResponseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *rpcResponseWriter) Write(b []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	return w.body.Write(b)
+}
@@ -1,168 +1,753 @@
 package hub
 
 import (
+	"encoding/json"
 	"errors"
+	"github.com/Rastaiha/bermudia/internal/config"
 	"github.com/gorilla/websocket"
 	"log/slog"
+	"maps"
+	"net/http"
+	"slices"
 	"sync"
 	"sync/atomic"
 	"time"
 )
 
+const (
+	// ControlChannel carries the replies to subscribe and unsubscribe messages on multiplexed connections.
+	ControlChannel = "control"
+	// RPCChannel carries the responses to requests.
+	RPCChannel = "rpc"
+
+	ActionSubscribe   = "subscribe"
+	ActionUnsubscribe = "unsubscribe"
+)
+
+const (
+	writeTimeout = 15 * time.Second
+	// maxReplay is the number of missed events replayed on a resumed subscription, at most half
+	// of the send buffer to leave room for the live events. A client that missed more receives
+	// the initial events instead.
+	maxReplay = 128
+	// maxPendingRequests is the number of requests a connection may have waiting to be handled.
+	maxPendingRequests = 16
+)
+
+// Reasons of disconnects, as logged and counted by the hub.
+const (
+	DisconnectClientClosed = "client_closed"
+	DisconnectIdle         = "idle"
+	DisconnectReadError    = "read_error"
+	DisconnectWriteError   = "write_error"
+	DisconnectSlowConsumer = "slow_consumer"
+	DisconnectReplaced     = "replaced"
+	DisconnectServerError  = "server_error"
+	DisconnectShutdown     = "shutdown"
+)
+
 var (
 	errClosed = errors.New("connection closed")
 )
 
+// Envelope wraps everything written to a multiplexed connection.
+// Seq is the sequence number of the event among the events of the user. It increases on every
+// sequenced channel and is zero for messages that are not stored, like those of the trade channel.
+// Clients should ignore an event whose seq they have already seen.
+type Envelope struct {
+	Channel string `json:"channel"`
+	Seq     int64  `json:"seq,omitempty"`
+	Payload any    `json:"payload"`
+}
+
+// ClientMessage is what clients send on a multiplexed connection.
+// A subscribe message with LastSeq replays the events of the channel after it instead of the initial events.
+// A message with an ID is a request instead, see Request.
+type ClientMessage struct {
+	ID      string          `json:"id,omitempty"`
+	Action  string          `json:"action"`
+	Channel string          `json:"channel,omitempty"`
+	LastSeq *int64          `json:"lastSeq,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+// Request is an action a client asks for on its connection, {"id": "1", "action": "travel", "params": {...}}.
+// The response, with the same id, is written on RPCChannel. Only multiplexed connections take requests.
+// Requests of a connection are handled one at a time, off the goroutine reading the connection.
+type Request struct {
+	ID     string
+	Action string
+	Params json.RawMessage
+}
+
+// RequestFunc handles the requests of a connection. It is called on a goroutine of the connection
+// that handles its requests in order.
+type RequestFunc func(userId int32, req Request) any
+
+type controlPayload struct {
+	Action  string `json:"action,omitempty"`
+	Channel string `json:"channel,omitempty"`
+	Resumed bool   `json:"resumed,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Event is a message of a channel with its sequence number; Seq is zero for unsequenced messages.
+type Event struct {
+	Seq     int64
+	Payload any
+}
+
+// Channel describes how a multiplexed connection subscribes to a channel.
+type Channel struct {
+	// Initial returns the events sent after a subscription, typically the current state. It may be nil.
+	Initial func(userId int32) ([]Event, error)
+	// Replay returns the events of the user after lastSeq, oldest first, at most limit of them.
+	// ok is false when more were missed. A channel without Replay always starts with Initial.
+	Replay func(userId int32, lastSeq int64, limit int) (events []Event, ok bool, err error)
+	// Snapshot means each event carries the whole state, so an event older than one already
+	// written is dropped rather than overwriting the newer state on the client.
+	Snapshot bool
+	// Ended is called after a subscription of the user to the channel ends by unsubscribing or
+	// disconnecting. Other connections of the user may still be subscribed. It may be nil.
+	Ended func(userId int32)
+}
+
+type outMessage struct {
+	channel string
+	seq     int64
+	data    any
+}
+
 type Connection struct {
-	lock   sync.Mutex
-	conn   *websocket.Conn
-	closed atomic.Bool
+	lock        sync.Mutex
+	transport   transport
+	connectedAt time.Time
+	closed      atomic.Bool
+	done        chan struct{}
+	queue       chan outMessage
+	// channel is the only channel of a connection opened on a single channel endpoint.
+	// Its messages are written without an envelope. It is empty for multiplexed connections.
+	channel string
+	// onRequest handles the requests of the connection; without it they are rejected.
+	onRequest RequestFunc
+	// requests holds the requests waiting for onRequest.
+	requests chan Request
+
+	stateLock     sync.Mutex
+	subscriptions map[string]bool
+	// lastSeq is the seq of the last event queued on each channel.
+	lastSeq map[string]int64
+	// pending holds the live events of channels whose subscription is still being set up.
+	pending map[string][]outMessage
 }
 
-func (c *Connection) write(data any, timeout time.Duration) error {
-	if c.closed.Load() {
-		return errClosed
+func (h *Hub) newConnection(t transport, channel string, onRequest RequestFunc) *Connection {
+	return &Connection{
+		transport:     t,
+		onRequest:     onRequest,
+		requests:      make(chan Request, maxPendingRequests),
+		connectedAt:   time.Now(),
+		done:          make(chan struct{}),
+		queue:         make(chan outMessage, h.cfg.SendBuffer),
+		channel:       channel,
+		subscriptions: make(map[string]bool),
+		lastSeq:       make(map[string]int64),
+		pending:       make(map[string][]outMessage),
 	}
+}
+
+func (c *Connection) multiplexed() bool {
+	return c.channel == ""
+}
+
+func (c *Connection) subscribed(channel string) bool {
+	if !c.multiplexed() {
+		return c.channel == channel
+	}
+	c.stateLock.Lock()
+	defer c.stateLock.Unlock()
+	return c.subscriptions[channel]
+}
+
+// channels returns the channels the connection is subscribed to.
+func (c *Connection) channels() []string {
+	if !c.multiplexed() {
+		return []string{c.channel}
+	}
+	c.stateLock.Lock()
+	defer c.stateLock.Unlock()
+	return slices.Collect(maps.Keys(c.subscriptions))
+}
+
+func (c *Connection) unsubscribe(channel string) {
+	c.stateLock.Lock()
+	defer c.stateLock.Unlock()
+	delete(c.subscriptions, channel)
+	delete(c.pending, channel)
+	delete(c.lastSeq, channel)
+}
+
+// enqueue puts the message in the send queue. It must be called with stateLock held so that
+// the messages of a channel are queued in order. It returns false if the queue is full.
+func (c *Connection) enqueue(msg outMessage) bool {
+	if msg.seq > c.lastSeq[msg.channel] {
+		c.lastSeq[msg.channel] = msg.seq
+	}
+	select {
+	case c.queue <- msg:
+		return true
+	default:
+		return false
+	}
+}
+
+// Done is closed once the connection is closed; nothing is written to the connection after that.
+func (c *Connection) Done() <-chan struct{} {
+	return c.done
+}
+
+func (c *Connection) write(msg outMessage) error {
 	c.lock.Lock()
 	defer c.lock.Unlock()
-	err := c.conn.SetWriteDeadline(time.Now().Add(timeout))
-	if err != nil {
-		return err
+	if c.closed.Load() {
+		return errClosed
+	}
+	if !c.multiplexed() {
+		return c.transport.write(msg.seq, msg.data)
 	}
-	return c.conn.WriteJSON(data)
+	return c.transport.write(msg.seq, Envelope{
+		Channel: msg.channel,
+		Seq:     msg.seq,
+		Payload: msg.data,
+	})
 }
 
-func (c *Connection) close(closeMessage []byte) {
-	c.closed.Store(true)
+func (c *Connection) ping() error {
 	c.lock.Lock()
 	defer c.lock.Unlock()
-
-	if closeMessage != nil {
-		err := c.conn.WriteControl(
-			websocket.CloseMessage,
-			closeMessage,
-			time.Now().Add(5*time.Second),
-		)
-		if err != nil {
-			slog.Error("failed to send close message in websocket connection",
-				slog.String("reason", err.Error()),
-			)
-		}
+	if c.closed.Load() {
+		return errClosed
 	}
+	return c.transport.ping()
+}
 
-	if err := c.conn.Close(); err != nil {
-		slog.Error("failed to close websocket connection",
+// close must be called once, after closed is set.
+func (c *Connection) close(frame *closeFrame) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if err := c.transport.close(frame); err != nil {
+		slog.Error("failed to close connection",
+			slog.String("transport", c.transport.name()),
 			slog.String("reason", err.Error()),
 		)
 	}
+	close(c.done)
 }
 
+// Hub keeps the connections of every user. A user may have several sessions, e.g. on a phone
+// and a laptop, so there are up to MaxSessionsPerUser connections per single channel endpoint and
+// as many multiplexed ones; beyond that a new connection replaces the oldest of its kind.
+// Every connection has a bounded send buffer written by its own goroutine, so the messages
+// of a channel reach the client in the order they were sent to the hub. The same goroutine pings
+// the client, and a websocket that stays silent past the pong timeout is closed.
+// Connections are websockets or, where those are blocked, Server-Sent Events streams of a single channel.
 type Hub struct {
-	lock        sync.RWMutex
-	connections map[int32]*Connection
+	cfg  config.WebSocket
+	lock sync.RWMutex
+	// connections holds the connections of each user, oldest first.
+	connections map[int32][]*Connection
+	channels    map[string]Channel
+	// closed is set by Close; connections registered after it are closed right away.
+	closed bool
+
+	statsLock   sync.Mutex
+	disconnects map[string]int64
+	dropped     int64
 }
 
-func NewHub() *Hub {
+// NewHub returns a hub that uses cfg, as validated by config.Load.
+// The send buffer is raised to leave room for the replay of a resumed subscription.
+func NewHub(cfg config.WebSocket) *Hub {
+	cfg.SendBuffer = max(cfg.SendBuffer, 2*maxReplay)
 	return &Hub{
-		connections: make(map[int32]*Connection),
+		cfg:         cfg,
+		connections: make(map[int32][]*Connection),
+		channels:    make(map[string]Channel),
+		disconnects: make(map[string]int64),
 	}
 }
 
-func (h *Hub) Send(userId int32, data any, timeout time.Duration) {
+// AddChannel makes the channel available to multiplexed connections.
+func (h *Hub) AddChannel(name string, channel Channel) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.channels[name] = channel
+}
+
+// Send queues data on every connection of the user that is subscribed to the channel.
+// seq is the sequence number of the event, or zero if it is not sequenced.
+func (h *Hub) Send(userId int32, channel string, seq int64, data any) {
 	h.lock.RLock()
-	c, ok := h.connections[userId]
+	connections := slices.Clone(h.connections[userId])
 	h.lock.RUnlock()
-	if !ok {
+	for _, c := range connections {
+		if c.subscribed(channel) {
+			h.SendOnConn(c, userId, channel, seq, data)
+		}
+	}
+}
+
+// SendOnConn queues data on the connection.
+func (h *Hub) SendOnConn(c *Connection, userId int32, channel string, seq int64, data any) {
+	if c.closed.Load() {
 		return
 	}
-	h.SendOnConn(c, userId, data, timeout)
+	h.lock.RLock()
+	snapshot := h.channels[channel].Snapshot
+	h.lock.RUnlock()
+
+	msg := outMessage{channel: channel, seq: seq, data: data}
+	c.stateLock.Lock()
+	ok := true
+	if pending, setup := c.pending[channel]; setup {
+		c.pending[channel] = append(pending, msg)
+	} else if seq == 0 || !snapshot || seq > c.lastSeq[channel] {
+		ok = c.enqueue(msg)
+	}
+	c.stateLock.Unlock()
+	if !ok {
+		h.handleFullBuffer(userId, c)
+	}
 }
 
-func (h *Hub) SendOnConn(c *Connection, userId int32, data any, timeout time.Duration) {
-	err := c.write(data, timeout)
-	if err == nil {
+// handleFullBuffer applies the slow consumer policy to a connection whose send buffer is full.
+func (h *Hub) handleFullBuffer(userId int32, c *Connection) {
+	if h.cfg.SlowConsumer == config.SlowConsumerDrop {
+		h.statsLock.Lock()
+		h.dropped++
+		h.statsLock.Unlock()
 		return
 	}
+	h.disconnect(userId, c, DisconnectSlowConsumer, nil, &closeFrame{
+		code: websocket.CloseTryAgainLater,
+		text: "too many pending messages; reconnect with your lastSeq",
+	})
+}
 
-	slog.Error("failed to write to websocket: closing connection",
-		slog.Int("user_id", int(userId)),
-		slog.String("reason", err.Error()),
-	)
+// Register adds a multiplexed connection. It receives nothing until it subscribes to channels.
+// onRequest may be nil.
+func (h *Hub) Register(userId int32, conn *websocket.Conn, onRequest RequestFunc) *Connection {
+	return h.register(userId, h.newConnection(h.newWSTransport(conn), "", onRequest))
+}
+
+// RegisterChannel adds a connection that receives the messages of a single channel without envelopes.
+// What the client sends on it is ignored.
+func (h *Hub) RegisterChannel(userId int32, conn *websocket.Conn, channel string) *Connection {
+	return h.register(userId, h.newConnection(h.newWSTransport(conn), channel, nil))
+}
+
+// RegisterStream adds a connection that writes the messages of a single channel as Server-Sent Events
+// on the response of the request. The handler of the request must not return before the connection is Done.
+func (h *Hub) RegisterStream(userId int32, w http.ResponseWriter, r *http.Request, channel string) (*Connection, error) {
+	t, err := newSSETransport(w, r)
+	if err != nil {
+		return nil, err
+	}
+	return h.register(userId, h.newConnection(t, channel, nil)), nil
+}
 
-	// received error; remove and close the connection
-	h.removeConnection(userId, c, nil)
+func (h *Hub) newWSTransport(conn *websocket.Conn) transport {
+	return newWSTransport(conn, h.cfg.PingInterval+h.cfg.PongTimeout)
 }
 
-func (h *Hub) Register(userId int32, conn *websocket.Conn) *Connection {
-	newConn := &Connection{conn: conn}
+// Open sends the first events of a single channel connection: the events after lastSeq if it is
+// not nil and they can be replayed, or else the initial events of the channel.
+func (h *Hub) Open(userId int32, c *Connection, lastSeq *int64) error {
+	h.lock.RLock()
+	channel := h.channels[c.channel]
+	h.lock.RUnlock()
+	return h.subscribe(userId, c, ClientMessage{Channel: c.channel, LastSeq: lastSeq}, channel)
+}
+
+func (h *Hub) register(userId int32, newConn *Connection) *Connection {
 	h.lock.Lock()
-	old := h.connections[userId]
-	h.connections[userId] = newConn
+	if h.closed {
+		h.lock.Unlock()
+		h.disconnect(userId, newConn, DisconnectShutdown, nil, shutdownFrame)
+		return newConn
+	}
+	var old *Connection
+	connections := h.connections[userId]
+	sameKind := func(c *Connection) bool { return c.channel == newConn.channel }
+	if countFunc(connections, sameKind) >= h.cfg.MaxSessionsPerUser {
+		i := slices.IndexFunc(connections, sameKind)
+		old = connections[i]
+		connections = slices.Delete(connections, i, i+1)
+	}
+	h.connections[userId] = append(connections, newConn)
+	go h.writeMessages(userId, newConn)
 	go h.readMessages(userId, newConn)
+	if newConn.onRequest != nil {
+		go h.handleRequests(userId, newConn)
+	}
 	h.lock.Unlock()
 	if old != nil {
-		old.close(
-			websocket.FormatCloseMessage(
-				websocket.CloseNormalClosure,
-				"received a newer connection from your user id; closing the old one",
-			),
-		)
+		h.disconnect(userId, old, DisconnectReplaced, nil, &closeFrame{
+			code: websocket.CloseNormalClosure,
+			text: "too many sessions of your user id; closing the oldest one",
+		})
 	}
 	return newConn
 }
 
+var shutdownFrame = &closeFrame{code: websocket.CloseGoingAway, text: "server is shutting down; reconnect later"}
+
+// Close closes every connection and every one registered later, so that the handlers
+// that wait for their connections return and the server can shut down.
+func (h *Hub) Close() {
+	type target struct {
+		userId int32
+		c      *Connection
+	}
+	var targets []target
+	h.lock.Lock()
+	h.closed = true
+	for userId, connections := range h.connections {
+		for _, c := range connections {
+			targets = append(targets, target{userId: userId, c: c})
+		}
+	}
+	h.lock.Unlock()
+	for _, t := range targets {
+		h.disconnect(t.userId, t.c, DisconnectShutdown, nil, shutdownFrame)
+	}
+}
+
 func (h *Hub) RemoveConnection(userId int32, c *Connection, err error) {
-	var closeMessage []byte
+	var frame *closeFrame
 	if err != nil {
-		closeMessage = websocket.FormatCloseMessage(
-			websocket.CloseInternalServerErr,
-			err.Error(),
-		)
+		frame = &closeFrame{code: websocket.CloseInternalServerErr, text: err.Error()}
 	}
-	h.removeConnection(userId, c, closeMessage)
+	h.disconnect(userId, c, DisconnectServerError, err, frame)
 }
 
-func (h *Hub) removeConnection(userId int32, c *Connection, closeMessage []byte) {
+// disconnect removes and closes the connection. Only the first call for a connection
+// takes effect; it is logged and counted with its reason.
+func (h *Hub) disconnect(userId int32, c *Connection, reason string, cause error, frame *closeFrame) {
 	h.lock.Lock()
-	n, ok := h.connections[userId]
-	if ok && c == n {
+	connections := slices.DeleteFunc(h.connections[userId], func(n *Connection) bool { return n == c })
+	if len(connections) == 0 {
 		delete(h.connections, userId)
+	} else {
+		h.connections[userId] = connections
 	}
 	h.lock.Unlock()
-	c.close(closeMessage)
+	if !c.closed.CompareAndSwap(false, true) {
+		return
+	}
+
+	h.statsLock.Lock()
+	h.disconnects[reason]++
+	h.statsLock.Unlock()
+	channel := c.channel
+	if c.multiplexed() {
+		channel = "multiplexed"
+	}
+	attrs := []any{
+		slog.Int("user_id", int(userId)),
+		slog.String("channel", channel),
+		slog.String("transport", c.transport.name()),
+		slog.String("reason", reason),
+		slog.Duration("duration", time.Since(c.connectedAt)),
+	}
+	if cause != nil {
+		attrs = append(attrs, slog.String("error", cause.Error()))
+	}
+	slog.Info("client disconnected", attrs...)
+
+	c.close(frame)
+	for _, channel := range c.channels() {
+		h.subscriptionEnded(userId, channel)
+	}
+}
+
+// Subscribed reports whether any connection of the user is subscribed to the channel.
+func (h *Hub) Subscribed(userId int32, channel string) bool {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+	return slices.ContainsFunc(h.connections[userId], func(c *Connection) bool { return c.subscribed(channel) })
+}
+
+func (h *Hub) subscriptionEnded(userId int32, name string) {
+	h.lock.RLock()
+	channel := h.channels[name]
+	h.lock.RUnlock()
+	if channel.Ended != nil {
+		channel.Ended(userId)
+	}
+}
+
+func (h *Hub) writeMessages(userId int32, c *Connection) {
+	ticker := time.NewTicker(h.cfg.PingInterval)
+	defer ticker.Stop()
+	for {
+		var err error
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			err = c.ping()
+		case msg := <-c.queue:
+			err = c.write(msg)
+		}
+		if err != nil {
+			if !errors.Is(err, errClosed) {
+				h.disconnect(userId, c, DisconnectWriteError, err, nil)
+			}
+			return
+		}
+	}
 }
 
 func (h *Hub) readMessages(userId int32, c *Connection) {
-	c.conn.SetReadLimit(1024)
 	for {
-		_, _, err := c.conn.NextReader()
+		r, reason, err := c.transport.next()
 		if err != nil {
-			if websocket.IsUnexpectedCloseError(err,
-				websocket.CloseNormalClosure,
-				websocket.CloseNoStatusReceived,
-				websocket.CloseGoingAway,
-			) {
-				slog.Error("connection read error",
-					slog.Int("user_id", int(userId)),
-					slog.String("error", err.Error()),
-				)
+			// a connection closed by the hub is already counted
+			if !c.closed.Load() {
+				var cause error
+				if reason == DisconnectReadError {
+					cause = err
+				}
+				h.disconnect(userId, c, reason, cause, nil)
 			}
-			h.removeConnection(userId, c, nil)
 			return
 		}
+		if !c.multiplexed() {
+			continue
+		}
+		var msg ClientMessage
+		if err := json.NewDecoder(r).Decode(&msg); err != nil {
+			h.SendOnConn(c, userId, ControlChannel, 0, controlPayload{Error: "invalid message"})
+			continue
+		}
+		if msg.ID != "" {
+			h.queueRequest(userId, c, msg)
+			continue
+		}
+		h.handleClientMessage(userId, c, msg)
+	}
+}
+
+type errorResponse struct {
+	ID    string `json:"id"`
+	OK    bool   `json:"ok"`
+	Error string `json:"error"`
+}
+
+// queueRequest hands a request to the goroutine handling the requests of the connection,
+// so that a slow request does not hold up reading pongs and other messages.
+func (h *Hub) queueRequest(userId int32, c *Connection, msg ClientMessage) {
+	if c.onRequest == nil {
+		h.SendOnConn(c, userId, RPCChannel, 0, errorResponse{ID: msg.ID, Error: "requests are not supported on this connection"})
+		return
+	}
+	select {
+	case c.requests <- Request{ID: msg.ID, Action: msg.Action, Params: msg.Params}:
+	default:
+		h.SendOnConn(c, userId, RPCChannel, 0, errorResponse{ID: msg.ID, Error: "too many pending requests"})
+	}
+}
+
+func (h *Hub) handleRequests(userId int32, c *Connection) {
+	for {
+		select {
+		case <-c.done:
+			return
+		case req := <-c.requests:
+			h.SendOnConn(c, userId, RPCChannel, 0, c.onRequest(userId, req))
+		}
+	}
+}
+
+func (h *Hub) handleClientMessage(userId int32, c *Connection, msg ClientMessage) {
+	reply := controlPayload{Action: msg.Action, Channel: msg.Channel}
+	h.lock.RLock()
+	channel, ok := h.channels[msg.Channel]
+	h.lock.RUnlock()
+	if !ok {
+		reply.Error = "unknown channel"
+		h.SendOnConn(c, userId, ControlChannel, 0, reply)
+		return
+	}
+	switch msg.Action {
+	case ActionSubscribe:
+		if c.subscribed(msg.Channel) {
+			h.SendOnConn(c, userId, ControlChannel, 0, reply)
+			return
+		}
+		if err := h.subscribe(userId, c, msg, channel); err != nil {
+			slog.Error("failed to handle subscription",
+				slog.Int("user_id", int(userId)),
+				slog.String("channel", msg.Channel),
+				slog.String("error", err.Error()),
+			)
+			c.unsubscribe(msg.Channel)
+			h.subscriptionEnded(userId, msg.Channel)
+			reply.Action = ActionUnsubscribe
+			reply.Error = "failed to subscribe"
+			h.SendOnConn(c, userId, ControlChannel, 0, reply)
+		}
+	case ActionUnsubscribe:
+		c.unsubscribe(msg.Channel)
+		h.subscriptionEnded(userId, msg.Channel)
+		h.SendOnConn(c, userId, ControlChannel, 0, reply)
+	default:
+		reply.Error = "unknown action"
+		h.SendOnConn(c, userId, ControlChannel, 0, reply)
+	}
+}
+
+// subscribe starts a subscription with the missed events or the initial events of the channel.
+// Live events of the channel sent meanwhile are held back and queued after them, except the ones
+// that are already covered.
+func (h *Hub) subscribe(userId int32, c *Connection, msg ClientMessage, channel Channel) error {
+	c.stateLock.Lock()
+	c.subscriptions[msg.Channel] = true
+	c.pending[msg.Channel] = []outMessage{}
+	c.stateLock.Unlock()
+
+	var events []Event
+	resumed := false
+	if msg.LastSeq != nil && channel.Replay != nil {
+		var err error
+		events, resumed, err = channel.Replay(userId, *msg.LastSeq, maxReplay)
+		if err != nil {
+			return err
+		}
+	}
+	if !resumed && channel.Initial != nil {
+		var err error
+		events, err = channel.Initial(userId)
+		if err != nil {
+			return err
+		}
+	}
+
+	c.stateLock.Lock()
+	var messages []outMessage
+	if c.multiplexed() {
+		messages = append(messages, outMessage{
+			channel: ControlChannel,
+			data:    controlPayload{Action: ActionSubscribe, Channel: msg.Channel, Resumed: resumed},
+		})
+	}
+	for _, e := range events {
+		messages = append(messages, outMessage{channel: msg.Channel, seq: e.Seq, data: e.Payload})
+	}
+	last := int64(0)
+	if len(events) > 0 {
+		last = events[len(events)-1].Seq
+	}
+	if resumed {
+		last = max(last, *msg.LastSeq)
+		c.lastSeq[msg.Channel] = last
+	}
+	for _, p := range c.pending[msg.Channel] {
+		if p.seq == 0 || p.seq > last {
+			messages = append(messages, p)
+		}
+	}
+	delete(c.pending, msg.Channel)
+	ok := true
+	for _, m := range messages {
+		if ok = c.enqueue(m); !ok {
+			break
+		}
+	}
+	c.stateLock.Unlock()
+	if !ok {
+		h.handleFullBuffer(userId, c)
+	}
+	return nil
+}
+
+// Broadcast calls callback for every connection subscribed to the channel.
+func (h *Hub) Broadcast(channel string, callback func(userId int32, c *Connection)) {
+	type target struct {
+		userId int32
+		c      *Connection
+	}
+	var targets []target
+	h.lock.RLock()
+	for userId, connections := range h.connections {
+		for _, c := range connections {
+			if c.subscribed(channel) {
+				targets = append(targets, target{userId: userId, c: c})
+			}
+		}
+	}
+	h.lock.RUnlock()
+	for _, t := range targets {
+		callback(t.userId, t.c)
 	}
 }
 
-func (h *Hub) Broadcast(callback func(userId int32, c *Connection)) {
+// Sessions returns the number of connections of every connected user.
+func (h *Hub) Sessions() map[int32]int {
 	h.lock.RLock()
 	defer h.lock.RUnlock()
-	for userId, conn := range h.connections {
-		callback(userId, conn)
+	result := make(map[int32]int, len(h.connections))
+	for userId, connections := range h.connections {
+		result[userId] = len(connections)
 	}
+	return result
 }
 
-func (h *Hub) Actives() int {
+// Actives returns the number of users with a connection subscribed to the channel.
+func (h *Hub) Actives(channel string) int {
 	h.lock.RLock()
 	defer h.lock.RUnlock()
-	return len(h.connections)
+	count := 0
+	for _, connections := range h.connections {
+		if slices.ContainsFunc(connections, func(c *Connection) bool { return c.subscribed(channel) }) {
+			count++
+		}
+	}
+	return count
+}
+
+// Disconnects returns the number of disconnects by their reason since the hub started.
+func (h *Hub) Disconnects() map[string]int64 {
+	h.statsLock.Lock()
+	defer h.statsLock.Unlock()
+	return maps.Clone(h.disconnects)
+}
+
+// DroppedMessages returns the number of messages dropped because a send buffer was full.
+func (h *Hub) DroppedMessages() int64 {
+	h.statsLock.Lock()
+	defer h.statsLock.Unlock()
+	return h.dropped
+}
+
+// Connections returns the number of open connections.
+func (h *Hub) Connections() int {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+	count := 0
+	for _, connections := range h.connections {
+		count += len(connections)
+	}
+	return count
+}
+
+func countFunc[T any](s []T, f func(T) bool) int {
+	count := 0
+	for _, v := range s {
+		if f(v) {
+			count++
+		}
+	}
+	return count
 }
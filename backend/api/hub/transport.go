@@ -0,0 +1,190 @@
+package hub
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gorilla/websocket"
+	"io"
+	"net"
+	"net/http"
+	"time"
+)
+
+const (
+	TransportWebSocket = "websocket"
+	TransportSSE       = "sse"
+)
+
+// closeFrame is what a connection tells its client before it is closed by the hub.
+type closeFrame struct {
+	code int
+	text string
+}
+
+// transport carries the messages of a connection. The connection serializes the calls
+// to write, ping and close.
+type transport interface {
+	name() string
+	write(seq int64, v any) error
+	ping() error
+	// close closes the connection, after writing frame if it is not nil.
+	close(frame *closeFrame) error
+	// next blocks until the next message of the client. On an error,
+	// reason is the reason of the disconnect.
+	next() (r io.Reader, reason string, err error)
+}
+
+type wsTransport struct {
+	conn        *websocket.Conn
+	idleTimeout time.Duration
+}
+
+// newWSTransport makes a websocket transport. Every message, including pongs, proves the connection
+// alive for idleTimeout, until the next ping is due.
+func newWSTransport(conn *websocket.Conn, idleTimeout time.Duration) *wsTransport {
+	t := &wsTransport{conn: conn, idleTimeout: idleTimeout}
+	conn.SetReadLimit(8 << 10)
+	_ = t.extendDeadline("")
+	conn.SetPongHandler(t.extendDeadline)
+	return t
+}
+
+func (t *wsTransport) extendDeadline(string) error {
+	return t.conn.SetReadDeadline(time.Now().Add(t.idleTimeout))
+}
+
+func (t *wsTransport) name() string {
+	return TransportWebSocket
+}
+
+func (t *wsTransport) write(_ int64, v any) error {
+	if err := t.conn.SetWriteDeadline(time.Now().Add(writeTimeout)); err != nil {
+		return err
+	}
+	return t.conn.WriteJSON(v)
+}
+
+func (t *wsTransport) ping() error {
+	return t.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeTimeout))
+}
+
+func (t *wsTransport) close(frame *closeFrame) error {
+	var err error
+	if frame != nil {
+		err = t.conn.WriteControl(
+			websocket.CloseMessage,
+			websocket.FormatCloseMessage(frame.code, frame.text),
+			time.Now().Add(5*time.Second),
+		)
+		if err != nil {
+			err = fmt.Errorf("send close message: %w", err)
+		}
+	}
+	return errors.Join(err, t.conn.Close())
+}
+
+func (t *wsTransport) next() (io.Reader, string, error) {
+	_, r, err := t.conn.NextReader()
+	if err != nil {
+		var netErr net.Error
+		switch {
+		case websocket.IsCloseError(err,
+			websocket.CloseNormalClosure,
+			websocket.CloseNoStatusReceived,
+			websocket.CloseGoingAway,
+		):
+			return nil, DisconnectClientClosed, err
+		case errors.As(err, &netErr) && netErr.Timeout():
+			return nil, DisconnectIdle, err
+		default:
+			return nil, DisconnectReadError, err
+		}
+	}
+	_ = t.extendDeadline("")
+	return r, "", nil
+}
+
+// sseTransport writes Server-Sent Events on the response of a request. The id of an event is
+// its seq, so EventSource sends the last one as Last-Event-ID when it reconnects. Unsequenced
+// events have no id. The client sends nothing; the connection ends with the request.
+type sseTransport struct {
+	ctx        context.Context
+	w          http.ResponseWriter
+	controller *http.ResponseController
+	closed     chan struct{}
+}
+
+func newSSETransport(w http.ResponseWriter, r *http.Request) (*sseTransport, error) {
+	t := &sseTransport{
+		ctx:        r.Context(),
+		w:          w,
+		controller: http.NewResponseController(w),
+		closed:     make(chan struct{}),
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if err := t.controller.Flush(); err != nil {
+		return nil, fmt.Errorf("flush event stream: %w", err)
+	}
+	return t, nil
+}
+
+func (t *sseTransport) name() string {
+	return TransportSSE
+}
+
+func (t *sseTransport) send(message string) error {
+	err := t.controller.SetWriteDeadline(time.Now().Add(writeTimeout))
+	if err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return err
+	}
+	if _, err := io.WriteString(t.w, message); err != nil {
+		return err
+	}
+	return t.controller.Flush()
+}
+
+func (t *sseTransport) write(seq int64, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	message := fmt.Sprintf("data: %s\n\n", data)
+	if seq != 0 {
+		message = fmt.Sprintf("id: %d\n", seq) + message
+	}
+	return t.send(message)
+}
+
+func (t *sseTransport) ping() error {
+	return t.send(": ping\n\n")
+}
+
+// close writes frame as a close event. The request is finished by its handler once the connection is done.
+func (t *sseTransport) close(frame *closeFrame) error {
+	defer close(t.closed)
+	if frame == nil {
+		return nil
+	}
+	data, err := json.Marshal(struct {
+		Code   int    `json:"code"`
+		Reason string `json:"reason"`
+	}{Code: frame.code, Reason: frame.text})
+	if err != nil {
+		return err
+	}
+	return t.send(fmt.Sprintf("event: close\ndata: %s\n\n", data))
+}
+
+func (t *sseTransport) next() (io.Reader, string, error) {
+	select {
+	case <-t.ctx.Done():
+		return nil, DisconnectClientClosed, t.ctx.Err()
+	case <-t.closed:
+		return nil, "", errClosed
+	}
+}
@@ -0,0 +1,415 @@
+// Command bermudia-admin runs admin operations directly against the configured database.
+// It reads the same BERMUDIA__ environment variables as the server.
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/Rastaiha/bermudia/internal/config"
+	"github.com/Rastaiha/bermudia/internal/domain"
+	"github.com/Rastaiha/bermudia/internal/eventbus"
+	"github.com/Rastaiha/bermudia/internal/mock"
+	"github.com/Rastaiha/bermudia/internal/repository"
+	"github.com/Rastaiha/bermudia/internal/service"
+	"io"
+	"log"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const usage = `Usage: bermudia-admin <command> [arguments]
+
+Commands:
+  load [-default-password p] [-write-back dir] [-dry-run] [-force] <content dir>
+        apply the content directory (the one containing data/) in one transaction;
+        with -dry-run nothing is applied and the difference to the stored content is printed.
+        Questions that have answers are only deleted or rebound with -force.
+  validate [-default-password p] [-force] <content dir>
+        check the content directory against the database like load -dry-run does,
+        without printing the changes
+  create-users [-default-password p] <users.csv>
+        create users from a csv file with a header row; known columns are
+        username, name, password, startingTerritory, meetLink and role.
+        The created users are written to stdout with their passwords.
+  pause
+  resume
+  grant <username> <item>=<amount>...
+        give items (fuel, coin, blueKey, redKey, goldenKey, masterKey) to a player
+  export [-o file]
+        write territories, bindings and players as json
+  versions
+        list the stored content versions
+  rollback [-force] <version>
+        apply the content of a stored version
+  export-content <dir>
+        write the stored content to dir in the layout load accepts;
+        users.json is left empty because passwords can not be exported
+  inspect <username>
+        print the user, player and knowledge bars as json
+`
+
+type app struct {
+	cfg       config.Config
+	admin     *service.Admin
+	gameState domain.GameStateStore
+}
+
+func main() {
+	log.SetFlags(0)
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	command, args := os.Args[1], os.Args[2:]
+	if command == "help" || command == "-h" || command == "--help" {
+		fmt.Print(usage)
+		return
+	}
+
+	a, err := newApp(config.Load())
+	if err != nil {
+		log.Fatal(err)
+	}
+	ctx := context.Background()
+	switch command {
+	case "load":
+		err = a.load(args)
+	case "validate":
+		err = a.validate(args)
+	case "create-users":
+		err = a.createUsers(ctx, args)
+	case "pause":
+		err = a.gameState.SetIsPaused(ctx, true)
+	case "resume":
+		err = a.gameState.SetIsPaused(ctx, false)
+	case "grant":
+		err = a.grant(ctx, args)
+	case "export":
+		err = a.export(ctx, args)
+	case "export-content":
+		err = a.exportContent(args)
+	case "versions":
+		err = a.versions(ctx)
+	case "rollback":
+		err = a.rollback(ctx, args)
+	case "inspect":
+		err = a.inspect(ctx, args)
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func newApp(cfg config.Config) (*app, error) {
+	if !cfg.Postgres.Enable {
+		// the sqlite database is recreated on every server start, so there is nothing to administrate
+		return nil, errors.New("bermudia-admin needs postgres; set BERMUDIA__POSTGRES__ENABLE=true")
+	}
+	db, err := repository.ConnectToPostgres(cfg.Postgres)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to postgres: %w", err)
+	}
+	admin, err := newAdminService(cfg, db)
+	if err != nil {
+		return nil, err
+	}
+	gameState, err := repository.NewSqlGameStateRepository(db)
+	if err != nil {
+		return nil, err
+	}
+	return &app{cfg: cfg, admin: admin, gameState: gameState}, nil
+}
+
+func newAdminService(cfg config.Config, db *sql.DB) (*service.Admin, error) {
+	territoryRepo, err := repository.NewSqlTerritoryRepository(db)
+	if err != nil {
+		return nil, err
+	}
+	islandRepo, err := repository.NewSqlIslandRepository(db)
+	if err != nil {
+		return nil, err
+	}
+	userRepo, err := repository.NewSqlUser(db)
+	if err != nil {
+		return nil, err
+	}
+	playerRepo, err := repository.NewSqlPlayerRepository(db)
+	if err != nil {
+		return nil, err
+	}
+	questionStore, err := repository.NewSqlQuestionRepository(db)
+	if err != nil {
+		return nil, err
+	}
+	treasureRepo, err := repository.NewSqlTreasureRepository(db)
+	if err != nil {
+		return nil, err
+	}
+	feedbackTemplateRepo, err := repository.NewSqlFeedbackTemplateRepository(db)
+	if err != nil {
+		return nil, err
+	}
+	contentVersionRepo, err := repository.NewSqlContentVersionRepository(db)
+	if err != nil {
+		return nil, err
+	}
+	marketRepo, err := repository.NewSqlMarketRepository(db)
+	if err != nil {
+		return nil, err
+	}
+	inboxRepo, err := repository.NewSqlInboxRepository(db)
+	if err != nil {
+		return nil, err
+	}
+	investRepo, err := repository.NewSqlInvestRepository(db)
+	if err != nil {
+		return nil, err
+	}
+	outboxRepo, err := repository.NewSqlOutboxRepository(db)
+	if err != nil {
+		return nil, err
+	}
+	// the bus is only published to, so the cache invalidations of the changes made here reach the running server.
+	var eventBus domain.EventBus = eventbus.NewMemory()
+	if cfg.EventBus == config.EventBusPostgres {
+		eventBus, err = eventbus.NewPostgres(db)
+		if err != nil {
+			return nil, err
+		}
+	}
+	// the outbox is not started here; the player updates it stores are dispatched by the running server.
+	outbox := service.NewOutbox(outboxRepo)
+	uow := service.NewUnitOfWork(repository.NewSqlGameTransactor(db), outbox)
+	playerService := service.NewPlayer(cfg, uow, eventBus, outbox, userRepo, playerRepo, territoryRepo, questionStore, islandRepo, treasureRepo, marketRepo, inboxRepo, investRepo)
+	return service.NewAdmin(cfg, territoryRepo, islandRepo, userRepo, playerRepo, questionStore, treasureRepo, feedbackTemplateRepo, contentVersionRepo, repository.NewSqlContentTransactor(db), playerService), nil
+}
+
+// validate runs the dry run of load, which makes every check that applying the content makes.
+func (a *app) validate(args []string) error {
+	fs := flag.NewFlagSet("validate", flag.ExitOnError)
+	defaultPassword := fs.String("default-password", "", "password of users that have none in users.json")
+	force := fs.Bool("force", false, "allow deleting or rebinding questions that have answers")
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 {
+		return errors.New("usage: bermudia-admin validate [-default-password p] [-force] <content dir>")
+	}
+	if _, err := mock.PreviewGameContent(a.admin, os.DirFS(fs.Arg(0)), *defaultPassword, *force); err != nil {
+		return fmt.Errorf("content is invalid:\n%w", err)
+	}
+	fmt.Println("content is valid")
+	return nil
+}
+
+func (a *app) load(args []string) error {
+	fs := flag.NewFlagSet("load", flag.ExitOnError)
+	defaultPassword := fs.String("default-password", "", "password of users that have none in users.json")
+	writeBack := fs.String("write-back", "", "directory to write the content with generated ids to")
+	dryRun := fs.Bool("dry-run", false, "check the content against the database and print the changes without applying them")
+	force := fs.Bool("force", false, "allow deleting or rebinding questions that have answers")
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 {
+		return errors.New("usage: bermudia-admin load [-default-password p] [-write-back dir] [-dry-run] [-force] <content dir>")
+	}
+	files := os.DirFS(fs.Arg(0))
+	if *dryRun {
+		diff, err := mock.PreviewGameContent(a.admin, files, *defaultPassword, *force)
+		if err != nil {
+			return fmt.Errorf("content is invalid:\n%w", err)
+		}
+		return printJSON(os.Stdout, diff)
+	}
+	if err := mock.SetGameContent(a.admin, files, *writeBack, *defaultPassword, author(), *force); err != nil {
+		return fmt.Errorf("failed to set game content: %w", err)
+	}
+	fmt.Println("content applied")
+	return nil
+}
+
+func (a *app) createUsers(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("create-users", flag.ExitOnError)
+	defaultPassword := fs.String("default-password", "", "password of users that have none in the csv; random if empty")
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 {
+		return errors.New("usage: bermudia-admin create-users [-default-password p] <users.csv>")
+	}
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	users, err := readUsersCSV(f)
+	if err != nil {
+		return err
+	}
+
+	out := csv.NewWriter(os.Stdout)
+	_ = out.Write([]string{"username", "password", "startingTerritory", "role"})
+	var errs []error
+	for i, u := range users {
+		if u.Password == "" {
+			u.Password = *defaultPassword
+		}
+		created, err := a.admin.CreateUser(ctx, i, u)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("user %q: %w", u.Username, err))
+			continue
+		}
+		_ = out.Write([]string{created.Username, created.Password, created.StartingTerritory, created.Role})
+	}
+	out.Flush()
+	return errors.Join(append(errs, out.Error())...)
+}
+
+func readUsersCSV(r io.Reader) ([]service.User, error) {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, errors.New("empty csv file")
+	}
+	columns := make(map[string]int)
+	for i, name := range records[0] {
+		columns[strings.TrimSpace(name)] = i
+	}
+	if _, ok := columns["username"]; !ok {
+		return nil, errors.New("csv file has no username column")
+	}
+	get := func(record []string, name string) string {
+		i, ok := columns[name]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+	users := make([]service.User, 0, len(records)-1)
+	for _, record := range records[1:] {
+		users = append(users, service.User{
+			Username:          get(record, "username"),
+			Name:              get(record, "name"),
+			Password:          get(record, "password"),
+			StartingTerritory: get(record, "startingTerritory"),
+			MeetLink:          get(record, "meetLink"),
+			Role:              get(record, "role"),
+		})
+	}
+	return users, nil
+}
+
+func (a *app) grant(ctx context.Context, args []string) error {
+	if len(args) < 2 {
+		return errors.New("usage: bermudia-admin grant <username> <item>=<amount>...")
+	}
+	var grant domain.Cost
+	for _, arg := range args[1:] {
+		item, amountStr, ok := strings.Cut(arg, "=")
+		if !ok {
+			return fmt.Errorf("bad item %q; expected <item>=<amount>", arg)
+		}
+		amount, err := strconv.ParseInt(amountStr, 10, 32)
+		if err != nil {
+			return fmt.Errorf("bad amount in %q: %w", arg, err)
+		}
+		grant.Items = append(grant.Items, domain.CostItem{Type: item, Amount: int32(amount)})
+	}
+	player, err := a.admin.GrantResources(ctx, args[0], grant)
+	if err != nil {
+		return err
+	}
+	return printJSON(os.Stdout, player)
+}
+
+func (a *app) export(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	output := fs.String("o", "", "output file; stdout if empty")
+	_ = fs.Parse(args)
+	state, err := a.admin.ExportState(ctx)
+	if err != nil {
+		return err
+	}
+	if *output == "" {
+		return printJSON(os.Stdout, state)
+	}
+	f, err := os.Create(*output)
+	if err != nil {
+		return err
+	}
+	return errors.Join(printJSON(f, state), f.Close())
+}
+
+func (a *app) versions(ctx context.Context) error {
+	versions, err := a.admin.ListContentVersions(ctx)
+	if err != nil {
+		return err
+	}
+	for _, v := range versions {
+		fmt.Printf("%d\t%s\t%s\t%s\n", v.Version, v.CreatedAt.Format(time.DateTime), v.Checksum, v.Author)
+	}
+	return nil
+}
+
+func (a *app) rollback(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("rollback", flag.ExitOnError)
+	force := fs.Bool("force", false, "allow deleting or rebinding questions that have answers")
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 {
+		return errors.New("usage: bermudia-admin rollback [-force] <version>")
+	}
+	version, err := strconv.ParseInt(fs.Arg(0), 10, 32)
+	if err != nil {
+		return fmt.Errorf("bad version %q: %w", fs.Arg(0), err)
+	}
+	result, err := a.admin.RollbackContent(ctx, int32(version), author(), *force)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("content rolled back to version %d; saved as version %d\n", version, result.Version)
+	return nil
+}
+
+// author names who runs the command in content versions.
+func author() string {
+	if u, err := user.Current(); err == nil {
+		return "cli:" + u.Username
+	}
+	return "cli"
+}
+
+func (a *app) exportContent(args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: bermudia-admin export-content <dir>")
+	}
+	if err := mock.ExportGameContent(a.admin, args[0]); err != nil {
+		return err
+	}
+	fmt.Println("content written to", args[0])
+	return nil
+}
+
+func (a *app) inspect(ctx context.Context, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: bermudia-admin inspect <username>")
+	}
+	inspection, err := a.admin.InspectPlayer(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	return printJSON(os.Stdout, inspection)
+}
+
+func printJSON(w io.Writer, v any) error {
+	e := json.NewEncoder(w)
+	e.SetIndent("", "  ")
+	return e.Encode(v)
+}
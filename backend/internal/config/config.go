@@ -2,6 +2,7 @@ package config
 
 import (
 	"encoding/base64"
+	"fmt"
 	"time"
 )
 
@@ -11,6 +12,15 @@ type Config struct {
 	TokenSigningKey        string        `config:"token_signing_key"`
 	MockUsersPassword      string        `config:"mock_users_password"`
 	BotToken               string        `config:"bot_token"`
+	BotServerURL           string        `config:"bot_server_url"`
+	CorrectionChannel      string        `config:"correction_channel"`
+	WebhookURL             string        `config:"webhook_url"`
+	WebhookSecret          string        `config:"webhook_secret"`
+	WebQueueToken          string        `config:"web_queue_token"`
+	FileStore              string        `config:"file_store"`
+	UploadDir              string        `config:"upload_dir"`
+	MaxAnswerFileSize      int64         `config:"max_answer_file_size"`
+	S3                     S3            `config:"s3"`
 	MinCorrectionDelay     time.Duration `config:"min_correction_delay"`
 	CorrectionJobInterval  time.Duration `config:"correction_job_interval"`
 	DefaultCorrectionGroup int64         `config:"default_correction_group"`
@@ -20,8 +30,34 @@ type Config struct {
 	CorrectionRevertWindow time.Duration `config:"correction_revert_window"`
 	CreateMock             bool          `config:"create_mock"`
 	AdminsGroup            int64         `config:"admins_group"`
+	CorrectionClaimTimeout time.Duration `config:"correction_claim_timeout"`
+	ClaimReleaseInterval   time.Duration `config:"claim_release_interval"`
+	ReminderThreshold      time.Duration `config:"reminder_threshold"`
+	ReminderJobInterval    time.Duration `config:"reminder_job_interval"`
+	PendingBacklogLimit    int           `config:"pending_backlog_limit"`
+	EscalationInterval     time.Duration `config:"escalation_interval"`
+	SecondGrading          bool          `config:"second_grading"`
+	WebSocket              WebSocket     `config:"websocket"`
+	EventBus               string        `config:"event_bus"`
 }
 
+const (
+	CorrectionChannelBot     = "bot"
+	CorrectionChannelWebhook = "webhook"
+	CorrectionChannelWeb     = "web"
+	CorrectionChannelLog     = "log"
+)
+
+const (
+	FileStoreLocal = "local"
+	FileStoreS3    = "s3"
+)
+
+const (
+	EventBusMemory   = "memory"
+	EventBusPostgres = "postgres"
+)
+
 func (c Config) TokenSigningKeyBytes() []byte {
 	b, err := base64.StdEncoding.DecodeString(c.TokenSigningKey)
 	if err != nil {
@@ -40,12 +76,82 @@ type Postgres struct {
 	SSLMode string `config:"ssl_mode"`
 }
 
+type WebSocket struct {
+	MaxSessionsPerUser int `config:"max_sessions_per_user"`
+	// PingInterval is how often connections are pinged; one that sends nothing, not even
+	// a pong, for PingInterval plus PongTimeout is closed.
+	PingInterval time.Duration `config:"ping_interval"`
+	PongTimeout  time.Duration `config:"pong_timeout"`
+	// SendBuffer is the number of messages a connection may have waiting to be written.
+	SendBuffer int `config:"send_buffer"`
+	// SlowConsumer is what happens when the send buffer of a connection is full.
+	SlowConsumer string `config:"slow_consumer"`
+}
+
+const (
+	// SlowConsumerEvict closes the connection; the client reconnects with its lastSeq.
+	SlowConsumerEvict = "evict"
+	// SlowConsumerDrop drops the message.
+	SlowConsumerDrop = "drop"
+)
+
+// minKeepaliveDuration is the least ping interval and pong timeout.
+const minKeepaliveDuration = time.Second
+
+func (w WebSocket) validate() error {
+	if w.MaxSessionsPerUser < 1 {
+		return fmt.Errorf("max_sessions_per_user must be at least 1, got %d", w.MaxSessionsPerUser)
+	}
+	if w.PingInterval < minKeepaliveDuration {
+		return fmt.Errorf("ping_interval must be at least %s, got %s", minKeepaliveDuration, w.PingInterval)
+	}
+	if w.PongTimeout < minKeepaliveDuration {
+		return fmt.Errorf("pong_timeout must be at least %s, got %s", minKeepaliveDuration, w.PongTimeout)
+	}
+	switch w.SlowConsumer {
+	case SlowConsumerEvict, SlowConsumerDrop:
+	default:
+		return fmt.Errorf("unknown slow_consumer policy %q", w.SlowConsumer)
+	}
+	return nil
+}
+
+type S3 struct {
+	Endpoint  string `config:"endpoint"`
+	Region    string `config:"region"`
+	Bucket    string `config:"bucket"`
+	AccessKey string `config:"access_key"`
+	SecretKey string `config:"secret_key"`
+}
+
 func defaultConfig() *Config {
 	return &Config{
 		Postgres: Postgres{
 			SSLMode: "disable",
 		},
-		MinCorrectionDelay:    10 * time.Second,
-		CorrectionJobInterval: 10 * time.Second,
+		BotServerURL:      "https://tapi.bale.ai",
+		CorrectionChannel: CorrectionChannelBot,
+		FileStore:         FileStoreLocal,
+		UploadDir:         "uploads",
+		MaxAnswerFileSize: 10 << 20,
+		S3: S3{
+			Region: "us-east-1",
+		},
+		MinCorrectionDelay:     10 * time.Second,
+		CorrectionJobInterval:  10 * time.Second,
+		CorrectionClaimTimeout: 30 * time.Minute,
+		ClaimReleaseInterval:   time.Minute,
+		ReminderThreshold:      20 * time.Minute,
+		ReminderJobInterval:    5 * time.Minute,
+		PendingBacklogLimit:    30,
+		EscalationInterval:     20 * time.Minute,
+		EventBus:               EventBusMemory,
+		WebSocket: WebSocket{
+			MaxSessionsPerUser: 5,
+			PingInterval:       25 * time.Second,
+			PongTimeout:        10 * time.Second,
+			SendBuffer:         256,
+			SlowConsumer:       SlowConsumerEvict,
+		},
 	}
 }
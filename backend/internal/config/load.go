@@ -30,7 +30,7 @@ func Load() Config {
 	{
 		err := k.Load(env.Provider(prefix, delimiter, envCallBack), nil)
 		if err != nil {
-			slog.Error("could not load env variables for config: %v\n", err)
+			slog.Error("could not load env variables for config", slog.String("error", err.Error()))
 		}
 	}
 
@@ -43,6 +43,10 @@ func Load() Config {
 		log.Fatalf("could not unmarshal config: %v\n", err)
 	}
 
+	if err := instance.WebSocket.validate(); err != nil {
+		log.Fatalf("invalid websocket config: %v\n", err)
+	}
+
 	instance.CorrectionGroups = make(map[string]int64)
 	for _, s := range strings.Split(instance.CorrectionGroupsStr, ",") {
 		var chatId int64
@@ -0,0 +1,24 @@
+package domain
+
+import "time"
+
+// ContentVersion is a snapshot of the game content taken after an upload or a rollback.
+type ContentVersion struct {
+	Version   int32     `json:"version"`
+	Author    string    `json:"author"`
+	CreatedAt time.Time `json:"createdAt"`
+	// Checksum is the hex encoded sha256 of Content.
+	Checksum string `json:"checksum"`
+	Content  []byte `json:"-"`
+}
+
+var (
+	ErrContentVersionNotFound = Error{
+		text:   "content version not found",
+		reason: ErrorReasonResourceNotFound,
+	}
+	ErrAnsweredQuestionChange = Error{
+		text:   "content deletes or rebinds questions that have answers",
+		reason: ErrorReasonRuleViolation,
+	}
+)
@@ -0,0 +1,87 @@
+package domain
+
+import (
+	"cmp"
+	"slices"
+	"time"
+)
+
+// CorrectionRecord is a finalized correction as used for corrector statistics.
+type CorrectionRecord struct {
+	Corrector   Corrector
+	NewStatus   AnswerStatus
+	SubmittedAt time.Time
+	FinalizedAt time.Time
+}
+
+type CorrectorStats struct {
+	Corrector      Corrector
+	Count          int
+	MedianDuration time.Duration
+	StatusCounts   map[AnswerStatus]int
+}
+
+// GetCorrectorStats aggregates the records per corrector, most active correctors first.
+// Records without a submission time are counted but not used for the median duration.
+func GetCorrectorStats(records []CorrectionRecord) []CorrectorStats {
+	byCorrector := make(map[int64]*CorrectorStats)
+	durations := make(map[int64][]time.Duration)
+	for _, r := range records {
+		stats, ok := byCorrector[r.Corrector.ID]
+		if !ok {
+			stats = &CorrectorStats{Corrector: r.Corrector, StatusCounts: make(map[AnswerStatus]int)}
+			byCorrector[r.Corrector.ID] = stats
+		}
+		stats.Count++
+		stats.StatusCounts[r.NewStatus]++
+		if !r.SubmittedAt.IsZero() && !r.FinalizedAt.IsZero() {
+			durations[r.Corrector.ID] = append(durations[r.Corrector.ID], r.FinalizedAt.Sub(r.SubmittedAt))
+		}
+	}
+	result := make([]CorrectorStats, 0, len(byCorrector))
+	for id, stats := range byCorrector {
+		stats.MedianDuration = median(durations[id])
+		result = append(result, *stats)
+	}
+	slices.SortFunc(result, func(a, b CorrectorStats) int {
+		if a.Count != b.Count {
+			return b.Count - a.Count
+		}
+		return cmp.Compare(a.Corrector.ID, b.Corrector.ID)
+	})
+	return result
+}
+
+func median(durations []time.Duration) time.Duration {
+	if len(durations) == 0 {
+		return 0
+	}
+	slices.Sort(durations)
+	mid := len(durations) / 2
+	if len(durations)%2 == 1 {
+		return durations[mid]
+	}
+	return (durations[mid-1] + durations[mid]) / 2
+}
+
+// QueuedAnswer is a pending answer waiting to be corrected.
+type QueuedAnswer struct {
+	Answer    Answer
+	Username  string
+	Question  BookQuestion
+	Territory string
+	Pool      string
+	Claim     *AnswerClaim
+}
+
+type CorrectionQueueFilter struct {
+	Territory  string
+	Pool       string
+	QuestionID string
+}
+
+func (f CorrectionQueueFilter) Matches(a QueuedAnswer) bool {
+	return (f.Territory == "" || f.Territory == a.Territory) &&
+		(f.Pool == "" || f.Pool == a.Pool) &&
+		(f.QuestionID == "" || f.QuestionID == a.Question.QuestionID)
+}
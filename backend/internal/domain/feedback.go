@@ -0,0 +1,27 @@
+package domain
+
+import "time"
+
+// FeedbackTemplate is a reusable feedback text offered to correctors.
+// It belongs to either a question or a territory.
+type FeedbackTemplate struct {
+	ID          string
+	QuestionID  string
+	TerritoryID string
+	Text        string
+	FromContent bool
+	UsageCount  int
+	CreatedBy   Corrector
+	CreatedAt   time.Time
+}
+
+// AppliesTo reports whether the template can be used as feedback of an answer to the question,
+// whose island is in the territory.
+func (t FeedbackTemplate) AppliesTo(questionId string, territoryId string) bool {
+	return (t.QuestionID != "" && t.QuestionID == questionId) || (t.TerritoryID != "" && t.TerritoryID == territoryId)
+}
+
+var ErrFeedbackTemplateNotApplicable = Error{
+	text:   "این قالب بازخورد برای این سؤال نیست.",
+	reason: ErrorReasonRuleViolation,
+}
@@ -0,0 +1,232 @@
+package domain
+
+import (
+	"fmt"
+	"mime"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// StoredFile is the metadata of an uploaded file whose content is kept in a FileStore.
+type StoredFile struct {
+	ID        string
+	OwnerID   int32
+	Filename  string
+	MimeType  string
+	Size      int64
+	SHA256    string
+	CreatedAt time.Time
+}
+
+var (
+	ErrFileNotFound = Error{
+		text:   "file not found",
+		reason: ErrorReasonResourceNotFound,
+	}
+)
+
+const MimeTypeExecutable = "application/x-executable"
+
+// FileRule restricts the files that can be submitted as the answer of a question.
+type FileRule struct {
+	// Accept lists extensions like ".pdf" and MIME types like "image/png" or "image/*".
+	// An empty list accepts any type except archives and executables.
+	Accept  []string
+	MaxSize int64
+}
+
+var (
+	ErrFileNotAccepted = Error{
+		text:   "این سؤال پاسخ فایلی نمی پذیرد.",
+		reason: ErrorReasonRuleViolation,
+	}
+	ErrFileTypeNotAccepted = Error{
+		text:   "نوع فایل ارسالی برای این سؤال مجاز نیست.",
+		reason: ErrorReasonRuleViolation,
+	}
+	ErrFileTypeForbidden = Error{
+		text:   "ارسال فایل فشرده یا اجرایی برای این سؤال مجاز نیست.",
+		reason: ErrorReasonRuleViolation,
+	}
+	ErrEmptyFile = Error{
+		text:   "فایل ارسالی خالی است.",
+		reason: ErrorReasonRuleViolation,
+	}
+)
+
+func ErrFileTooLarge(maxSize int64) error {
+	return Error{
+		text:   fmt.Sprintf("حجم فایل ارسالی نباید بیشتر از %s باشد.", formatFileSize(maxSize)),
+		reason: ErrorReasonRuleViolation,
+	}
+}
+
+func formatFileSize(size int64) string {
+	switch {
+	case size >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(size)/(1<<20))
+	case size >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(size)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", size)
+}
+
+var (
+	archiveMimeTypes = []string{
+		"application/zip",
+		"application/x-zip-compressed",
+		"application/x-rar-compressed",
+		"application/vnd.rar",
+		"application/x-7z-compressed",
+		"application/gzip",
+		"application/x-gzip",
+		"application/x-tar",
+		"application/x-bzip2",
+		"application/x-xz",
+	}
+	executableExtensions = []string{
+		".exe", ".msi", ".bat", ".cmd", ".com", ".scr", ".dll", ".so", ".dylib",
+		".sh", ".ps1", ".vbs", ".jar", ".apk", ".app", ".dmg", ".deb", ".rpm",
+	}
+	// extensionMimeTypes is used instead of the MIME registry of the host, which differs between systems
+	// and is missing altogether on slim images.
+	extensionMimeTypes = map[string]string{
+		".txt":  "text/plain; charset=utf-8",
+		".md":   "text/markdown; charset=utf-8",
+		".csv":  "text/csv; charset=utf-8",
+		".tex":  "text/x-tex; charset=utf-8",
+		".py":   "text/x-python; charset=utf-8",
+		".c":    "text/x-c; charset=utf-8",
+		".cpp":  "text/x-c++; charset=utf-8",
+		".java": "text/x-java; charset=utf-8",
+		".go":   "text/x-go; charset=utf-8",
+		".js":   "text/javascript; charset=utf-8",
+		".json": "application/json",
+		".xml":  "application/xml",
+		".pdf":  "application/pdf",
+		".rtf":  "application/rtf",
+		".png":  "image/png",
+		".jpg":  "image/jpeg",
+		".jpeg": "image/jpeg",
+		".gif":  "image/gif",
+		".webp": "image/webp",
+		".bmp":  "image/bmp",
+		".mp3":  "audio/mpeg",
+		".wav":  "audio/wav",
+		".ogg":  "audio/ogg",
+		".mp4":  "video/mp4",
+		".webm": "video/webm",
+		".doc":  "application/msword",
+		".xls":  "application/vnd.ms-excel",
+		".ppt":  "application/vnd.ms-powerpoint",
+		".docx": "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+		".xlsx": "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+		".pptx": "application/vnd.openxmlformats-officedocument.presentationml.presentation",
+		".odt":  "application/vnd.oasis.opendocument.text",
+		".ods":  "application/vnd.oasis.opendocument.spreadsheet",
+		".odp":  "application/vnd.oasis.opendocument.presentation",
+		".epub": "application/epub+zip",
+		".zip":  "application/zip",
+		".rar":  "application/vnd.rar",
+		".7z":   "application/x-7z-compressed",
+		".gz":   "application/gzip",
+		".tar":  "application/x-tar",
+		".bz2":  "application/x-bzip2",
+		".xz":   "application/x-xz",
+	}
+	// zipBasedMimeTypes are document formats whose content is sniffed as a zip archive.
+	zipBasedMimeTypes = []string{
+		"application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+		"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+		"application/vnd.openxmlformats-officedocument.presentationml.presentation",
+		"application/vnd.oasis.opendocument.text",
+		"application/vnd.oasis.opendocument.spreadsheet",
+		"application/vnd.oasis.opendocument.presentation",
+		"application/epub+zip",
+	}
+)
+
+// MimeTypeByExtension returns the MIME type of the file extension, or an empty string if it is unknown.
+func MimeTypeByExtension(ext string) string {
+	return extensionMimeTypes[strings.ToLower(ext)]
+}
+
+// IsExecutableExtension reports whether files with the extension are executables or scripts.
+func IsExecutableExtension(ext string) bool {
+	return slices.Contains(executableExtensions, strings.ToLower(ext))
+}
+
+// Check validates the size and type of the file. The type of the file is its sniffed MIME type
+// which must be consistent with the extension of the filename.
+func (r FileRule) Check(file StoredFile) error {
+	if file.Size <= 0 {
+		return ErrEmptyFile
+	}
+	if r.MaxSize > 0 && file.Size > r.MaxSize {
+		return ErrFileTooLarge(r.MaxSize)
+	}
+	ext := strings.ToLower(filepath.Ext(file.Filename))
+	extType := mediaType(MimeTypeByExtension(ext))
+	sniffed := mediaType(file.MimeType)
+	if extType != "" && !sniffedMatchesExtension(sniffed, extType) {
+		return ErrFileTypeNotAccepted
+	}
+	fileType := sniffed
+	if extType != "" {
+		fileType = extType
+	}
+	if len(r.Accept) > 0 && !slices.ContainsFunc(r.Accept, func(a string) bool { return acceptMatches(a, ext, fileType) }) {
+		return ErrFileTypeNotAccepted
+	}
+	isForbidden := fileType == MimeTypeExecutable || IsExecutableExtension(ext) ||
+		slices.Contains(archiveMimeTypes, fileType) || (slices.Contains(archiveMimeTypes, sniffed) && !slices.Contains(zipBasedMimeTypes, fileType))
+	if isForbidden && !r.explicitlyAccepts(ext, fileType) {
+		return ErrFileTypeForbidden
+	}
+	return nil
+}
+
+// explicitlyAccepts reports whether the exact extension or MIME type is in the accept list.
+func (r FileRule) explicitlyAccepts(ext string, fileType string) bool {
+	return slices.ContainsFunc(r.Accept, func(a string) bool {
+		a = strings.ToLower(strings.TrimSpace(a))
+		return a == ext || a == fileType
+	})
+}
+
+func acceptMatches(accept string, ext string, fileType string) bool {
+	accept = strings.ToLower(strings.TrimSpace(accept))
+	switch {
+	case strings.HasPrefix(accept, "."):
+		return accept == ext
+	case accept == "*/*":
+		return true
+	case strings.HasSuffix(accept, "/*"):
+		return strings.HasPrefix(fileType, strings.TrimSuffix(accept, "*"))
+	}
+	return accept == fileType
+}
+
+func sniffedMatchesExtension(sniffed string, extType string) bool {
+	switch {
+	case sniffed == extType, sniffed == "application/octet-stream":
+		return true
+	case sniffed == "text/plain":
+		return strings.HasPrefix(extType, "text/") || extType == "application/json" || extType == "application/xml"
+	case sniffed == "application/zip":
+		return slices.Contains(zipBasedMimeTypes, extType) || slices.Contains(archiveMimeTypes, extType)
+	case slices.Contains(archiveMimeTypes, sniffed):
+		return slices.Contains(archiveMimeTypes, extType)
+	}
+	return false
+}
+
+func mediaType(contentType string) string {
+	t, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+	return t
+}
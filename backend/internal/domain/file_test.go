@@ -0,0 +1,49 @@
+package domain
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestFileRuleCheck(t *testing.T) {
+	tests := []struct {
+		name     string
+		rule     FileRule
+		filename string
+		mimeType string
+		size     int64
+		want     error
+	}{
+		{name: "empty file", filename: "a.pdf", mimeType: "application/pdf", size: 0, want: ErrEmptyFile},
+		{name: "too large", rule: FileRule{MaxSize: 10}, filename: "a.pdf", mimeType: "application/pdf", size: 11, want: ErrFileTooLarge(10)},
+		{name: "at size limit", rule: FileRule{MaxSize: 10}, filename: "a.pdf", mimeType: "application/pdf", size: 10},
+		{name: "any document without accept list", filename: "a.pdf", mimeType: "application/pdf", size: 1},
+		{name: "text file", filename: "notes.txt", mimeType: "text/plain; charset=utf-8", size: 1},
+		{name: "extension in upper case", rule: FileRule{Accept: []string{".pdf"}}, filename: "A.PDF", mimeType: "application/pdf", size: 1},
+		{name: "content does not match extension", filename: "a.pdf", mimeType: "image/png", size: 1, want: ErrFileTypeNotAccepted},
+		{name: "inconclusive content uses extension", rule: FileRule{Accept: []string{"application/pdf"}}, filename: "a.pdf", mimeType: "application/octet-stream", size: 1},
+		{name: "extension not accepted", rule: FileRule{Accept: []string{".pdf"}}, filename: "a.png", mimeType: "image/png", size: 1, want: ErrFileTypeNotAccepted},
+		{name: "wildcard type accepted", rule: FileRule{Accept: []string{"image/*"}}, filename: "a.png", mimeType: "image/png", size: 1},
+		{name: "wildcard type not accepted", rule: FileRule{Accept: []string{"image/*"}}, filename: "a.pdf", mimeType: "application/pdf", size: 1, want: ErrFileTypeNotAccepted},
+		{name: "executable content", filename: "a", mimeType: MimeTypeExecutable, size: 1, want: ErrFileTypeForbidden},
+		{name: "executable allowed by any type", rule: FileRule{Accept: []string{"*/*"}}, filename: "a", mimeType: MimeTypeExecutable, size: 1, want: ErrFileTypeForbidden},
+		{name: "executable accepted explicitly", rule: FileRule{Accept: []string{MimeTypeExecutable}}, filename: "a", mimeType: MimeTypeExecutable, size: 1},
+		{name: "executable disguised as pdf", filename: "a.pdf", mimeType: MimeTypeExecutable, size: 1, want: ErrFileTypeNotAccepted},
+		{name: "archive", filename: "a.zip", mimeType: "application/zip", size: 1, want: ErrFileTypeForbidden},
+		{name: "archive accepted explicitly", rule: FileRule{Accept: []string{".zip"}}, filename: "a.zip", mimeType: "application/zip", size: 1},
+		{name: "archive without extension", filename: "a", mimeType: "application/zip", size: 1, want: ErrFileTypeForbidden},
+		{name: "archive disguised as text", filename: "a.txt", mimeType: "application/zip", size: 1, want: ErrFileTypeNotAccepted},
+		{name: "zip based document", filename: "a.docx", mimeType: "application/zip", size: 1},
+		{name: "source code", filename: "a.py", mimeType: "text/plain; charset=utf-8", size: 1},
+		{name: "script", filename: "a.sh", mimeType: "text/plain; charset=utf-8", size: 1, want: ErrFileTypeForbidden},
+		{name: "unknown extension", filename: "a.unknown", mimeType: "image/png", size: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.rule.Check(StoredFile{Filename: tt.filename, MimeType: tt.mimeType, Size: tt.size})
+			if !errors.Is(err, tt.want) {
+				t.Errorf("Check() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
@@ -9,12 +9,15 @@ import (
 type ResourceType string
 
 const (
-	ResourceTypeBook         ResourceType = "bok"
-	ResourceTypeQuestion     ResourceType = "qst"
-	ResourceTypeTreasure     ResourceType = "trs"
-	ResourceTypeCorrection   ResourceType = "crt"
-	ResourceTypeTradeOffer   ResourceType = "tof"
-	ResourceTypeInboxMessage ResourceType = "inm"
+	ResourceTypeBook             ResourceType = "bok"
+	ResourceTypeQuestion         ResourceType = "qst"
+	ResourceTypeTreasure         ResourceType = "trs"
+	ResourceTypeCorrection       ResourceType = "crt"
+	ResourceTypeTradeOffer       ResourceType = "tof"
+	ResourceTypeInboxMessage     ResourceType = "inm"
+	ResourceTypeFeedbackTemplate ResourceType = "fbt"
+	ResourceTypeAnswerFile       ResourceType = "fil"
+	ResourceTypeOutboxMessage    ResourceType = "obx"
 )
 
 func NewID(resourceType ResourceType) string {
@@ -15,6 +15,7 @@ type InboxMessage struct {
 	UserID    int32
 	CreatedAt time.Time
 	Content   InboxMessageContent
+	Seq       int64
 }
 
 type InboxMessageContent struct {
@@ -24,7 +25,9 @@ type InboxMessageContent struct {
 }
 
 type InboxEvent struct {
-	UserId     int32             `json:"-"`
+	UserId int32 `json:"-"`
+	// Seq orders the event among the player events and inbox messages of the user.
+	Seq        int64             `json:"-"`
 	NewMessage *InboxMessageView `json:"newMessage,omitempty"`
 	Sync       *SyncInboxEvent   `json:"sync,omitempty"`
 }
@@ -101,6 +101,7 @@ type IslandInput struct {
 	ID              string          `json:"id"`
 	Type            string          `json:"type"`
 	Accept          []string        `json:"accept,omitempty"`
+	MaxSize         int64           `json:"maxSize,omitempty"`
 	Description     string          `json:"description"`
 	SubmissionState SubmissionState `json:"submissionState"`
 }
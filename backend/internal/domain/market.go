@@ -41,6 +41,13 @@ type TradeEvent struct {
 	DeletedOffer *DeletedOfferTradeEvent `json:"deleted_offer,omitempty"`
 }
 
+// TradeEventBroadcast is a trade event for every player; the player that made the offer receives ForOfferer instead.
+type TradeEventBroadcast struct {
+	Offerer    int32       `json:"offerer"`
+	ForOfferer *TradeEvent `json:"forOfferer"`
+	ForOthers  *TradeEvent `json:"forOthers"`
+}
+
 type SyncTradeEvent struct {
 	Offset string `json:"offset"`
 }
@@ -2,6 +2,7 @@ package domain
 
 import (
 	"errors"
+	"fmt"
 	"math"
 	"slices"
 	"strings"
@@ -35,6 +36,7 @@ type Player struct {
 	RedKey             int32     `json:"redKey"`
 	GoldenKey          int32     `json:"goldenKey"`
 	MasterKey          int32     `json:"masterKey"`
+	HiddenOnMap        bool      `json:"hiddenOnMap"`
 	VisitedTerritories []string  `json:"-"`
 	UpdatedAt          time.Time `json:"-"`
 }
@@ -61,6 +63,8 @@ const (
 	PlayerUpdateEventOwnOfferDeleted  = "ownOfferDeleted"
 	PlayerUpdateEventInvest           = "invest"
 	PlayerUpdateEventInvestReward     = "investReward"
+	PlayerUpdateEventAdminGrant       = "adminGrant"
+	PlayerUpdateEventMapVisibility    = "mapVisibility"
 )
 
 type PlayerUpdateEvent struct {
@@ -68,7 +72,16 @@ type PlayerUpdateEvent struct {
 	Player *Player
 }
 
+// PlayerLocation is where a player is shown on the map of their territory.
+type PlayerLocation struct {
+	UserId   int32
+	Name     string
+	IslandID string
+}
+
 type FullPlayerUpdateEvent struct {
+	// Seq orders the event among the player events and inbox messages of the user.
+	Seq    int64       `json:"-"`
 	Reason string      `json:"reason"`
 	Player *FullPlayer `json:"player"`
 }
@@ -178,6 +191,35 @@ func RefuelCheck(player Player, territory *Territory) (result RefuelCheckResult)
 	return
 }
 
+// GrantResources adds the items to the player. Fuel is still capped by the fuel capacity.
+func GrantResources(player Player, grant Cost) (*PlayerUpdateEvent, error) {
+	if len(grant.Items) == 0 {
+		return nil, errors.New("nothing to grant")
+	}
+	for _, item := range grant.Items {
+		if getItemField(&player, item.Type) == nil {
+			return nil, fmt.Errorf("unknown item type %q", item.Type)
+		}
+		if item.Amount <= 0 {
+			return nil, fmt.Errorf("invalid amount %d for %q", item.Amount, item.Type)
+		}
+	}
+	player = addCost(player, grant)
+	return &PlayerUpdateEvent{
+		Reason: PlayerUpdateEventAdminGrant,
+		Player: &player,
+	}, nil
+}
+
+// SetMapVisibility shows or hides the player on the maps other players see.
+func SetMapVisibility(player Player, hidden bool) *PlayerUpdateEvent {
+	player.HiddenOnMap = hidden
+	return &PlayerUpdateEvent{
+		Reason: PlayerUpdateEventMapVisibility,
+		Player: &player,
+	}
+}
+
 func Refuel(player Player, territory *Territory, amount int32) (*PlayerUpdateEvent, error) {
 	check := RefuelCheck(player, territory)
 	if amount <= 0 {
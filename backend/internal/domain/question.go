@@ -10,6 +10,7 @@ type Question struct {
 	Text        string   `json:"text"`
 	InputType   string   `json:"inputType"`
 	InputAccept []string `json:"inputAccept"`
+	MaxFileSize int64    `json:"maxFileSize,omitempty"`
 }
 
 type BookQuestion struct {
@@ -19,6 +20,9 @@ type BookQuestion struct {
 	KnowledgeAmount int32
 	RewardSource    string
 	Context         string
+	InputType       string
+	InputAccept     []string
+	MaxFileSize     int64
 }
 
 type Answer struct {
@@ -45,6 +49,21 @@ const (
 	AnswerStatusHalfCorrect AnswerStatus = 4
 )
 
+// String returns the name by which the status is exposed to clients.
+func (s AnswerStatus) String() string {
+	switch s {
+	case AnswerStatusPending:
+		return "pending"
+	case AnswerStatusCorrect:
+		return "correct"
+	case AnswerStatusHalfCorrect:
+		return "half-correct"
+	case AnswerStatusWrong:
+		return "wrong"
+	}
+	return "empty"
+}
+
 type HelpState int
 
 const (
@@ -91,24 +110,11 @@ func GetSubmissionState(question BookQuestion, answer Answer) SubmissionState {
 	if answer.Status == AnswerStatusEmpty {
 		submittedAt = 0
 	}
-	status := ""
-	switch answer.Status {
-	case AnswerStatusEmpty:
-		status = "empty"
-	case AnswerStatusPending:
-		status = "pending"
-	case AnswerStatusCorrect:
-		status = "correct"
-	case AnswerStatusHalfCorrect:
-		status = "half-correct"
-	case AnswerStatusWrong:
-		status = "wrong"
-	}
 	return SubmissionState{
 		Submittable:      CheckSubmit(question, answer) == nil,
 		ShowHelp:         CheckRequestHelp(question, answer) == nil,
 		HasRequestedHelp: answer.RequestedHelp,
-		Status:           status,
+		Status:           answer.Status.String(),
 		Filename:         answer.Filename.String,
 		Value:            answer.TextContent.String,
 		Feedback:         answer.Feedback.String,
@@ -151,8 +157,27 @@ const (
 	CorrectionStatusDraft   CorrectionStatus = 0
 	CorrectionStatusPending CorrectionStatus = 1
 	CorrectionStatusApplied CorrectionStatus = 2
+	// CorrectionStatusBlind is a first grade that waits for an independent second grade.
+	CorrectionStatusBlind CorrectionStatus = 3
+	// CorrectionStatusDisputed is a grade that disagrees with another one and waits for an admin.
+	CorrectionStatusDisputed CorrectionStatus = 4
+	// CorrectionStatusSuperseded is a grade that is replaced by another correction of the same answer.
+	CorrectionStatusSuperseded CorrectionStatus = 5
 )
 
+type CorrectionStatusChange struct {
+	ID   string
+	From CorrectionStatus
+	To   CorrectionStatus
+}
+
+// CorrectionDispute holds the disagreeing grades of an answer that needs second grading.
+type CorrectionDispute struct {
+	UserID      int32
+	Question    BookQuestion
+	Corrections []Correction
+}
+
 var CorrectionAllowedNewStatuses = []AnswerStatus{
 	AnswerStatusWrong,
 	AnswerStatusHalfCorrect,
@@ -160,10 +185,32 @@ var CorrectionAllowedNewStatuses = []AnswerStatus{
 }
 
 type Correction struct {
-	ID         string
-	QuestionId string
-	UserId     int32
-	NewStatus  AnswerStatus
-	Feedback   string
-	UpdatedAt  time.Time
+	ID          string
+	QuestionId  string
+	UserId      int32
+	NewStatus   AnswerStatus
+	Feedback    string
+	Corrector   Corrector
+	SubmittedAt time.Time
+	UpdatedAt   time.Time
+}
+
+type Corrector struct {
+	ID   int64
+	Name string
+}
+
+// AnswerClaim marks a pending answer as being corrected by a single corrector until ExpiresAt.
+type AnswerClaim struct {
+	UserID     int32
+	QuestionID string
+	Corrector  Corrector
+	ChatID     int64
+	MessageID  int
+	ClaimedAt  time.Time
+	ExpiresAt  time.Time
+}
+
+func (c AnswerClaim) HeldByOther(corrector Corrector, now time.Time) bool {
+	return c.Corrector.ID != corrector.ID && c.ExpiresAt.After(now)
 }
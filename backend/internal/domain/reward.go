@@ -137,6 +137,12 @@ func giveRewardOfPool(player Player, poolId string) (Player, bool) {
 	return player, false
 }
 
+// NeedsSecondGrading reports whether the reward of the question is high enough
+// to require two independent corrections.
+func NeedsSecondGrading(question BookQuestion, pool string, hasPool bool) bool {
+	return question.RewardSource == "final" || (hasPool && pool == PoolHard)
+}
+
 func GetRewardOfCorrection(player Player, question BookQuestion, correction Correction, pool string, hasPool bool) (*PlayerUpdateEvent, *Cost, bool) {
 	if correction.NewStatus != AnswerStatusCorrect && correction.NewStatus != AnswerStatusHalfCorrect {
 		return nil, nil, false
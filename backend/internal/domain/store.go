@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"io"
 	"time"
 )
 
@@ -23,6 +24,11 @@ var (
 	ErrAlreadyApplied             = errors.New("already applied")
 	ErrOfferAlreadyDeleted        = errors.New("offer already deleted")
 	ErrInvalidFilter              = errors.New("invalid filter")
+	ErrAnswerClaimed              = errors.New("answer is claimed by another corrector")
+	ErrCorrectionNotFound         = errors.New("correction not found")
+	ErrFeedbackTemplateNotFound   = errors.New("feedback template not found")
+	ErrSecondGradeBySameCorrector = errors.New("the second grade must be given by another corrector")
+	ErrCorrectionStatusChanged    = errors.New("correction status changed concurrently")
 )
 
 type Tx interface {
@@ -30,6 +36,54 @@ type Tx interface {
 	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
 }
 
+// ContentStores are the stores that game content is written to.
+type ContentStores struct {
+	Territory        TerritoryStore
+	Island           IslandStore
+	User             UserStore
+	Player           PlayerStore
+	Question         QuestionStore
+	Treasure         TreasureStore
+	FeedbackTemplate FeedbackTemplateStore
+	ContentVersion   ContentVersionStore
+}
+
+// ContentTransactor runs f with content stores that all write in a single transaction.
+// The transaction is committed only if f returns nil.
+type ContentTransactor interface {
+	InContentTx(ctx context.Context, f func(stores ContentStores) error) error
+}
+
+// GameStores are the stores that the actions of the players read and write.
+type GameStores struct {
+	// Tx is the transaction of the stores, for the store methods that take one.
+	// It is nil for stores that are not bound to a transaction.
+	Tx        Tx
+	User      UserStore
+	Player    PlayerStore
+	Territory TerritoryStore
+	Question  QuestionStore
+	Island    IslandStore
+	Treasure  TreasureStore
+	Market    MarketStore
+	Inbox     InboxStore
+	Invest    InvestStore
+}
+
+// GameTransactor runs f with game stores that all read and write in a single transaction.
+// The transaction is committed only if f returns nil.
+type GameTransactor interface {
+	InGameTx(ctx context.Context, f func(stores GameStores) error) error
+}
+
+type ContentVersionStore interface {
+	// Create stores the version with the next version number and sets it on version.
+	Create(ctx context.Context, version *ContentVersion) error
+	// List returns the versions without their content, newest first.
+	List(ctx context.Context) ([]ContentVersion, error)
+	Get(ctx context.Context, version int32) (ContentVersion, error)
+}
+
 type TerritoryStore interface {
 	SetTerritory(ctx context.Context, territory *Territory) error
 	GetTerritoryByID(ctx context.Context, territoryID string) (*Territory, error)
@@ -50,6 +104,8 @@ type IslandStore interface {
 	GetTerritoryPoolSettings(ctx context.Context, territoryId string) (TerritoryPoolSettings, error)
 	AddBookToPool(ctx context.Context, poolId string, bookId string) error
 	GetPoolOfBook(ctx context.Context, bookId string) (poolId string, found bool, err error)
+	// GetPoolBooks returns the ids of the books of each pool, by pool id.
+	GetPoolBooks(ctx context.Context) (map[string][]string, error)
 	AssignBookToIslandFromPool(ctx context.Context, territoryId string, islandId string, userId int32) (bookId string, err error)
 	IsIslandPortable(ctx context.Context, userId int32, islandId string) (bool, error)
 	AddPortableIsland(ctx context.Context, userId int32, islandId string) (bool, error)
@@ -60,6 +116,7 @@ type UserStore interface {
 	Create(ctx context.Context, user *User) error
 	Get(ctx context.Context, id int32) (*User, error)
 	GetByUsername(ctx context.Context, username string) (*User, error)
+	SetRole(ctx context.Context, id int32, role Role) error
 }
 
 type PlayerStore interface {
@@ -67,8 +124,15 @@ type PlayerStore interface {
 	Get(ctx context.Context, userId int32) (Player, error)
 	Update(ctx context.Context, tx Tx, old, updated Player) error
 	GetAll(ctx context.Context) ([]int32, error)
-	CreatePlayerEvent(ctx context.Context, userId int32, createdAt time.Time, reason string, player FullPlayer) error
-	GetLocations(ctx context.Context, territoryID string) (map[string][]int32, error)
+	// CreatePlayerEvent stores the event in tx, or on its own if tx is nil,
+	// and returns its sequence number among the events of the user.
+	CreatePlayerEvent(ctx context.Context, tx Tx, userId int32, createdAt time.Time, reason string, player FullPlayer) (int64, error)
+	// GetPlayerEventsAfter returns the events of the user with a sequence number greater than seq, oldest first.
+	GetPlayerEventsAfter(ctx context.Context, userId int32, seq int64, limit int) ([]FullPlayerUpdateEvent, error)
+	// GetLastEventSeq returns the sequence number of the last player event or inbox message of the user.
+	GetLastEventSeq(ctx context.Context, userId int32) (int64, error)
+	// GetLocations returns the players of the territory who are not hidden on the map, ordered by user id.
+	GetLocations(ctx context.Context, territoryID string) ([]PlayerLocation, error)
 }
 
 type QuestionStore interface {
@@ -77,7 +141,16 @@ type QuestionStore interface {
 	// otherwise creates an Answer with the given ID and zero value for other fields (except timestamps).
 	GetOrCreateAnswer(ctx context.Context, userId int32, questionID string) (Answer, error)
 	GetAnswer(ctx context.Context, userId int32, questionId string) (Answer, error)
-	GetPendingAnswers(ctx context.Context, ifBefore time.Time) ([]Answer, error)
+	// GetPendingBacklog returns the number of pending answers submitted before ifBefore per territory.
+	// Answers of pool islands are counted under the empty territory.
+	GetPendingBacklog(ctx context.Context, ifBefore time.Time) (map[string]int, error)
+	// GetCorrectionQueue returns pending answers that have neither a finalized correction nor a disputed one,
+	// along with what a corrector needs to know about them, oldest first.
+	GetCorrectionQueue(ctx context.Context) ([]QueuedAnswer, error)
+	// GetAnswersToRemind returns unclaimed pending answers submitted before pendingBefore
+	// that have not been reminded since remindedBefore.
+	GetAnswersToRemind(ctx context.Context, pendingBefore, remindedBefore time.Time) ([]Answer, error)
+	MarkAnswerReminded(ctx context.Context, userId int32, questionId string, remindedAt time.Time) error
 	MarkHelpRequest(ctx context.Context, userId int32, questionId string) error
 	SetHelpState(ctx context.Context, userId int32, questionId string, state HelpState) error
 	// SubmitAnswer updates the existing Answer with the given args and sets the answer status to AnswerStatusPending.
@@ -87,12 +160,43 @@ type QuestionStore interface {
 	GetKnowledgeBars(ctx context.Context, userId int32) ([]KnowledgeBar, error)
 	HasAnsweredIsland(ctx context.Context, userId int32, islandId string) (bool, error)
 	GetQuestion(ctx context.Context, questionId string) (BookQuestion, error)
+	// CountBookAnswers returns the number of submitted answers of each question of the book.
+	// Questions without any submitted answer are left out.
+	CountBookAnswers(ctx context.Context, bookId string) (map[string]int, error)
 	CreateCorrection(ctx context.Context, Correction Correction) error
 	ApplyCorrection(ctx context.Context, tx Tx, ifBefore time.Time, correction Correction) (Answer, bool, error)
 	GetUnappliedCorrections(ctx context.Context, before time.Time) ([]Correction, error)
 	UpdateCorrectionNewStatus(ctx context.Context, id string, newStatus AnswerStatus) error
 	UpdateCorrectionFeedback(ctx context.Context, id string, feedback string) (AnswerStatus, error)
 	FinalizeCorrection(ctx context.Context, id string) error
+	GetCorrection(ctx context.Context, id string) (Correction, error)
+	GetAnswerCorrections(ctx context.Context, userId int32, questionId string, status CorrectionStatus) ([]Correction, error)
+	// BlindCorrection moves the draft correction to CorrectionStatusBlind, unless its answer already has a blind correction.
+	// It reports whether the correction became blind.
+	BlindCorrection(ctx context.Context, id string) (bool, error)
+	// ChangeCorrectionStatuses applies all the changes in a single transaction.
+	// It returns ErrCorrectionStatusChanged if any of the corrections is not in its From status.
+	ChangeCorrectionStatuses(ctx context.Context, changes []CorrectionStatusChange) error
+	// GetFinalizedCorrections returns corrections finalized since the given time.
+	GetFinalizedCorrections(ctx context.Context, since time.Time) ([]CorrectionRecord, error)
+	// ClaimAnswer stores the claim if the answer is not claimed, is claimed by the same corrector or its claim is expired.
+	// It returns the claim that holds after the call.
+	ClaimAnswer(ctx context.Context, claim AnswerClaim) (AnswerClaim, error)
+	GetAnswerClaim(ctx context.Context, userId int32, questionId string) (claim AnswerClaim, found bool, err error)
+	// ReleaseAnswerClaim deletes the claim if it is still the same as the given one.
+	ReleaseAnswerClaim(ctx context.Context, claim AnswerClaim) (bool, error)
+	// GetExpiredAnswerClaims returns claims expired before the given time whose answer is still pending without a finalized correction.
+	GetExpiredAnswerClaims(ctx context.Context, before time.Time) ([]AnswerClaim, error)
+}
+
+type FeedbackTemplateStore interface {
+	// SetQuestionTemplates replaces the templates of the question authored in book content.
+	SetQuestionTemplates(ctx context.Context, questionId string, texts []string) error
+	CreateTemplate(ctx context.Context, template FeedbackTemplate) error
+	GetTemplate(ctx context.Context, id string) (FeedbackTemplate, error)
+	// GetTemplates returns templates of the question and the territory, most used ones first.
+	GetTemplates(ctx context.Context, questionId string, territoryId string) ([]FeedbackTemplate, error)
+	IncrementUsage(ctx context.Context, id string) error
 }
 
 type TreasureStore interface {
@@ -121,8 +225,57 @@ type MarketStore interface {
 }
 
 type InboxStore interface {
-	CreateMessage(ctx context.Context, tx Tx, msg InboxMessage) error
+	// CreateMessage stores the message and returns its sequence number among the events of the user.
+	CreateMessage(ctx context.Context, tx Tx, msg InboxMessage) (int64, error)
 	GetMessages(ctx context.Context, userId int32, before time.Time, limit int) ([]InboxMessage, error)
+	// GetMessagesAfter returns the messages of the user with a sequence number greater than seq, oldest first.
+	GetMessagesAfter(ctx context.Context, userId int32, seq int64, limit int) ([]InboxMessage, error)
+}
+
+// FileStore keeps the content of uploaded files by their id.
+type FileStore interface {
+	// Put stores data which must match the size and SHA256 of the file.
+	Put(ctx context.Context, file StoredFile, data io.Reader) error
+	Get(ctx context.Context, id string) (io.ReadCloser, error)
+}
+
+// EventBus delivers events to the subscribers of a topic in every replica of the backend,
+// including the one that published them.
+type EventBus interface {
+	// Publish sends the JSON encoding of payload to the subscribers of the topic.
+	Publish(ctx context.Context, topic string, payload any) error
+	// Subscribe adds a handler for the events of the topic. The events published one after another
+	// reach the handlers of every replica in the same order.
+	Subscribe(topic string, handler func(payload []byte))
+}
+
+type FileMetadataStore interface {
+	CreateFile(ctx context.Context, file StoredFile) error
+	GetFile(ctx context.Context, id string) (StoredFile, error)
+}
+
+// OutboxMessage is an event stored in the transaction of the changes it tells about,
+// to be dispatched once they are committed.
+type OutboxMessage struct {
+	ID        string
+	Kind      string
+	Payload   []byte
+	CreatedAt time.Time
+}
+
+type OutboxStore interface {
+	// Add stores the message in tx, or on its own if tx is nil.
+	Add(ctx context.Context, tx Tx, msg OutboxMessage) error
+	// GetDue returns the messages that are not dispatched and whose next attempt is due, oldest first.
+	// Abandoned messages are never due.
+	GetDue(ctx context.Context, now time.Time, limit int) ([]OutboxMessage, error)
+	// Claim takes a due message for an attempt until the given time and returns the number of its attempts.
+	// ok is false if it is not due anymore, e.g. because another dispatcher claimed it first.
+	Claim(ctx context.Context, id string, now, until time.Time) (attempts int, ok bool, err error)
+	MarkDispatched(ctx context.Context, id string, at time.Time) error
+	// MarkFailed records the error of an attempt. A nil nextAttemptAt abandons the message.
+	MarkFailed(ctx context.Context, id string, lastError string, nextAttemptAt *time.Time) error
+	DeleteDispatchedBefore(ctx context.Context, before time.Time) error
 }
 
 type GameStateStore interface {
@@ -10,9 +10,43 @@ type User struct {
 	Username       string `json:"username"`
 	Name           string `json:"name"`
 	MeetLink       string `json:"meetLink,omitempty"`
+	Role           Role   `json:"role"`
 	HashedPassword []byte `json:"-"`
 }
 
+type Role string
+
+const (
+	RolePlayer    Role = "player"
+	RoleCorrector Role = "corrector"
+	RoleMentor    Role = "mentor"
+	RoleAdmin     Role = "admin"
+)
+
+func IsValidRole(role Role) bool {
+	switch role {
+	case RolePlayer, RoleCorrector, RoleMentor, RoleAdmin:
+		return true
+	}
+	return false
+}
+
+// HasRole reports whether the user has any of the given roles.
+func (u *User) HasRole(roles ...Role) bool {
+	for _, r := range roles {
+		if u.Role == r {
+			return true
+		}
+	}
+	return false
+}
+
+// AsCorrector returns the corrector identity of a user correcting through the HTTP API.
+// The id is negated to keep it apart from the ids of bot users.
+func (u *User) AsCorrector() Corrector {
+	return Corrector{ID: -int64(u.ID), Name: u.Username}
+}
+
 func HashPassword(plainPassword string) ([]byte, error) {
 	h, err := bcrypt.GenerateFromPassword([]byte(plainPassword), bcrypt.DefaultCost)
 	if err != nil {
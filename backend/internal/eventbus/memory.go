@@ -0,0 +1,51 @@
+package eventbus
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sync"
+)
+
+// subscribers keeps the handlers of each topic for the bus implementations.
+type subscribers struct {
+	lock     sync.RWMutex
+	handlers map[string][]func(payload []byte)
+}
+
+func (s *subscribers) Subscribe(topic string, handler func(payload []byte)) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.handlers == nil {
+		s.handlers = make(map[string][]func(payload []byte))
+	}
+	s.handlers[topic] = append(s.handlers[topic], handler)
+}
+
+func (s *subscribers) dispatch(topic string, payload []byte) {
+	s.lock.RLock()
+	handlers := slices.Clone(s.handlers[topic])
+	s.lock.RUnlock()
+	for _, h := range handlers {
+		h(payload)
+	}
+}
+
+// Memory delivers events within the process. It is enough when a single replica is running.
+type Memory struct {
+	subscribers
+}
+
+func NewMemory() *Memory {
+	return &Memory{}
+}
+
+func (m *Memory) Publish(_ context.Context, topic string, payload any) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("marshal event of topic %q: %w", topic, err)
+	}
+	m.dispatch(topic, data)
+	return nil
+}
@@ -0,0 +1,272 @@
+package eventbus
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5/stdlib"
+	"log/slog"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	notifyChannel = "bermudia_events"
+	// maxNotifyPayload stays below the 8000 bytes limit of NOTIFY payloads.
+	// Larger events are only sent by their seq and read from event_bus_events.
+	maxNotifyPayload = 7000
+	// eventRetention is how long published events are kept for the replicas to read or replay them.
+	eventRetention = 5 * time.Minute
+	reconnectDelay = 5 * time.Second
+	// replayMargin is how far before losing the connection the listener looks for missed events,
+	// to cover notifications in flight and clock differences between the replicas.
+	replayMargin = 10 * time.Second
+)
+
+const eventBusEventsSchema = `
+CREATE TABLE IF NOT EXISTS event_bus_events (
+    seq BIGSERIAL PRIMARY KEY,
+    topic VARCHAR(255) NOT NULL,
+    payload TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_event_bus_events_created_at ON event_bus_events(created_at);
+`
+
+type notification struct {
+	Topic string `json:"t"`
+	// Seq is the seq of the event in event_bus_events.
+	Seq int64 `json:"s"`
+	// Payload is left out for large events.
+	Payload json.RawMessage `json:"p,omitempty"`
+}
+
+// Postgres delivers events to every replica connected to the database using LISTEN/NOTIFY.
+// A replica receives its own events through the database as well, so all replicas see them in the same order.
+// Every event is also stored for a while, so a replica replays the events it missed while its listener reconnected.
+type Postgres struct {
+	subscribers
+	db          *sql.DB
+	cancel      context.CancelFunc
+	done        chan struct{}
+	lastCleanup atomic.Int64
+
+	// The fields below are only used by the listener goroutine.
+	// handled holds the seqs of the recently dispatched events, so replayed events are not dispatched twice.
+	handled    map[int64]time.Time
+	lastPrune  time.Time
+	lostAt     time.Time
+	gaps       int
+	lostEvents int
+}
+
+func NewPostgres(db *sql.DB) (*Postgres, error) {
+	_, err := db.Exec(eventBusEventsSchema)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create event_bus_events table: %w", err)
+	}
+	return &Postgres{db: db, handled: make(map[int64]time.Time)}, nil
+}
+
+func (p *Postgres) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	p.cancel = cancel
+	p.done = make(chan struct{})
+	go p.listen(ctx)
+}
+
+func (p *Postgres) Stop() {
+	if p.cancel == nil {
+		return
+	}
+	p.cancel()
+	<-p.done
+}
+
+func (p *Postgres) Publish(ctx context.Context, topic string, payload any) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("marshal event of topic %q: %w", topic, err)
+	}
+	now := time.Now().UTC()
+	n := notification{Topic: topic}
+	err = p.db.QueryRowContext(ctx,
+		`INSERT INTO event_bus_events (topic, payload, created_at) VALUES ($1, $2, $3) RETURNING seq`,
+		topic, string(data), now,
+	).Scan(&n.Seq)
+	if err != nil {
+		return fmt.Errorf("store event of topic %q: %w", topic, err)
+	}
+	if len(data) <= maxNotifyPayload {
+		n.Payload = data
+	}
+	p.deleteOldEvents(ctx, now)
+	message, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	_, err = p.db.ExecContext(ctx, `SELECT pg_notify($1, $2)`, notifyChannel, string(message))
+	if err != nil {
+		return fmt.Errorf("notify event of topic %q: %w", topic, err)
+	}
+	return nil
+}
+
+// deleteOldEvents deletes the events older than eventRetention, at most once a minute per replica.
+func (p *Postgres) deleteOldEvents(ctx context.Context, now time.Time) {
+	last := p.lastCleanup.Load()
+	if now.Sub(time.Unix(0, last)) < time.Minute || !p.lastCleanup.CompareAndSwap(last, now.UnixNano()) {
+		return
+	}
+	_, err := p.db.ExecContext(ctx, `DELETE FROM event_bus_events WHERE created_at < $1`, now.Add(-eventRetention))
+	if err != nil {
+		slog.Error("failed to delete old events", slog.String("error", err.Error()))
+	}
+}
+
+func (p *Postgres) listen(ctx context.Context) {
+	defer close(p.done)
+	for {
+		err := p.listenOnce(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if p.lostAt.IsZero() {
+			p.lostAt = time.Now().UTC()
+		}
+		slog.Error("event bus listener stopped; reconnecting",
+			slog.String("error", err.Error()),
+		)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(reconnectDelay):
+		}
+	}
+}
+
+func (p *Postgres) listenOnce(ctx context.Context) error {
+	conn, err := p.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+	return conn.Raw(func(driverConn any) error {
+		stdlibConn, ok := driverConn.(*stdlib.Conn)
+		if !ok {
+			return errors.New("the postgres event bus needs the pgx driver")
+		}
+		pgxConn := stdlibConn.Conn()
+		if _, err := pgxConn.Exec(ctx, "LISTEN "+notifyChannel); err != nil {
+			return err
+		}
+		// replay after LISTEN, so events published during the replay are received as notifications
+		if !p.lostAt.IsZero() {
+			if err := p.replay(ctx); err != nil {
+				return fmt.Errorf("replay missed events: %w", err)
+			}
+		}
+		for {
+			n, err := pgxConn.WaitForNotification(ctx)
+			if err != nil {
+				return err
+			}
+			p.handle(ctx, n.Payload)
+		}
+	})
+}
+
+// replay dispatches the stored events the listener missed since it lost its connection.
+func (p *Postgres) replay(ctx context.Context) error {
+	since := p.lostAt.Add(-replayMargin)
+	rows, err := p.db.QueryContext(ctx,
+		`SELECT seq, topic, payload FROM event_bus_events WHERE created_at >= $1 ORDER BY seq`,
+		since,
+	)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+	var missed []notification
+	for rows.Next() {
+		var n notification
+		var payload string
+		if err := rows.Scan(&n.Seq, &n.Topic, &payload); err != nil {
+			return err
+		}
+		if _, ok := p.handled[n.Seq]; ok {
+			continue
+		}
+		n.Payload = json.RawMessage(payload)
+		missed = append(missed, n)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, n := range missed {
+		p.dispatchOnce(n)
+	}
+
+	gap := time.Since(p.lostAt)
+	p.gaps++
+	p.lostAt = time.Time{}
+	if gap+replayMargin > eventRetention {
+		// the events of the start of the gap may be deleted already; clients catch up with their lastSeq
+		p.lostEvents++
+		slog.Error("event bus listener was disconnected longer than events are kept; events may be lost",
+			slog.Duration("gap", gap),
+			slog.Int("gaps", p.gaps),
+			slog.Int("gaps_with_lost_events", p.lostEvents),
+		)
+	}
+	slog.Info("event bus listener reconnected",
+		slog.Duration("gap", gap),
+		slog.Int("replayed", len(missed)),
+		slog.Int("gaps", p.gaps),
+	)
+	return nil
+}
+
+func (p *Postgres) handle(ctx context.Context, message string) {
+	var n notification
+	if err := json.Unmarshal([]byte(message), &n); err != nil {
+		slog.Error("invalid event bus notification", slog.String("error", err.Error()))
+		return
+	}
+	if _, ok := p.handled[n.Seq]; ok {
+		return
+	}
+	if n.Payload == nil {
+		var payload string
+		err := p.db.QueryRowContext(ctx, `SELECT payload FROM event_bus_events WHERE seq = $1`, n.Seq).Scan(&payload)
+		if err != nil {
+			slog.Error("failed to read event payload",
+				slog.String("topic", n.Topic),
+				slog.String("error", err.Error()),
+			)
+			return
+		}
+		n.Payload = json.RawMessage(payload)
+	}
+	p.dispatchOnce(n)
+}
+
+func (p *Postgres) dispatchOnce(n notification) {
+	now := time.Now()
+	p.handled[n.Seq] = now
+	if now.Sub(p.lastPrune) > eventRetention {
+		for seq, at := range p.handled {
+			if now.Sub(at) > 2*eventRetention {
+				delete(p.handled, seq)
+			}
+		}
+		p.lastPrune = now
+	}
+	p.dispatch(n.Topic, n.Payload)
+}
@@ -0,0 +1,57 @@
+package filestore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/Rastaiha/bermudia/internal/domain"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// Local keeps files in a directory on the local disk.
+type Local struct {
+	dir string
+}
+
+func NewLocal(dir string) (*Local, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("create file store directory: %w", err)
+	}
+	return &Local{dir: dir}, nil
+}
+
+func (l *Local) path(id string) string {
+	return filepath.Join(l.dir, filepath.Base(id))
+}
+
+func (l *Local) Put(ctx context.Context, file domain.StoredFile, data io.Reader) error {
+	tmp, err := os.CreateTemp(l.dir, ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = os.Remove(tmp.Name())
+	}()
+	n, err := io.Copy(tmp, data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("write file: %w", err)
+	}
+	if n != file.Size {
+		return fmt.Errorf("written %d bytes instead of %d", n, file.Size)
+	}
+	return os.Rename(tmp.Name(), l.path(file.ID))
+}
+
+func (l *Local) Get(ctx context.Context, id string) (io.ReadCloser, error) {
+	f, err := os.Open(l.path(id))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, domain.ErrFileNotFound
+	}
+	return f, err
+}
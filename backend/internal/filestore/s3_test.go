@@ -0,0 +1,201 @@
+package filestore
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Rastaiha/bermudia/internal/config"
+	"github.com/Rastaiha/bermudia/internal/domain"
+)
+
+const (
+	testAccessKey = "test-access-key"
+	testSecretKey = "test-secret-key"
+	testRegion    = "test-region"
+	testBucket    = "answers"
+)
+
+// fakeS3 is a stand-in for an S3 server that keeps the objects in memory.
+// It does not verify signatures, but checks that every request carries well-formed signature headers.
+type fakeS3 struct {
+	t       *testing.T
+	lock    sync.Mutex
+	objects map[string][]byte
+	types   map[string]string
+}
+
+func newFakeS3(t *testing.T) *httptest.Server {
+	f := &fakeS3{t: t, objects: make(map[string][]byte), types: make(map[string]string)}
+	server := httptest.NewServer(f)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if reason := checkSignatureHeaders(r); reason != "" {
+		f.t.Errorf("%s %s: %s", r.Method, r.URL.Path, reason)
+		http.Error(w, reason, http.StatusForbidden)
+		return
+	}
+	key, ok := strings.CutPrefix(r.URL.Path, "/"+testBucket+"/")
+	if !ok {
+		http.Error(w, "no such bucket", http.StatusNotFound)
+		return
+	}
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	switch r.Method {
+	case http.MethodPut:
+		f.objects[key] = body
+		f.types[key] = r.Header.Get("Content-Type")
+	case http.MethodGet:
+		data, ok := f.objects[key]
+		if !ok {
+			http.Error(w, "no such key", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", f.types[key])
+		_, _ = w.Write(data)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+var (
+	hexHash         = regexp.MustCompile(`^[0-9a-f]{64}$`)
+	authorizationV4 = regexp.MustCompile(`^AWS4-HMAC-SHA256 Credential=` + testAccessKey + `/\d{8}/` + testRegion + `/s3/aws4_request, SignedHeaders=([a-z0-9-]+(;[a-z0-9-]+)*), Signature=[0-9a-f]{64}$`)
+)
+
+// checkSignatureHeaders returns why the signature headers of the request are malformed,
+// or an empty string if they are well-formed.
+func checkSignatureHeaders(r *http.Request) string {
+	if !hexHash.MatchString(r.Header.Get("X-Amz-Content-Sha256")) {
+		return "malformed x-amz-content-sha256"
+	}
+	if _, err := time.Parse("20060102T150405Z", r.Header.Get("X-Amz-Date")); err != nil {
+		return "malformed x-amz-date"
+	}
+	m := authorizationV4.FindStringSubmatch(r.Header.Get("Authorization"))
+	if m == nil {
+		return "malformed authorization"
+	}
+	for _, h := range []string{"host", "x-amz-content-sha256", "x-amz-date"} {
+		if !slices.Contains(strings.Split(m[1], ";"), h) {
+			return h + " is not signed"
+		}
+	}
+	return ""
+}
+
+func newTestS3(t *testing.T, endpoint string, secretKey string) *S3 {
+	s, err := NewS3(config.S3{
+		Endpoint:  endpoint,
+		Region:    testRegion,
+		Bucket:    testBucket,
+		AccessKey: testAccessKey,
+		SecretKey: secretKey,
+	})
+	if err != nil {
+		t.Fatalf("NewS3: %v", err)
+	}
+	return s
+}
+
+func storedFile(id string, data []byte) domain.StoredFile {
+	hash := sha256.Sum256(data)
+	return domain.StoredFile{
+		ID:       id,
+		Filename: "answer.pdf",
+		MimeType: "application/pdf",
+		Size:     int64(len(data)),
+		SHA256:   hex.EncodeToString(hash[:]),
+	}
+}
+
+func TestS3RoundTrip(t *testing.T) {
+	server := newFakeS3(t)
+	s := newTestS3(t, server.URL+"/", testSecretKey)
+	ctx := context.Background()
+
+	files := map[string][]byte{
+		"FILE_1":           []byte("%PDF-1.4 some answer"),
+		"FILE_with space?": []byte("a key that must be escaped"),
+		"FILE_empty":       {},
+	}
+	for id, data := range files {
+		if err := s.Put(ctx, storedFile(id, data), bytes.NewReader(data)); err != nil {
+			t.Fatalf("Put(%q): %v", id, err)
+		}
+	}
+	for id, data := range files {
+		r, err := s.Get(ctx, id)
+		if err != nil {
+			t.Fatalf("Get(%q): %v", id, err)
+		}
+		got, err := io.ReadAll(r)
+		_ = r.Close()
+		if err != nil {
+			t.Fatalf("read %q: %v", id, err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Errorf("Get(%q) = %q, want %q", id, got, data)
+		}
+	}
+
+	if _, err := s.Get(ctx, "FILE_missing"); !errors.Is(err, domain.ErrFileNotFound) {
+		t.Errorf("Get of a missing object: got error %v, want %v", err, domain.ErrFileNotFound)
+	}
+}
+
+func TestS3RejectedRequest(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "SignatureDoesNotMatch", http.StatusForbidden)
+	}))
+	t.Cleanup(server.Close)
+	s := newTestS3(t, server.URL, testSecretKey)
+	ctx := context.Background()
+
+	data := []byte("answer")
+	if err := s.Put(ctx, storedFile("FILE_1", data), bytes.NewReader(data)); err == nil {
+		t.Error("Put of a rejected request succeeded")
+	}
+	if _, err := s.Get(ctx, "FILE_1"); err == nil || errors.Is(err, domain.ErrFileNotFound) {
+		t.Errorf("Get of a rejected request: got error %v, want a status error", err)
+	}
+}
+
+func TestNewS3InvalidConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  config.S3
+	}{
+		{name: "empty endpoint", cfg: config.S3{Bucket: testBucket}},
+		{name: "endpoint without host", cfg: config.S3{Endpoint: "storage", Bucket: testBucket}},
+		{name: "empty bucket", cfg: config.S3{Endpoint: "http://localhost:9000"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewS3(tt.cfg); err == nil {
+				t.Error("NewS3 accepted an invalid config")
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package mock
+
+import (
+	"context"
+	"fmt"
+	"github.com/Rastaiha/bermudia/internal/service"
+	"os"
+	"path/filepath"
+)
+
+// ExportGameContent writes the stored content to dir in the layout SetGameContent consumes.
+// Passwords can not be recovered, so users.json is written empty; applying the export leaves users as they are.
+func ExportGameContent(adminService *service.Admin, dir string) error {
+	content, err := adminService.ExportContent(context.Background())
+	if err != nil {
+		return fmt.Errorf("failed to read content: %w", err)
+	}
+	for _, d := range []string{"data/territories", "data/books/islands", "data/books/pool", "data/pool_settings"} {
+		if err := os.MkdirAll(filepath.Join(dir, d), 0755); err != nil {
+			return err
+		}
+	}
+	for _, t := range content.Territories {
+		if err := writeBackData(dir, filepath.Join("data/territories", t.ID+".json"), t); err != nil {
+			return err
+		}
+	}
+	for islandId, book := range content.IslandBooks {
+		if err := writeBackData(dir, filepath.Join("data/books/islands", islandId+".json"), book); err != nil {
+			return err
+		}
+	}
+	for poolId, books := range content.PoolBooks {
+		if err := os.MkdirAll(filepath.Join(dir, "data/books/pool", poolId), 0755); err != nil {
+			return err
+		}
+		for _, book := range books {
+			if err := writeBackData(dir, filepath.Join("data/books/pool", poolId, book.BookId+".json"), book); err != nil {
+				return err
+			}
+		}
+	}
+	for _, bindings := range content.Bindings {
+		if err := writeBackData(dir, filepath.Join("data/pool_settings", bindings.TerritoryId+".json"), bindings); err != nil {
+			return err
+		}
+	}
+	return writeBackData(dir, "data/users.json", []service.User{})
+}
@@ -24,34 +24,56 @@ func FsFromURL(url string) (fs.FS, error) {
 		return nil, err
 	}
 	defer resp.Body.Close()
-	f, err := os.Create(filepath.Join(os.TempDir(), fmt.Sprintf("content_%d.zip", rand.Int31())))
+	return FsFromZip(resp.Body)
+}
+
+// FsFromZip extracts the zip file read from r into a temporary directory and returns it as a file system.
+func FsFromZip(r io.Reader) (fs.FS, error) {
+	dir, err := DirFromZip(r)
 	if err != nil {
 		return nil, err
 	}
-	defer f.Close()
-	_, err = io.Copy(f, resp.Body)
+	root := os.DirFS(dir)
+	return root, nil
+}
+
+// DirFromZip extracts the zip file read from r into a new temporary directory and returns its path.
+// The caller should remove the directory when it is done with it.
+func DirFromZip(r io.Reader) (string, error) {
+	f, err := os.CreateTemp("", "content_*.zip")
 	if err != nil {
-		return nil, err
+		return "", err
+	}
+	defer func() {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+	}()
+	_, err = io.Copy(f, r)
+	if err != nil {
+		return "", err
 	}
 
 	stat, err := f.Stat()
 	if err != nil {
-		return nil, err
+		return "", err
 	}
 
 	dir := filepath.Join(os.TempDir(), "content_"+fmt.Sprint(rand.Int31())+"/")
 	err = ExtractZip(f, stat.Size(), dir)
 	if err != nil {
-		return nil, err
+		_ = os.RemoveAll(dir)
+		return "", err
 	}
-	root := os.DirFS(dir)
-	return root, nil
+	return dir, nil
 }
 
 //go:embed data
 var DataFiles embed.FS
 
-func SetGameContent(adminService *service.Admin, files fs.FS, writeBackPath string, defaultPass string) error {
+// SetGameContent applies the content files in a single transaction, so either all of them are applied or none,
+// and records the result as a new content version by author.
+// Unless force is set, questions that have answers can not be deleted or rebound.
+func SetGameContent(adminService *service.Admin, files fs.FS, writeBackPath string, defaultPass string, author string, force bool) error {
 	slog.Info("Setting game content...")
 	if writeBackPath != "" {
 		err := os.CopyFS(writeBackPath, files)
@@ -59,22 +81,49 @@ func SetGameContent(adminService *service.Admin, files fs.FS, writeBackPath stri
 			return fmt.Errorf("could not copy fs: %w", err)
 		}
 	}
-	if err := createMockTerritories(adminService, files); err != nil {
+	ctx := context.Background()
+	return adminService.InTransaction(ctx, false, func(tx *service.Admin) error {
+		if err := setGameContent(tx, files, writeBackPath, defaultPass, force, nil); err != nil {
+			return err
+		}
+		version, err := tx.RecordContentVersion(ctx, author)
+		if err != nil {
+			return fmt.Errorf("failed to record content version: %w", err)
+		}
+		slog.Info("Game content set", slog.Int("version", int(version.Version)), slog.String("author", author))
+		return nil
+	})
+}
+
+// PreviewGameContent runs every check of SetGameContent against the stored content without applying anything,
+// and reports how the content differs from what is stored.
+func PreviewGameContent(adminService *service.Admin, files fs.FS, defaultPass string, force bool) (service.ContentDiff, error) {
+	var diff service.ContentDiff
+	err := adminService.InTransaction(context.Background(), true, func(tx *service.Admin) error {
+		return setGameContent(tx, files, "", defaultPass, force, &diff)
+	})
+	return diff, err
+}
+
+// setGameContent applies the content files. If diff is not nil, the difference of each item is added
+// to it right before the item is applied.
+func setGameContent(adminService *service.Admin, files fs.FS, writeBackPath string, defaultPass string, force bool, diff *service.ContentDiff) error {
+	if err := createMockTerritories(adminService, files, diff); err != nil {
 		return fmt.Errorf("failed to create mock territories: %w", err)
 	}
-	if err := createMockBooks(adminService, files, writeBackPath); err != nil {
+	if err := createMockBooks(adminService, files, writeBackPath, force, diff); err != nil {
 		return fmt.Errorf("failed to create mock islands: %w", err)
 	}
-	if err := createPoolSettings(adminService, files, writeBackPath); err != nil {
+	if err := createPoolSettings(adminService, files, writeBackPath, force); err != nil {
 		return fmt.Errorf("failed to create mock pool settings: %w", err)
 	}
-	if err := createMockUsers(adminService, files, writeBackPath, defaultPass); err != nil {
+	if err := createMockUsers(adminService, files, writeBackPath, defaultPass, diff); err != nil {
 		return fmt.Errorf("failed to create mock users: %w", err)
 	}
 	return nil
 }
 
-func createMockUsers(adminService *service.Admin, files fs.FS, writeBack string, defaultPass string) error {
+func createMockUsers(adminService *service.Admin, files fs.FS, writeBack string, defaultPass string, diff *service.ContentDiff) error {
 	path := "data/users.json"
 	usersJson, err := fs.ReadFile(files, path)
 	if err != nil {
@@ -92,6 +141,11 @@ func createMockUsers(adminService *service.Admin, files fs.FS, writeBack string,
 		if u.Password == "" && defaultPass != "" {
 			u.Password = defaultPass
 		}
+		if diff != nil {
+			if err := adminService.DiffUser(ctx, u, diff); err != nil {
+				return err
+			}
+		}
 		u, err := adminService.CreateUser(ctx, i, u)
 		errs = append(errs, err)
 		result = append(result, u)
@@ -102,7 +156,7 @@ func createMockUsers(adminService *service.Admin, files fs.FS, writeBack string,
 	return writeBackData(writeBack, path, result)
 }
 
-func createMockTerritories(adminService *service.Admin, territoryFiles fs.FS) error {
+func createMockTerritories(adminService *service.Admin, territoryFiles fs.FS, diff *service.ContentDiff) error {
 	ctx := context.Background()
 	return fs.WalkDir(territoryFiles, "data/territories", func(path string, d fs.DirEntry, err error) error {
 		if d.IsDir() {
@@ -119,11 +173,16 @@ func createMockTerritories(adminService *service.Admin, territoryFiles fs.FS) er
 			return err
 		}
 
+		if diff != nil {
+			if err := adminService.DiffTerritory(ctx, territory, diff); err != nil {
+				return err
+			}
+		}
 		return adminService.SetTerritory(ctx, territory)
 	})
 }
 
-func createMockBooks(adminService *service.Admin, booksFiles fs.FS, writeBack string) error {
+func createMockBooks(adminService *service.Admin, booksFiles fs.FS, writeBack string, force bool, diff *service.ContentDiff) error {
 	root := "data/books"
 	ctx := context.Background()
 	islandsDir := filepath.Join(root, "islands/")
@@ -143,13 +202,23 @@ func createMockBooks(adminService *service.Admin, booksFiles fs.FS, writeBack st
 		dir, file := filepath.Split(path)
 		if filepath.Clean(dir) == islandsDir {
 			islandId := strings.TrimSuffix(file, filepath.Ext(file))
-			book, err = adminService.SetBookAndBindToIsland(ctx, islandId, book)
+			if diff != nil {
+				if err := adminService.DiffIslandBook(ctx, islandId, book, diff); err != nil {
+					return err
+				}
+			}
+			book, err = adminService.SetBookAndBindToIsland(ctx, islandId, book, force)
 			if err != nil {
 				return err
 			}
 		} else if pool, ok := strings.CutPrefix(dir, poolDir); ok {
 			pool = strings.Trim(pool, "/")
-			book, err = adminService.SetBookAndBindToPool(ctx, pool, book)
+			if diff != nil {
+				if err := adminService.DiffPoolBook(ctx, pool, book, diff); err != nil {
+					return err
+				}
+			}
+			book, err = adminService.SetBookAndBindToPool(ctx, pool, book, force)
 			if err != nil {
 				return err
 			}
@@ -161,7 +230,7 @@ func createMockBooks(adminService *service.Admin, booksFiles fs.FS, writeBack st
 	})
 }
 
-func createPoolSettings(adminService *service.Admin, poolSettingsFiles fs.FS, writeBack string) error {
+func createPoolSettings(adminService *service.Admin, poolSettingsFiles fs.FS, writeBack string, force bool) error {
 	ctx := context.Background()
 	return fs.WalkDir(poolSettingsFiles, "data/pool_settings", func(path string, d fs.DirEntry, err error) error {
 		if d.IsDir() {
@@ -175,7 +244,7 @@ func createPoolSettings(adminService *service.Admin, poolSettingsFiles fs.FS, wr
 		if err := json.Unmarshal(content, &bindings); err != nil {
 			return err
 		}
-		bindings, err = adminService.SetTerritoryIslandBindings(ctx, bindings)
+		bindings, err = adminService.SetTerritoryIslandBindings(ctx, bindings, force)
 		if err != nil {
 			return err
 		}
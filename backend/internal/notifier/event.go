@@ -0,0 +1,178 @@
+package notifier
+
+import (
+	"github.com/Rastaiha/bermudia/internal/domain"
+	"time"
+)
+
+const (
+	EventNewAnswer         = "new_answer"
+	EventHelpRequest       = "help_request"
+	EventPendingBacklog    = "pending_backlog"
+	EventClaimReleased     = "claim_released"
+	EventStatsDigest       = "stats_digest"
+	EventCorrectionDispute = "correction_dispute"
+	// EventQueue carries the whole correction queue. It is not emitted by the notifiers,
+	// but sent to correctors when they connect, with the sequence number of the last event it reflects.
+	EventQueue = "queue"
+)
+
+// Event is the form in which notifiers other than the bot deliver correction related events.
+type Event struct {
+	Seq     int64     `json:"seq"`
+	Type    string    `json:"type"`
+	Time    time.Time `json:"time"`
+	Payload any       `json:"payload"`
+}
+
+type AnswerPayload struct {
+	UserID       int32  `json:"userId"`
+	Username     string `json:"username"`
+	Territory    string `json:"territory"`
+	QuestionID   string `json:"questionId"`
+	QuestionText string `json:"questionText"`
+	Hint         string `json:"correctionHintMessage,omitempty"`
+	FileID       string `json:"fileId,omitempty"`
+	Filename     string `json:"filename,omitempty"`
+	TextContent  string `json:"textContent,omitempty"`
+	SubmittedAt  int64  `json:"submittedAt"`
+}
+
+type HelpRequestPayload struct {
+	UserID       int32  `json:"userId"`
+	Username     string `json:"username"`
+	MeetLink     string `json:"meetLink"`
+	Territory    string `json:"territory"`
+	QuestionID   string `json:"questionId"`
+	QuestionText string `json:"questionText"`
+}
+
+type ClaimPayload struct {
+	UserID        int32  `json:"userId"`
+	QuestionID    string `json:"questionId"`
+	CorrectorID   int64  `json:"correctorId"`
+	CorrectorName string `json:"correctorName"`
+	ExpiresAt     int64  `json:"expiresAt"`
+}
+
+type CorrectorStatsPayload struct {
+	CorrectorID    int64          `json:"correctorId"`
+	CorrectorName  string         `json:"correctorName"`
+	Count          int            `json:"count"`
+	MedianDuration string         `json:"medianDuration"`
+	StatusCounts   map[string]int `json:"statusCounts"`
+}
+
+type StatsDigestPayload struct {
+	Since int64                   `json:"since"`
+	Stats []CorrectorStatsPayload `json:"stats"`
+}
+
+type CorrectionPayload struct {
+	ID            string `json:"id"`
+	UserID        int32  `json:"userId"`
+	QuestionID    string `json:"questionId"`
+	NewStatus     string `json:"newStatus"`
+	Feedback      string `json:"feedback,omitempty"`
+	CorrectorID   int64  `json:"correctorId"`
+	CorrectorName string `json:"correctorName"`
+}
+
+type DisputePayload struct {
+	UserID       int32               `json:"userId"`
+	QuestionID   string              `json:"questionId"`
+	QuestionText string              `json:"questionText"`
+	Corrections  []CorrectionPayload `json:"corrections"`
+}
+
+func correctionPayload(c domain.Correction) CorrectionPayload {
+	return CorrectionPayload{
+		ID:            c.ID,
+		UserID:        c.UserId,
+		QuestionID:    c.QuestionId,
+		NewStatus:     c.NewStatus.String(),
+		Feedback:      c.Feedback,
+		CorrectorID:   c.Corrector.ID,
+		CorrectorName: c.Corrector.Name,
+	}
+}
+
+// eventChannel implements service.CorrectionChannel by turning each callback into an Event.
+type eventChannel struct {
+	send func(Event)
+}
+
+func (c eventChannel) emit(eventType string, payload any) {
+	c.send(Event{Type: eventType, Time: time.Now().UTC(), Payload: payload})
+}
+
+func (c eventChannel) HandleNewAnswer(username string, territory string, question domain.BookQuestion, answer domain.Answer) {
+	c.emit(EventNewAnswer, AnswerPayload{
+		UserID:       answer.UserID,
+		Username:     username,
+		Territory:    territory,
+		QuestionID:   question.QuestionID,
+		QuestionText: question.Text,
+		Hint:         question.Context,
+		FileID:       answer.FileID.String,
+		Filename:     answer.Filename.String,
+		TextContent:  answer.TextContent.String,
+		SubmittedAt:  answer.UpdatedAt.UnixMilli(),
+	})
+}
+
+func (c eventChannel) HandleHelpRequest(territory string, user *domain.User, question domain.BookQuestion) error {
+	c.emit(EventHelpRequest, HelpRequestPayload{
+		UserID:       user.ID,
+		Username:     user.Username,
+		MeetLink:     user.MeetLink,
+		Territory:    territory,
+		QuestionID:   question.QuestionID,
+		QuestionText: question.Text,
+	})
+	return nil
+}
+
+func (c eventChannel) HandlePendingBacklog(backlog map[string]int) {
+	c.emit(EventPendingBacklog, backlog)
+}
+
+func (c eventChannel) HandleClaimReleased(claim domain.AnswerClaim) {
+	c.emit(EventClaimReleased, ClaimPayload{
+		UserID:        claim.UserID,
+		QuestionID:    claim.QuestionID,
+		CorrectorID:   claim.Corrector.ID,
+		CorrectorName: claim.Corrector.Name,
+		ExpiresAt:     claim.ExpiresAt.UnixMilli(),
+	})
+}
+
+func (c eventChannel) HandleStatsDigest(stats []domain.CorrectorStats, since time.Time) {
+	payload := StatsDigestPayload{Since: since.UnixMilli(), Stats: make([]CorrectorStatsPayload, 0, len(stats))}
+	for _, s := range stats {
+		statusCounts := make(map[string]int)
+		for status, count := range s.StatusCounts {
+			statusCounts[status.String()] = count
+		}
+		payload.Stats = append(payload.Stats, CorrectorStatsPayload{
+			CorrectorID:    s.Corrector.ID,
+			CorrectorName:  s.Corrector.Name,
+			Count:          s.Count,
+			MedianDuration: s.MedianDuration.String(),
+			StatusCounts:   statusCounts,
+		})
+	}
+	c.emit(EventStatsDigest, payload)
+}
+
+func (c eventChannel) HandleCorrectionDispute(dispute domain.CorrectionDispute) {
+	payload := DisputePayload{
+		UserID:       dispute.UserID,
+		QuestionID:   dispute.Question.QuestionID,
+		QuestionText: dispute.Question.Text,
+	}
+	for _, correction := range dispute.Corrections {
+		payload.Corrections = append(payload.Corrections, correctionPayload(correction))
+	}
+	c.emit(EventCorrectionDispute, payload)
+}
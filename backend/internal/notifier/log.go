@@ -0,0 +1,18 @@
+package notifier
+
+import (
+	"encoding/json"
+	"log/slog"
+)
+
+// Log is a notifier for development that only logs the correction related events.
+type Log struct {
+	eventChannel
+}
+
+func NewLog() *Log {
+	return &Log{eventChannel{send: func(e Event) {
+		payload, _ := json.Marshal(e.Payload)
+		slog.Info("correction channel event", slog.String("type", e.Type), slog.String("payload", string(payload)))
+	}}}
+}
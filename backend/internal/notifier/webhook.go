@@ -0,0 +1,95 @@
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const webhookQueueSize = 256
+
+// Webhook posts each correction related event as JSON to a configured URL.
+// If a secret is set, the hex encoded HMAC-SHA256 of the body is sent in the X-Bermudia-Signature header.
+type Webhook struct {
+	eventChannel
+	url    string
+	secret []byte
+	client *http.Client
+	seq    int64
+	events chan Event
+	wg     sync.WaitGroup
+}
+
+func NewWebhook(url string, secret string) *Webhook {
+	w := &Webhook{
+		url:    url,
+		secret: []byte(secret),
+		client: &http.Client{Timeout: 10 * time.Second},
+		events: make(chan Event, webhookQueueSize),
+	}
+	w.eventChannel = eventChannel{send: w.enqueue}
+	w.wg.Add(1)
+	go w.run()
+	return w
+}
+
+// Stop delivers the queued events and stops the webhook.
+func (w *Webhook) Stop() {
+	close(w.events)
+	w.wg.Wait()
+}
+
+func (w *Webhook) enqueue(e Event) {
+	select {
+	case w.events <- e:
+	default:
+		slog.Error("webhook queue is full; dropping event", slog.String("type", e.Type))
+	}
+}
+
+func (w *Webhook) run() {
+	defer w.wg.Done()
+	for e := range w.events {
+		w.seq++
+		e.Seq = w.seq
+		if err := w.post(e); err != nil {
+			slog.Error("failed to post webhook event", slog.String("type", e.Type), slog.String("error", err.Error()))
+		}
+	}
+}
+
+func (w *Webhook) post(e Event) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if len(w.secret) > 0 {
+		mac := hmac.New(sha256.New, w.secret)
+		mac.Write(body)
+		req.Header.Set("X-Bermudia-Signature", hex.EncodeToString(mac.Sum(nil)))
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package notifier
+
+import (
+	"sync"
+)
+
+const webQueueSize = 1000
+
+// WebQueue keeps the latest correction related events in memory
+// so that correctors can poll them over the HTTP API.
+type WebQueue struct {
+	eventChannel
+	lock    sync.Mutex
+	seq     int64
+	events  []Event
+	onEvent func(Event)
+}
+
+func NewWebQueue() *WebQueue {
+	q := &WebQueue{onEvent: func(Event) {}}
+	q.eventChannel = eventChannel{send: q.push}
+	return q
+}
+
+// OnEvent registers f to be called with every event after it is queued.
+func (q *WebQueue) OnEvent(f func(Event)) {
+	q.onEvent = f
+}
+
+func (q *WebQueue) push(e Event) {
+	q.lock.Lock()
+	q.seq++
+	e.Seq = q.seq
+	q.events = append(q.events, e)
+	if len(q.events) > webQueueSize {
+		q.events = append(q.events[:0], q.events[len(q.events)-webQueueSize:]...)
+	}
+	q.lock.Unlock()
+	q.onEvent(e)
+}
+
+// LastSeq returns the sequence number of the last queued event.
+func (q *WebQueue) LastSeq() int64 {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return q.seq
+}
+
+// Events returns the kept events whose sequence number is greater than after.
+func (q *WebQueue) Events(after int64) []Event {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	result := make([]Event, 0)
+	for _, e := range q.events {
+		if e.Seq > after {
+			result = append(result, e)
+		}
+	}
+	return result
+}
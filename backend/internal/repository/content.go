@@ -0,0 +1,101 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/Rastaiha/bermudia/internal/domain"
+)
+
+const contentVersionsSchema = `
+CREATE TABLE IF NOT EXISTS content_versions (
+    version INT4 PRIMARY KEY,
+    author VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    checksum VARCHAR(255) NOT NULL,
+    content TEXT NOT NULL
+);
+
+-- content_version_seq keeps the last version number in a single row. Taking the number from it
+-- locks the row until the version is stored, so concurrent uploads get consecutive numbers.
+CREATE TABLE IF NOT EXISTS content_version_seq (
+    id INT4 PRIMARY KEY,
+    version INT4 NOT NULL
+);
+`
+
+type sqlContentVersionRepository struct {
+	db conn
+}
+
+func NewSqlContentVersionRepository(db *sql.DB) (domain.ContentVersionStore, error) {
+	_, err := db.Exec(contentVersionsSchema)
+	if err != nil {
+		return nil, fmt.Errorf("create content_versions table: %w", err)
+	}
+	return sqlContentVersionRepository{db: db}, nil
+}
+
+func (s sqlContentVersionRepository) Create(ctx context.Context, version *domain.ContentVersion) (err error) {
+	tx, err := beginTx(ctx, s.db)
+	if err != nil {
+		return fmt.Errorf("start transaction: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			err = errors.Join(err, tx.Rollback())
+		} else {
+			err = tx.Commit()
+		}
+	}()
+	// the counter starts after the versions stored before it existed
+	err = tx.QueryRowContext(ctx,
+		`INSERT INTO content_version_seq (id, version) VALUES (1, (SELECT COALESCE(MAX(version), 0) + 1 FROM content_versions))
+		 ON CONFLICT (id) DO UPDATE SET version = content_version_seq.version + 1 RETURNING version`,
+	).Scan(&version.Version)
+	if err != nil {
+		return fmt.Errorf("get next content version: %w", err)
+	}
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO content_versions (version, author, created_at, checksum, content) VALUES ($1, $2, $3, $4, $5)`,
+		version.Version, version.Author, version.CreatedAt, version.Checksum, string(version.Content),
+	)
+	if err != nil {
+		return fmt.Errorf("insert content version: %w", err)
+	}
+	return nil
+}
+
+func (s sqlContentVersionRepository) List(ctx context.Context) (result []domain.ContentVersion, err error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT version, author, created_at, checksum FROM content_versions ORDER BY version DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("list content versions: %w", err)
+	}
+	defer func() {
+		err = errors.Join(err, rows.Close())
+	}()
+	for rows.Next() {
+		var v domain.ContentVersion
+		if err := rows.Scan(&v.Version, &v.Author, &v.CreatedAt, &v.Checksum); err != nil {
+			return nil, err
+		}
+		result = append(result, v)
+	}
+	return result, rows.Err()
+}
+
+func (s sqlContentVersionRepository) Get(ctx context.Context, version int32) (domain.ContentVersion, error) {
+	var v domain.ContentVersion
+	var content string
+	err := s.db.QueryRowContext(ctx, `SELECT version, author, created_at, checksum, content FROM content_versions WHERE version = $1`, version).
+		Scan(&v.Version, &v.Author, &v.CreatedAt, &v.Checksum, &content)
+	if errors.Is(err, sql.ErrNoRows) {
+		return v, domain.ErrContentVersionNotFound
+	}
+	if err != nil {
+		return v, err
+	}
+	v.Content = []byte(content)
+	return v, nil
+}
@@ -5,7 +5,7 @@ import (
 	"fmt"
 	"github.com/Rastaiha/bermudia/internal/config"
 	_ "github.com/jackc/pgx/v5/stdlib"
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/mattn/go-sqlite3"
 	"os"
 	"path/filepath"
 	"reflect"
@@ -16,7 +16,9 @@ func ConnectToSqlite() (*sql.DB, error) {
 	if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
 		return nil, err
 	}
-	db, err := sql.Open("sqlite3", p)
+	// transactions read before they write, so they take the write lock up front and wait for it,
+	// instead of failing when the lock of a reading transaction can not be upgraded
+	db, err := sql.Open("sqlite3", "file:"+p+"?_txlock=immediate&_busy_timeout=5000")
 	return db, err
 }
 
@@ -33,6 +35,21 @@ func ConnectToPostgres(cfg config.Postgres) (*sql.DB, error) {
 	return db, err
 }
 
+// addColumns adds the columns that were introduced after their table was created to an existing postgres table.
+// The sqlite database is recreated on every start, so its tables are always created with all their columns.
+func addColumns(db *sql.DB, table string, columns ...string) error {
+	if _, ok := db.Driver().(*sqlite3.SQLiteDriver); ok {
+		return nil
+	}
+	for _, column := range columns {
+		_, err := db.Exec(`ALTER TABLE ` + table + ` ADD COLUMN IF NOT EXISTS ` + column)
+		if err != nil {
+			return fmt.Errorf("add column to %s table: %w", table, err)
+		}
+	}
+	return nil
+}
+
 type scannable interface {
 	Scan(dest ...any) error
 }
@@ -0,0 +1,45 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/Rastaiha/bermudia/internal/domain"
+)
+
+// eventSeqsSchema keeps the last sequence number given to the events of each user.
+// Player events and inbox messages share it, so together they form one ordered stream per user.
+const eventSeqsSchema = `
+CREATE TABLE IF NOT EXISTS user_event_seqs (
+    user_id INT4 PRIMARY KEY,
+    seq INT8 NOT NULL
+);
+`
+
+// nextEventSeq returns the next sequence number of the events of the user.
+// It should run in the transaction that stores the event, so that a failed event does not take a number.
+func nextEventSeq(ctx context.Context, tx domain.Tx, userId int32) (int64, error) {
+	var seq int64
+	err := tx.QueryRowContext(ctx,
+		`INSERT INTO user_event_seqs (user_id, seq) VALUES ($1, 1)
+		 ON CONFLICT (user_id) DO UPDATE SET seq = user_event_seqs.seq + 1 RETURNING seq`,
+		userId,
+	).Scan(&seq)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get next event seq: %w", err)
+	}
+	return seq, nil
+}
+
+func lastEventSeq(ctx context.Context, tx domain.Tx, userId int32) (int64, error) {
+	var seq int64
+	err := tx.QueryRowContext(ctx, `SELECT seq FROM user_event_seqs WHERE user_id = $1`, userId).Scan(&seq)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to get last event seq: %w", err)
+	}
+	return seq, nil
+}
@@ -0,0 +1,141 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/Rastaiha/bermudia/internal/domain"
+	"time"
+)
+
+const feedbackTemplatesSchema = `
+CREATE TABLE IF NOT EXISTS feedback_templates (
+    id VARCHAR(255) PRIMARY KEY,
+    question_id VARCHAR(255) NOT NULL,
+    territory_id VARCHAR(255) NOT NULL,
+    text TEXT NOT NULL,
+    from_content BOOLEAN NOT NULL,
+    usage_count INT4 NOT NULL DEFAULT 0,
+    created_by INT8 NOT NULL,
+    creator_name VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_feedback_templates_question_id ON feedback_templates (question_id);
+CREATE INDEX IF NOT EXISTS idx_feedback_templates_territory_id ON feedback_templates (territory_id);
+`
+
+type sqlFeedbackTemplateRepository struct {
+	db conn
+}
+
+func NewSqlFeedbackTemplateRepository(db *sql.DB) (domain.FeedbackTemplateStore, error) {
+	_, err := db.Exec(feedbackTemplatesSchema)
+	if err != nil {
+		return nil, fmt.Errorf("create feedback_templates table: %w", err)
+	}
+	return sqlFeedbackTemplateRepository{db: db}, nil
+}
+
+func (s sqlFeedbackTemplateRepository) columnsToSelect() string {
+	return `id, question_id, territory_id, text, from_content, usage_count, created_by, creator_name, created_at`
+}
+
+func (s sqlFeedbackTemplateRepository) scan(row scannable, t *domain.FeedbackTemplate) error {
+	return row.Scan(&t.ID, &t.QuestionID, &t.TerritoryID, &t.Text, &t.FromContent, &t.UsageCount, &t.CreatedBy.ID, &t.CreatedBy.Name, &t.CreatedAt)
+}
+
+func (s sqlFeedbackTemplateRepository) SetQuestionTemplates(ctx context.Context, questionId string, texts []string) (err error) {
+	tx, err := beginTx(ctx, s.db)
+	if err != nil {
+		return fmt.Errorf("start transaction: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			err = errors.Join(err, tx.Rollback())
+		} else {
+			err = tx.Commit()
+		}
+	}()
+	// keep usage counts of texts that did not change
+	usages := make(map[string]int)
+	rows, err := tx.QueryContext(ctx, `SELECT text, usage_count FROM feedback_templates WHERE question_id = $1 AND from_content = TRUE`, questionId)
+	if err != nil {
+		return fmt.Errorf("get question templates: %w", err)
+	}
+	for rows.Next() {
+		var text string
+		var usage int
+		if err := rows.Scan(&text, &usage); err != nil {
+			_ = rows.Close()
+			return err
+		}
+		usages[text] = usage
+	}
+	if err := rows.Close(); err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `DELETE FROM feedback_templates WHERE question_id = $1 AND from_content = TRUE`, questionId)
+	if err != nil {
+		return fmt.Errorf("delete question templates: %w", err)
+	}
+	now := time.Now().UTC()
+	for _, text := range texts {
+		_, err = tx.ExecContext(ctx,
+			`INSERT INTO feedback_templates (id, question_id, territory_id, text, from_content, usage_count, created_by, creator_name, created_at)
+			 VALUES ($1, $2, '', $3, TRUE, $4, 0, '', $5)`,
+			domain.NewID(domain.ResourceTypeFeedbackTemplate), questionId, text, usages[text], now,
+		)
+		if err != nil {
+			return fmt.Errorf("insert question template: %w", err)
+		}
+	}
+	return nil
+}
+
+func (s sqlFeedbackTemplateRepository) CreateTemplate(ctx context.Context, t domain.FeedbackTemplate) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO feedback_templates (id, question_id, territory_id, text, from_content, usage_count, created_by, creator_name, created_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		t.ID, t.QuestionID, t.TerritoryID, t.Text, t.FromContent, t.UsageCount, t.CreatedBy.ID, t.CreatedBy.Name, t.CreatedAt.UTC(),
+	)
+	return err
+}
+
+func (s sqlFeedbackTemplateRepository) GetTemplate(ctx context.Context, id string) (domain.FeedbackTemplate, error) {
+	var t domain.FeedbackTemplate
+	err := s.scan(s.db.QueryRowContext(ctx, `SELECT `+s.columnsToSelect()+` FROM feedback_templates WHERE id = $1`, id), &t)
+	if errors.Is(err, sql.ErrNoRows) {
+		return t, domain.ErrFeedbackTemplateNotFound
+	}
+	return t, err
+}
+
+func (s sqlFeedbackTemplateRepository) GetTemplates(ctx context.Context, questionId string, territoryId string) (result []domain.FeedbackTemplate, err error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+s.columnsToSelect()+` FROM feedback_templates
+		 WHERE (question_id = $1 AND question_id != '') OR (territory_id = $2 AND territory_id != '')
+		 ORDER BY usage_count DESC, created_at`,
+		questionId, territoryId,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		closeErr := rows.Close()
+		err = errors.Join(err, closeErr)
+	}()
+	for rows.Next() {
+		var t domain.FeedbackTemplate
+		if err := s.scan(rows, &t); err != nil {
+			return nil, err
+		}
+		result = append(result, t)
+	}
+	return result, rows.Err()
+}
+
+func (s sqlFeedbackTemplateRepository) IncrementUsage(ctx context.Context, id string) error {
+	_, err := s.db.ExecContext(ctx, `UPDATE feedback_templates SET usage_count = usage_count + 1 WHERE id = $1`, id)
+	return err
+}
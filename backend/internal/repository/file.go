@@ -0,0 +1,52 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/Rastaiha/bermudia/internal/domain"
+)
+
+const filesSchema = `
+CREATE TABLE IF NOT EXISTS files (
+    id VARCHAR(255) PRIMARY KEY,
+    owner_id INT4 NOT NULL,
+    filename VARCHAR(255) NOT NULL,
+    mime_type VARCHAR(255) NOT NULL,
+    size INT8 NOT NULL,
+    sha256 VARCHAR(64) NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
+`
+
+type sqlFileRepository struct {
+	db *sql.DB
+}
+
+func NewSqlFileRepository(db *sql.DB) (domain.FileMetadataStore, error) {
+	_, err := db.Exec(filesSchema)
+	if err != nil {
+		return nil, fmt.Errorf("create files table: %w", err)
+	}
+	return sqlFileRepository{db: db}, nil
+}
+
+func (s sqlFileRepository) CreateFile(ctx context.Context, file domain.StoredFile) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO files (id, owner_id, filename, mime_type, size, sha256, created_at) VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		file.ID, file.OwnerID, file.Filename, file.MimeType, file.Size, file.SHA256, file.CreatedAt.UTC(),
+	)
+	return err
+}
+
+func (s sqlFileRepository) GetFile(ctx context.Context, id string) (domain.StoredFile, error) {
+	var file domain.StoredFile
+	err := s.db.QueryRowContext(ctx,
+		`SELECT id, owner_id, filename, mime_type, size, sha256, created_at FROM files WHERE id = $1`, id,
+	).Scan(&file.ID, &file.OwnerID, &file.Filename, &file.MimeType, &file.Size, &file.SHA256, &file.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return file, domain.ErrFileNotFound
+	}
+	return file, err
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/Rastaiha/bermudia/internal/domain"
 	"time"
@@ -14,14 +15,19 @@ CREATE TABLE IF NOT EXISTS inbox_messages (
     id VARCHAR NOT NULL PRIMARY KEY,
 	user_id INT4 NOT NULL,
 	content TEXT NOT NULL,
-	created_at TIMESTAMP NOT NULL
+	created_at TIMESTAMP NOT NULL,
+	seq INT8 NOT NULL DEFAULT 0
 );
 
 CREATE INDEX IF NOT EXISTS idx_inbox_messages_user_created_at ON inbox_messages(user_id, created_at);
 `
 
+const inboxSeqIndex = `
+CREATE INDEX IF NOT EXISTS idx_inbox_messages_user_seq ON inbox_messages(user_id, seq);
+`
+
 type sqlInboxRepository struct {
-	db *sql.DB
+	db conn
 }
 
 func NewSqlInboxRepository(db *sql.DB) (domain.InboxStore, error) {
@@ -29,24 +35,84 @@ func NewSqlInboxRepository(db *sql.DB) (domain.InboxStore, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to create inbox_messages table: %w", err)
 	}
+	err = addColumns(db, "inbox_messages", "seq INT8 NOT NULL DEFAULT 0")
+	if err != nil {
+		return nil, err
+	}
+	_, err = db.Exec(inboxSeqIndex)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create inbox_messages seq index: %w", err)
+	}
+	_, err = db.Exec(eventSeqsSchema)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create user_event_seqs table: %w", err)
+	}
 	return sqlInboxRepository{db: db}, nil
 }
 
-func (s sqlInboxRepository) CreateMessage(ctx context.Context, tx domain.Tx, msg domain.InboxMessage) error {
+func (s sqlInboxRepository) CreateMessage(ctx context.Context, tx domain.Tx, msg domain.InboxMessage) (seq int64, err error) {
+	contentData, err := json.Marshal(msg.Content)
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal message content: %w", err)
+	}
+
 	if tx == nil {
-		tx = s.db
+		var ownTx txConn
+		ownTx, err = beginTx(ctx, s.db)
+		if err != nil {
+			return 0, fmt.Errorf("start transaction: %w", err)
+		}
+		defer func() {
+			if err != nil {
+				err = errors.Join(err, ownTx.Rollback())
+			} else {
+				err = ownTx.Commit()
+			}
+		}()
+		tx = ownTx
 	}
 
-	contentData, err := json.Marshal(msg.Content)
+	seq, err = nextEventSeq(ctx, tx, msg.UserID)
 	if err != nil {
-		return fmt.Errorf("failed to marshal message content: %w", err)
+		return 0, err
 	}
-
 	_, err = tx.ExecContext(ctx,
-		`INSERT INTO inbox_messages (id, user_id, content, created_at) VALUES ($1, $2, $3, $4)`,
-		n(msg.ID), n(msg.UserID), contentData, msg.CreatedAt,
+		`INSERT INTO inbox_messages (id, user_id, content, created_at, seq) VALUES ($1, $2, $3, $4, $5)`,
+		n(msg.ID), n(msg.UserID), contentData, msg.CreatedAt, seq,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return seq, nil
+}
+
+func (s sqlInboxRepository) GetMessagesAfter(ctx context.Context, userId int32, seq int64, limit int) (messages []domain.InboxMessage, err error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT id, user_id, content, created_at, seq
+		 FROM inbox_messages
+		 WHERE user_id = $1 AND seq > $2
+		 ORDER BY seq
+		 LIMIT $3`,
+		userId, seq, limit,
 	)
-	return err
+	if err != nil {
+		return nil, fmt.Errorf("failed to query inbox messages: %w", err)
+	}
+	defer func() {
+		err = errors.Join(err, rows.Close())
+	}()
+	for rows.Next() {
+		var msg domain.InboxMessage
+		var contentData []byte
+		if err := rows.Scan(&msg.ID, &msg.UserID, &contentData, &msg.CreatedAt, &msg.Seq); err != nil {
+			return nil, fmt.Errorf("failed to scan inbox message row: %w", err)
+		}
+		if err := json.Unmarshal(contentData, &msg.Content); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal message content: %w", err)
+		}
+		messages = append(messages, msg)
+	}
+	return messages, rows.Err()
 }
 
 func (s sqlInboxRepository) GetMessages(ctx context.Context, userId int32, before time.Time, limit int) ([]domain.InboxMessage, error) {
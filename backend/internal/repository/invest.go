@@ -43,7 +43,7 @@ func NewSqlInvestRepository(db *sql.DB) (domain.InvestStore, error) {
 }
 
 type sqlInvestStore struct {
-	db *sql.DB
+	db conn
 }
 
 func (s *sqlInvestStore) GetSession(ctx context.Context, id string) (*domain.InvestmentSession, error) {
@@ -71,7 +71,7 @@ CREATE TABLE IF NOT EXISTS user_portable_islands (
 )
 
 type sqlIslandRepository struct {
-	db *sql.DB
+	db conn
 }
 
 func NewSqlIslandRepository(db *sql.DB) (domain.IslandStore, error) {
@@ -159,7 +159,7 @@ func (s sqlIslandRepository) scanIslandHeader(row scannable, header *domain.Isla
 }
 
 func (s sqlIslandRepository) GetIslandHeadersByTerritory(ctx context.Context, territoryId string) (result []domain.IslandHeader, err error) {
-	rows, err := s.db.QueryContext(ctx, `SELECT `+s.islandHeaderColumnsToSelect()+` WHERE territory_id = $1`, territoryId)
+	rows, err := s.db.QueryContext(ctx, `SELECT `+s.islandHeaderColumnsToSelect()+` FROM islands WHERE territory_id = $1 ORDER BY id`, territoryId)
 	if err != nil {
 		return nil, fmt.Errorf("get island headers by territory %q: %w", territoryId, err)
 	}
@@ -287,6 +287,25 @@ func (s sqlIslandRepository) GetPoolOfBook(ctx context.Context, bookId string) (
 	return
 }
 
+func (s sqlIslandRepository) GetPoolBooks(ctx context.Context) (result map[string][]string, err error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT pool_id, book_id FROM book_pools ORDER BY pool_id, book_id`)
+	if err != nil {
+		return nil, fmt.Errorf("get pool books: %w", err)
+	}
+	defer func() {
+		err = errors.Join(err, rows.Close())
+	}()
+	result = make(map[string][]string)
+	for rows.Next() {
+		var poolId, bookId string
+		if err := rows.Scan(&poolId, &bookId); err != nil {
+			return nil, fmt.Errorf("scan pool book: %w", err)
+		}
+		result[poolId] = append(result[poolId], bookId)
+	}
+	return result, rows.Err()
+}
+
 func (s sqlIslandRepository) AssignBookToIslandFromPool(ctx context.Context, territoryId string, islandId string, userId int32) (bookId string, err error) {
 	poolCount, err := s.GetTerritoryPoolSettings(ctx, territoryId)
 	if err != nil {
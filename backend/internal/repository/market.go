@@ -25,7 +25,7 @@ CREATE INDEX IF NOT EXISTS idx_trade_offers_created_at ON trade_offers(deleted_a
 `
 
 type sqlMarketRepository struct {
-	db *sql.DB
+	db conn
 }
 
 func NewSqlMarketRepository(db *sql.DB) (domain.MarketStore, error) {
@@ -0,0 +1,110 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/Rastaiha/bermudia/internal/domain"
+	"time"
+)
+
+// outboxSchema keeps the events to be dispatched. next_attempt_at is NULL for abandoned messages.
+const outboxSchema = `
+CREATE TABLE IF NOT EXISTS outbox_messages (
+    id VARCHAR(255) PRIMARY KEY,
+    kind VARCHAR(64) NOT NULL,
+    payload TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    attempts INT4 NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP,
+    last_error TEXT NOT NULL DEFAULT '',
+    dispatched_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_outbox_messages_due ON outbox_messages(dispatched_at, next_attempt_at);
+`
+
+type sqlOutboxRepository struct {
+	db conn
+}
+
+func NewSqlOutboxRepository(db *sql.DB) (domain.OutboxStore, error) {
+	_, err := db.Exec(outboxSchema)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create outbox_messages table: %w", err)
+	}
+	return sqlOutboxRepository{db: db}, nil
+}
+
+func (s sqlOutboxRepository) Add(ctx context.Context, tx domain.Tx, msg domain.OutboxMessage) error {
+	if tx == nil {
+		tx = s.db
+	}
+	_, err := tx.ExecContext(ctx,
+		`INSERT INTO outbox_messages (id, kind, payload, created_at, next_attempt_at) VALUES ($1, $2, $3, $4, $5)`,
+		n(msg.ID), n(msg.Kind), string(msg.Payload), msg.CreatedAt, msg.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to add outbox message: %w", err)
+	}
+	return nil
+}
+
+func (s sqlOutboxRepository) GetDue(ctx context.Context, now time.Time, limit int) (result []domain.OutboxMessage, err error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT id, kind, payload, created_at FROM outbox_messages
+		 WHERE dispatched_at IS NULL AND next_attempt_at <= $1 ORDER BY created_at LIMIT $2`,
+		now, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query outbox messages: %w", err)
+	}
+	defer func() {
+		err = errors.Join(err, rows.Close())
+	}()
+	for rows.Next() {
+		var msg domain.OutboxMessage
+		var payload string
+		if err := rows.Scan(&msg.ID, &msg.Kind, &payload, &msg.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan outbox message: %w", err)
+		}
+		msg.Payload = []byte(payload)
+		result = append(result, msg)
+	}
+	return result, rows.Err()
+}
+
+func (s sqlOutboxRepository) Claim(ctx context.Context, id string, now, until time.Time) (int, bool, error) {
+	var attempts int
+	err := s.db.QueryRowContext(ctx,
+		`UPDATE outbox_messages SET next_attempt_at = $1, attempts = attempts + 1
+		 WHERE id = $2 AND dispatched_at IS NULL AND next_attempt_at <= $3 RETURNING attempts`,
+		until, id, now,
+	).Scan(&attempts)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to claim outbox message: %w", err)
+	}
+	return attempts, true, nil
+}
+
+func (s sqlOutboxRepository) MarkDispatched(ctx context.Context, id string, at time.Time) error {
+	_, err := s.db.ExecContext(ctx, `UPDATE outbox_messages SET dispatched_at = $1 WHERE id = $2`, at, id)
+	return err
+}
+
+func (s sqlOutboxRepository) MarkFailed(ctx context.Context, id string, lastError string, nextAttemptAt *time.Time) error {
+	_, err := s.db.ExecContext(ctx,
+		`UPDATE outbox_messages SET last_error = $1, next_attempt_at = $2 WHERE id = $3`,
+		lastError, nextAttemptAt, id,
+	)
+	return err
+}
+
+func (s sqlOutboxRepository) DeleteDispatchedBefore(ctx context.Context, before time.Time) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM outbox_messages WHERE dispatched_at < $1`, before)
+	return err
+}
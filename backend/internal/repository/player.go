@@ -23,6 +23,7 @@ CREATE TABLE IF NOT EXISTS players (
     blue_key INT4 NOT NULL,
     golden_key INT4 NOT NULL,
     master_key INT4 NOT NULL,
+    hidden_on_map BOOLEAN NOT NULL DEFAULT FALSE,
     visited_territories TEXT NOT NULL,
     updated_at TIMESTAMP NOT NULL
 );
@@ -35,6 +36,7 @@ CREATE TABLE IF NOT EXISTS player_events (
 	created_at TIMESTAMP NOT NULL,
 	reason VARCHAR(255) NOT NULL,
 	player_data JSONB NOT NULL,
+	seq INT8 NOT NULL DEFAULT 0,
 	FOREIGN KEY (user_id) REFERENCES players(user_id)
 );
 
@@ -42,8 +44,12 @@ CREATE INDEX IF NOT EXISTS idx_player_events_user_id_created_at ON player_events
 CREATE INDEX IF NOT EXISTS idx_player_events_user_id_reason_created_at ON player_events(user_id, reason, created_at DESC);
 `
 
+const playerEventsSeqIndex = `
+CREATE INDEX IF NOT EXISTS idx_player_events_user_id_seq ON player_events(user_id, seq);
+`
+
 type sqlPlayerRepository struct {
-	db *sql.DB
+	db conn
 }
 
 func NewSqlPlayerRepository(db *sql.DB) (domain.PlayerStore, error) {
@@ -51,11 +57,27 @@ func NewSqlPlayerRepository(db *sql.DB) (domain.PlayerStore, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to create players table: %w", err)
 	}
+	err = addColumns(db, "players", "hidden_on_map BOOLEAN NOT NULL DEFAULT FALSE")
+	if err != nil {
+		return nil, err
+	}
 
 	_, err = db.Exec(playerEventsSchema)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create player_events table: %w", err)
 	}
+	err = addColumns(db, "player_events", "seq INT8 NOT NULL DEFAULT 0")
+	if err != nil {
+		return nil, err
+	}
+	_, err = db.Exec(playerEventsSeqIndex)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create player_events seq index: %w", err)
+	}
+	_, err = db.Exec(eventSeqsSchema)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create user_event_seqs table: %w", err)
+	}
 
 	return sqlPlayerRepository{db: db}, nil
 }
@@ -92,9 +114,9 @@ func (s sqlPlayerRepository) Get(ctx context.Context, userId int32) (domain.Play
 	var visitedTerritories []byte
 	var p domain.Player
 	err := s.db.QueryRowContext(ctx,
-		`SELECT user_id, at_territory, at_island, anchored, fuel, fuel_cap, coin, red_key, blue_key, golden_key, master_key, visited_territories, updated_at FROM players WHERE user_id = $1`,
+		`SELECT user_id, at_territory, at_island, anchored, fuel, fuel_cap, coin, red_key, blue_key, golden_key, master_key, hidden_on_map, visited_territories, updated_at FROM players WHERE user_id = $1`,
 		userId,
-	).Scan(&p.UserId, &p.AtTerritory, &p.AtIsland, &p.Anchored, &p.Fuel, &p.FuelCap, &p.Coin, &p.RedKey, &p.BlueKey, &p.GoldenKey, &p.MasterKey, &visitedTerritories, &p.UpdatedAt)
+	).Scan(&p.UserId, &p.AtTerritory, &p.AtIsland, &p.Anchored, &p.Fuel, &p.FuelCap, &p.Coin, &p.RedKey, &p.BlueKey, &p.GoldenKey, &p.MasterKey, &p.HiddenOnMap, &visitedTerritories, &p.UpdatedAt)
 
 	if err != nil {
 		return domain.Player{}, fmt.Errorf("failed to get player from db: %w", err)
@@ -122,9 +144,9 @@ func (s sqlPlayerRepository) update(ctx context.Context, tx domain.Tx, old, upda
 	}
 	cmd, err := tx.ExecContext(ctx,
 		`UPDATE players
-		 SET at_territory = $1, at_island = $2, anchored = $3, fuel = $4, fuel_cap = $5, coin = $6, red_key = $7, blue_key = $8, golden_key = $9, master_key = $10, visited_territories = $11, updated_at = $12
-		 WHERE user_id = $13 AND updated_at = $14`,
-		n(updated.AtTerritory), n(updated.AtIsland), updated.Anchored, updated.Fuel, n(updated.FuelCap), updated.Coin, updated.RedKey, updated.BlueKey, updated.GoldenKey, updated.MasterKey, visitedTerritories, updated.UpdatedAt,
+		 SET at_territory = $1, at_island = $2, anchored = $3, fuel = $4, fuel_cap = $5, coin = $6, red_key = $7, blue_key = $8, golden_key = $9, master_key = $10, visited_territories = $11, hidden_on_map = $12, updated_at = $13
+		 WHERE user_id = $14 AND updated_at = $15`,
+		n(updated.AtTerritory), n(updated.AtIsland), updated.Anchored, updated.Fuel, n(updated.FuelCap), updated.Coin, updated.RedKey, updated.BlueKey, updated.GoldenKey, updated.MasterKey, visitedTerritories, updated.HiddenOnMap, updated.UpdatedAt,
 		old.UserId, old.UpdatedAt,
 	)
 	if err != nil {
@@ -158,39 +180,90 @@ func (s sqlPlayerRepository) GetAll(ctx context.Context) ([]int32, error) {
 	return result, rows.Err()
 }
 
-func (s sqlPlayerRepository) CreatePlayerEvent(ctx context.Context, userId int32, createdAt time.Time, reason string, player domain.FullPlayer) error {
+func (s sqlPlayerRepository) CreatePlayerEvent(ctx context.Context, tx domain.Tx, userId int32, createdAt time.Time, reason string, player domain.FullPlayer) (seq int64, err error) {
 	playerData, err := json.Marshal(player)
 	if err != nil {
-		return fmt.Errorf("failed to marshal player data: %w", err)
+		return 0, fmt.Errorf("failed to marshal player data: %w", err)
 	}
 
-	_, err = s.db.ExecContext(ctx,
-		`INSERT INTO player_events (user_id, created_at, reason, player_data) VALUES ($1, $2, $3, $4)`,
-		userId, createdAt, reason, playerData,
+	if tx == nil {
+		var ownTx txConn
+		ownTx, err = beginTx(ctx, s.db)
+		if err != nil {
+			return 0, fmt.Errorf("start transaction: %w", err)
+		}
+		defer func() {
+			if err != nil {
+				err = errors.Join(err, ownTx.Rollback())
+			} else {
+				err = ownTx.Commit()
+			}
+		}()
+		tx = ownTx
+	}
+	seq, err = nextEventSeq(ctx, tx, userId)
+	if err != nil {
+		return 0, err
+	}
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO player_events (user_id, created_at, reason, player_data, seq) VALUES ($1, $2, $3, $4, $5)`,
+		userId, createdAt, reason, playerData, seq,
 	)
 	if err != nil {
-		return fmt.Errorf("failed to create player event: %w", err)
+		return 0, fmt.Errorf("failed to create player event: %w", err)
 	}
 
-	return nil
+	return seq, nil
 }
 
-func (s sqlPlayerRepository) GetLocations(ctx context.Context, territoryID string) (map[string][]int32, error) {
-	rows, err := s.db.QueryContext(ctx, `SELECT at_island, user_id FROM players WHERE at_territory = $1 `, territoryID)
+func (s sqlPlayerRepository) GetPlayerEventsAfter(ctx context.Context, userId int32, seq int64, limit int) (result []domain.FullPlayerUpdateEvent, err error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT seq, reason, player_data FROM player_events WHERE user_id = $1 AND seq > $2 ORDER BY seq LIMIT $3`,
+		userId, seq, limit,
+	)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("failed to query player events: %w", err)
 	}
-	defer rows.Close()
+	defer func() {
+		err = errors.Join(err, rows.Close())
+	}()
+	for rows.Next() {
+		var event domain.FullPlayerUpdateEvent
+		var playerData []byte
+		if err := rows.Scan(&event.Seq, &event.Reason, &playerData); err != nil {
+			return nil, fmt.Errorf("failed to scan player event: %w", err)
+		}
+		event.Player = new(domain.FullPlayer)
+		if err := json.Unmarshal(playerData, event.Player); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal player data: %w", err)
+		}
+		result = append(result, event)
+	}
+	return result, rows.Err()
+}
 
-	result := make(map[string][]int32)
+func (s sqlPlayerRepository) GetLastEventSeq(ctx context.Context, userId int32) (int64, error) {
+	return lastEventSeq(ctx, s.db, userId)
+}
+
+func (s sqlPlayerRepository) GetLocations(ctx context.Context, territoryID string) (result []domain.PlayerLocation, err error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT p.user_id, u.name, p.at_island FROM players p JOIN users u ON u.id = p.user_id
+		 WHERE p.at_territory = $1 AND NOT p.hidden_on_map ORDER BY p.user_id`,
+		territoryID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		err = errors.Join(err, rows.Close())
+	}()
 	for rows.Next() {
-		var islandId string
-		var userId int32
-		err := rows.Scan(&islandId, &userId)
-		if err != nil {
+		var l domain.PlayerLocation
+		if err := rows.Scan(&l.UserId, &l.Name, &l.IslandID); err != nil {
 			return nil, err
 		}
-		result[islandId] = append(result[islandId], userId)
+		result = append(result, l)
 	}
-	return result, nil
+	return result, rows.Err()
 }
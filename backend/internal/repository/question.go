@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"strings"
 	"time"
 
 	"github.com/Rastaiha/bermudia/internal/domain"
@@ -19,7 +20,10 @@ CREATE TABLE IF NOT EXISTS questions (
     text TEXT NOT NULL,
     context TEXT NOT NULL,
     knowledge_amount INT4 NOT NULL,
-    reward_source VARCHAR(255)
+    reward_source VARCHAR(255),
+    input_type VARCHAR(255) NOT NULL DEFAULT '',
+    input_accept TEXT NOT NULL DEFAULT '',
+    max_file_size INT8 NOT NULL DEFAULT 0
 );
 CREATE INDEX IF NOT EXISTS idx_questions_book_id ON questions (book_id);
 `
@@ -48,14 +52,43 @@ CREATE TABLE IF NOT EXISTS corrections (
     status INT4 NOT NULL,
     new_status INT4 NOT NULL,
     feedback TEXT NOT NULL,
+    corrector_id INT8 NOT NULL DEFAULT 0,
+    corrector_name VARCHAR(255) NOT NULL DEFAULT '',
+    submitted_at TIMESTAMP,
+    finalized_at TIMESTAMP,
     updated_at TIMESTAMP NOT NULL
 );
 CREATE INDEX IF NOT EXISTS idx_corrections_applied_updated_at ON corrections (status, updated_at);
+`
+	correctionsFinalizedAtIndex = `
+CREATE INDEX IF NOT EXISTS idx_corrections_finalized_at ON corrections (finalized_at);
+`
+	answerClaimsSchema = `
+CREATE TABLE IF NOT EXISTS answer_claims (
+    user_id INT4 NOT NULL,
+    question_id VARCHAR(255) NOT NULL,
+    claimed_by INT8 NOT NULL,
+    claimer_name VARCHAR(255) NOT NULL,
+    chat_id INT8 NOT NULL,
+    message_id INT4 NOT NULL,
+    claimed_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (question_id, user_id)
+);
+CREATE INDEX IF NOT EXISTS idx_answer_claims_expires_at ON answer_claims (expires_at);
+`
+	answerRemindersSchema = `
+CREATE TABLE IF NOT EXISTS answer_reminders (
+    user_id INT4 NOT NULL,
+    question_id VARCHAR(255) NOT NULL,
+    reminded_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (question_id, user_id)
+);
 `
 )
 
 type sqlQuestionRepository struct {
-	db *sql.DB
+	db conn
 }
 
 func NewSqlQuestionRepository(db *sql.DB) (domain.QuestionStore, error) {
@@ -63,6 +96,14 @@ func NewSqlQuestionRepository(db *sql.DB) (domain.QuestionStore, error) {
 	if err != nil {
 		return nil, fmt.Errorf("create questions table: %w", err)
 	}
+	err = addColumns(db, "questions",
+		"input_type VARCHAR(255) NOT NULL DEFAULT ''",
+		"input_accept TEXT NOT NULL DEFAULT ''",
+		"max_file_size INT8 NOT NULL DEFAULT 0",
+	)
+	if err != nil {
+		return nil, err
+	}
 	_, err = db.Exec(answersSchema)
 	if err != nil {
 		return nil, fmt.Errorf("create answers table: %w", err)
@@ -71,13 +112,34 @@ func NewSqlQuestionRepository(db *sql.DB) (domain.QuestionStore, error) {
 	if err != nil {
 		return nil, fmt.Errorf("create corrections table: %w", err)
 	}
+	err = addColumns(db, "corrections",
+		"corrector_id INT8 NOT NULL DEFAULT 0",
+		"corrector_name VARCHAR(255) NOT NULL DEFAULT ''",
+		"submitted_at TIMESTAMP",
+		"finalized_at TIMESTAMP",
+	)
+	if err != nil {
+		return nil, err
+	}
+	_, err = db.Exec(correctionsFinalizedAtIndex)
+	if err != nil {
+		return nil, fmt.Errorf("create corrections finalized_at index: %w", err)
+	}
+	_, err = db.Exec(answerClaimsSchema)
+	if err != nil {
+		return nil, fmt.Errorf("create answer_claims table: %w", err)
+	}
+	_, err = db.Exec(answerRemindersSchema)
+	if err != nil {
+		return nil, fmt.Errorf("create answer_reminders table: %w", err)
+	}
 	return sqlQuestionRepository{
 		db: db,
 	}, nil
 }
 
 func (s sqlQuestionRepository) BindQuestionsToBook(ctx context.Context, bookId string, questions []domain.BookQuestion) (err error) {
-	tx, err := s.db.BeginTx(ctx, nil)
+	tx, err := beginTx(ctx, s.db)
 	if err != nil {
 		return fmt.Errorf("start transaction: %w", err)
 	}
@@ -94,9 +156,9 @@ func (s sqlQuestionRepository) BindQuestionsToBook(ctx context.Context, bookId s
 	}
 	for _, q := range questions {
 		_, err = tx.ExecContext(ctx,
-			`INSERT INTO questions (question_id, book_id, text, context, knowledge_amount, reward_source) VALUES ($1, $2, $3, $4, $5, $6)
-					ON CONFLICT (question_id) DO UPDATE SET book_id = $2, text = $3, context = $4, knowledge_amount = $5, reward_source = $6`,
-			n(q.QuestionID), n(bookId), n(q.Text), q.Context, q.KnowledgeAmount, n(q.RewardSource),
+			`INSERT INTO questions (question_id, book_id, text, context, knowledge_amount, reward_source, input_type, input_accept, max_file_size) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+					ON CONFLICT (question_id) DO UPDATE SET book_id = $2, text = $3, context = $4, knowledge_amount = $5, reward_source = $6, input_type = $7, input_accept = $8, max_file_size = $9`,
+			n(q.QuestionID), n(bookId), n(q.Text), q.Context, q.KnowledgeAmount, n(q.RewardSource), q.InputType, strings.Join(q.InputAccept, ","), q.MaxFileSize,
 		)
 		if err != nil {
 			return fmt.Errorf("insert questions: %w", err)
@@ -105,6 +167,33 @@ func (s sqlQuestionRepository) BindQuestionsToBook(ctx context.Context, bookId s
 	return nil
 }
 
+func (s sqlQuestionRepository) CountBookAnswers(ctx context.Context, bookId string) (result map[string]int, err error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT a.question_id, COUNT(*) FROM answers a
+		 JOIN questions q ON q.question_id = a.question_id
+		 WHERE q.book_id = $1 AND a.status != $2
+		 GROUP BY a.question_id ;`,
+		bookId, domain.AnswerStatusEmpty,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		closeErr := rows.Close()
+		err = errors.Join(err, closeErr)
+	}()
+	result = make(map[string]int)
+	for rows.Next() {
+		var questionId string
+		var count int
+		if err := rows.Scan(&questionId, &count); err != nil {
+			return nil, err
+		}
+		result[questionId] = count
+	}
+	return result, rows.Err()
+}
+
 func (s sqlQuestionRepository) answerColumnsToSelect() string {
 	return `user_id, question_id, status, requested_help, help_state, file_id, filename, text_content, feedback, created_at, updated_at`
 }
@@ -149,22 +238,134 @@ func (s sqlQuestionRepository) GetAnswer(ctx context.Context, userId int32, ques
 	return answer, nil
 }
 
-func (s sqlQuestionRepository) GetPendingAnswers(ctx context.Context, ifBefore time.Time) ([]domain.Answer, error) {
-	var answers []domain.Answer
-	rows, err := s.db.QueryContext(ctx, `SELECT `+s.answerColumnsToSelect()+` FROM answers WHERE status = $1 AND updated_at < $2`, domain.AnswerStatusPending, ifBefore.UTC())
+func (s sqlQuestionRepository) GetPendingBacklog(ctx context.Context, ifBefore time.Time) (result map[string]int, err error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT CASE WHEN i.from_pool THEN '' ELSE COALESCE(i.territory_id, '') END AS territory_id, COUNT(*)
+		 FROM answers a
+		 JOIN questions q ON q.question_id = a.question_id
+		 LEFT JOIN user_books ub ON ub.user_id = a.user_id AND ub.book_id = q.book_id
+		 LEFT JOIN islands i ON i.id = COALESCE(ub.island_id, (SELECT bi.id FROM islands bi WHERE bi.book_id = q.book_id LIMIT 1))
+		 WHERE a.status = $1 AND a.updated_at < $2
+		 GROUP BY 1 ;`,
+		domain.AnswerStatusPending, ifBefore.UTC(),
+	)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
+	defer func() {
+		closeErr := rows.Close()
+		err = errors.Join(err, closeErr)
+	}()
+	result = make(map[string]int)
 	for rows.Next() {
-		var answer domain.Answer
-		err := s.scanAnswer(rows, &answer)
+		var territoryId string
+		var count int
+		if err := rows.Scan(&territoryId, &count); err != nil {
+			return nil, err
+		}
+		result[territoryId] = count
+	}
+	return result, rows.Err()
+}
+
+func (s sqlQuestionRepository) GetCorrectionQueue(ctx context.Context) (result []domain.QueuedAnswer, err error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT a.user_id, a.question_id, a.status, a.requested_help, a.help_state, a.file_id, a.filename, a.text_content, a.feedback, a.created_at, a.updated_at,
+		        u.username_display,
+		        q.question_id, q.book_id, q.text, q.context, q.knowledge_amount, q.reward_source, q.input_type, q.input_accept, q.max_file_size,
+		        COALESCE(ui.territory_id, bi.territory_id, ''), COALESCE(p.pool_id, ''),
+		        c.claimed_by, c.claimer_name, c.chat_id, c.message_id, c.claimed_at, c.expires_at
+		 FROM answers a
+		 JOIN users u ON u.id = a.user_id
+		 JOIN questions q ON q.question_id = a.question_id
+		 LEFT JOIN user_books ub ON ub.user_id = a.user_id AND ub.book_id = q.book_id
+		 LEFT JOIN islands ui ON ui.id = ub.island_id
+		 LEFT JOIN islands bi ON bi.book_id = q.book_id
+		 LEFT JOIN book_pools p ON p.book_id = q.book_id
+		 LEFT JOIN answer_claims c ON c.user_id = a.user_id AND c.question_id = a.question_id AND c.expires_at > $1
+		 WHERE a.status = $2
+		   AND NOT EXISTS (SELECT 1 FROM corrections k WHERE k.user_id = a.user_id AND k.question_id = a.question_id AND k.status IN ($3, $4))
+		 ORDER BY a.updated_at ;`,
+		time.Now().UTC(), domain.AnswerStatusPending, domain.CorrectionStatusPending, domain.CorrectionStatusDisputed,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		closeErr := rows.Close()
+		err = errors.Join(err, closeErr)
+	}()
+	for rows.Next() {
+		var queued domain.QueuedAnswer
+		var rewardSource sql.NullString
+		var inputAccept string
+		var claimedBy, chatId sql.NullInt64
+		var claimerName sql.NullString
+		var messageId sql.NullInt32
+		var claimedAt, expiresAt sql.NullTime
+		a, q := &queued.Answer, &queued.Question
+		err := rows.Scan(&a.UserID, &a.QuestionID, &a.Status, &a.RequestedHelp, &a.HelpState, &a.FileID, &a.Filename, &a.TextContent, &a.Feedback, &a.CreatedAt, &a.UpdatedAt,
+			&queued.Username,
+			&q.QuestionID, &q.BookID, &q.Text, &q.Context, &q.KnowledgeAmount, &rewardSource, &q.InputType, &inputAccept, &q.MaxFileSize,
+			&queued.Territory, &queued.Pool,
+			&claimedBy, &claimerName, &chatId, &messageId, &claimedAt, &expiresAt,
+		)
 		if err != nil {
 			return nil, err
 		}
-		answers = append(answers, answer)
+		q.RewardSource = rewardSource.String
+		if inputAccept != "" {
+			q.InputAccept = strings.Split(inputAccept, ",")
+		}
+		if claimedBy.Valid {
+			queued.Claim = &domain.AnswerClaim{
+				UserID:     a.UserID,
+				QuestionID: a.QuestionID,
+				Corrector:  domain.Corrector{ID: claimedBy.Int64, Name: claimerName.String},
+				ChatID:     chatId.Int64,
+				MessageID:  int(messageId.Int32),
+				ClaimedAt:  claimedAt.Time,
+				ExpiresAt:  expiresAt.Time,
+			}
+		}
+		result = append(result, queued)
+	}
+	return result, rows.Err()
+}
+
+func (s sqlQuestionRepository) GetAnswersToRemind(ctx context.Context, pendingBefore, remindedBefore time.Time) (result []domain.Answer, err error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+s.answerColumnsToSelect()+` FROM answers a
+		 WHERE a.status = $1 AND a.updated_at < $2
+		   AND NOT EXISTS (SELECT 1 FROM answer_reminders r WHERE r.user_id = a.user_id AND r.question_id = a.question_id AND r.reminded_at >= $3 AND r.reminded_at >= a.updated_at)
+		   AND NOT EXISTS (SELECT 1 FROM answer_claims c WHERE c.user_id = a.user_id AND c.question_id = a.question_id AND c.expires_at >= $4)
+		   AND NOT EXISTS (SELECT 1 FROM corrections k WHERE k.user_id = a.user_id AND k.question_id = a.question_id AND k.status IN ($5, $6)) ;`,
+		domain.AnswerStatusPending, pendingBefore.UTC(), remindedBefore.UTC(), time.Now().UTC(), domain.CorrectionStatusPending, domain.CorrectionStatusDisputed,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		closeErr := rows.Close()
+		err = errors.Join(err, closeErr)
+	}()
+	for rows.Next() {
+		var answer domain.Answer
+		if err := s.scanAnswer(rows, &answer); err != nil {
+			return nil, err
+		}
+		result = append(result, answer)
 	}
-	return answers, nil
+	return result, rows.Err()
+}
+
+func (s sqlQuestionRepository) MarkAnswerReminded(ctx context.Context, userId int32, questionId string, remindedAt time.Time) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO answer_reminders (user_id, question_id, reminded_at) VALUES ($1, $2, $3)
+		 ON CONFLICT (question_id, user_id) DO UPDATE SET reminded_at = EXCLUDED.reminded_at`,
+		userId, questionId, remindedAt.UTC(),
+	)
+	return err
 }
 
 func (s sqlQuestionRepository) MarkHelpRequest(ctx context.Context, userId int32, questionId string) error {
@@ -258,9 +459,14 @@ WHERE i.id = $4 ;
 func (s sqlQuestionRepository) GetQuestion(ctx context.Context, questionId string) (domain.BookQuestion, error) {
 	var question domain.BookQuestion
 	var rewardSource sql.NullString
-	err := s.db.QueryRowContext(ctx, `SELECT question_id, book_id, text, context, knowledge_amount, reward_source FROM questions WHERE question_id = $1 ;`,
-		questionId).Scan(&question.QuestionID, &question.BookID, &question.Text, &question.Context, &question.KnowledgeAmount, &rewardSource)
+	var inputAccept string
+	err := s.db.QueryRowContext(ctx, `SELECT question_id, book_id, text, context, knowledge_amount, reward_source, input_type, input_accept, max_file_size FROM questions WHERE question_id = $1 ;`,
+		questionId).Scan(&question.QuestionID, &question.BookID, &question.Text, &question.Context, &question.KnowledgeAmount, &rewardSource,
+		&question.InputType, &inputAccept, &question.MaxFileSize)
 	question.RewardSource = rewardSource.String
+	if inputAccept != "" {
+		question.InputAccept = strings.Split(inputAccept, ",")
+	}
 	if errors.Is(err, sql.ErrNoRows) {
 		return question, domain.ErrQuestionNotFound
 	}
@@ -270,8 +476,9 @@ func (s sqlQuestionRepository) GetQuestion(ctx context.Context, questionId strin
 func (s sqlQuestionRepository) CreateCorrection(ctx context.Context, correction domain.Correction) error {
 	correction.UpdatedAt = time.Now().UTC()
 	_, err := s.db.ExecContext(ctx,
-		`INSERT INTO corrections (id, question_id, user_id, status, new_status, feedback, updated_at) VALUES ($1, $2, $3, $4, $5, $6, $7)`,
-		correction.ID, correction.QuestionId, correction.UserId, domain.CorrectionStatusDraft, correction.NewStatus, correction.Feedback, correction.UpdatedAt,
+		`INSERT INTO corrections (id, question_id, user_id, status, new_status, feedback, corrector_id, corrector_name, submitted_at, updated_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+		correction.ID, correction.QuestionId, correction.UserId, domain.CorrectionStatusDraft, correction.NewStatus, correction.Feedback,
+		correction.Corrector.ID, correction.Corrector.Name, n(correction.SubmittedAt.UTC()), correction.UpdatedAt,
 	)
 	return err
 }
@@ -298,6 +505,9 @@ func (s sqlQuestionRepository) ApplyCorrection(ctx context.Context, tx domain.Tx
 	if _, err := tx.ExecContext(ctx, `UPDATE corrections SET status = $1 WHERE id = $2 ;`, domain.CorrectionStatusApplied, correction.ID); err != nil {
 		slog.Error("db: failed to set correction status to applied", slog.Any("error", err), slog.String("correction_id", correction.ID))
 	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM answer_claims WHERE user_id = $1 AND question_id = $2 ;`, correction.UserId, correction.QuestionId); err != nil {
+		slog.Error("db: failed to delete answer claim", slog.Any("error", err), slog.String("correction_id", correction.ID))
+	}
 	if answer.Status != correction.NewStatus {
 		return answer, false, domain.ErrAnswerNotPending
 	}
@@ -361,7 +571,7 @@ func (s sqlQuestionRepository) UpdateCorrectionFeedback(ctx context.Context, id
 
 func (s sqlQuestionRepository) FinalizeCorrection(ctx context.Context, id string) error {
 	now := time.Now().UTC()
-	cmd, err := s.db.ExecContext(ctx, `UPDATE corrections SET status = $1, updated_at = $2 WHERE id = $3 AND status = $4 ;`,
+	cmd, err := s.db.ExecContext(ctx, `UPDATE corrections SET status = $1, updated_at = $2, finalized_at = $2 WHERE id = $3 AND status = $4 ;`,
 		domain.CorrectionStatusPending, now, id, domain.CorrectionStatusDraft)
 	if err != nil {
 		return err
@@ -375,3 +585,231 @@ func (s sqlQuestionRepository) FinalizeCorrection(ctx context.Context, id string
 	}
 	return nil
 }
+
+func (s sqlQuestionRepository) GetAnswerCorrections(ctx context.Context, userId int32, questionId string, status domain.CorrectionStatus) (result []domain.Correction, err error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT id, question_id, user_id, new_status, feedback, corrector_id, corrector_name, submitted_at, updated_at FROM corrections
+		 WHERE user_id = $1 AND question_id = $2 AND status = $3 ORDER BY finalized_at ;`,
+		userId, questionId, status,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		closeErr := rows.Close()
+		err = errors.Join(err, closeErr)
+	}()
+	for rows.Next() {
+		var correction domain.Correction
+		var submittedAt sql.NullTime
+		err := rows.Scan(&correction.ID, &correction.QuestionId, &correction.UserId, &correction.NewStatus, &correction.Feedback,
+			&correction.Corrector.ID, &correction.Corrector.Name, &submittedAt, &correction.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		correction.SubmittedAt = submittedAt.Time
+		result = append(result, correction)
+	}
+	return result, rows.Err()
+}
+
+func (s sqlQuestionRepository) BlindCorrection(ctx context.Context, id string) (blinded bool, err error) {
+	tx, err := beginTx(ctx, s.db)
+	if err != nil {
+		return false, fmt.Errorf("start transaction: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			err = errors.Join(err, tx.Rollback())
+		} else {
+			err = tx.Commit()
+		}
+	}()
+	var userId int32
+	var questionId string
+	err = tx.QueryRowContext(ctx, `SELECT user_id, question_id FROM corrections WHERE id = $1 AND status = $2 ;`, id, domain.CorrectionStatusDraft).
+		Scan(&userId, &questionId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, domain.ErrCorrectionStatusChanged
+	}
+	if err != nil {
+		return false, err
+	}
+	// lock the answer, so that only one of its drafts can become blind
+	_, err = tx.ExecContext(ctx, `UPDATE answers SET status = status WHERE user_id = $1 AND question_id = $2 ;`, userId, questionId)
+	if err != nil {
+		return false, err
+	}
+	now := time.Now().UTC()
+	cmd, err := tx.ExecContext(ctx,
+		`UPDATE corrections SET status = $1, updated_at = $2, finalized_at = COALESCE(finalized_at, $2)
+		 WHERE id = $3 AND status = $4
+		   AND NOT EXISTS (SELECT 1 FROM corrections b WHERE b.user_id = $5 AND b.question_id = $6 AND b.status = $1) ;`,
+		domain.CorrectionStatusBlind, now, id, domain.CorrectionStatusDraft, userId, questionId,
+	)
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, err := cmd.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected > 0, nil
+}
+
+func (s sqlQuestionRepository) ChangeCorrectionStatuses(ctx context.Context, changes []domain.CorrectionStatusChange) (err error) {
+	tx, err := beginTx(ctx, s.db)
+	if err != nil {
+		return fmt.Errorf("start transaction: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			err = errors.Join(err, tx.Rollback())
+		} else {
+			err = tx.Commit()
+		}
+	}()
+	now := time.Now().UTC()
+	for _, c := range changes {
+		cmd, err := tx.ExecContext(ctx,
+			`UPDATE corrections SET status = $1, updated_at = $2, finalized_at = COALESCE(finalized_at, $2) WHERE id = $3 AND status = $4 ;`,
+			c.To, now, c.ID, c.From,
+		)
+		if err != nil {
+			return err
+		}
+		rowsAffected, err := cmd.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rowsAffected == 0 {
+			return domain.ErrCorrectionStatusChanged
+		}
+	}
+	return nil
+}
+
+func (s sqlQuestionRepository) GetCorrection(ctx context.Context, id string) (domain.Correction, error) {
+	var correction domain.Correction
+	var submittedAt sql.NullTime
+	err := s.db.QueryRowContext(ctx,
+		`SELECT id, question_id, user_id, new_status, feedback, corrector_id, corrector_name, submitted_at, updated_at FROM corrections WHERE id = $1 ;`, id,
+	).Scan(&correction.ID, &correction.QuestionId, &correction.UserId, &correction.NewStatus, &correction.Feedback,
+		&correction.Corrector.ID, &correction.Corrector.Name, &submittedAt, &correction.UpdatedAt)
+	correction.SubmittedAt = submittedAt.Time
+	if errors.Is(err, sql.ErrNoRows) {
+		return correction, domain.ErrCorrectionNotFound
+	}
+	return correction, err
+}
+
+func (s sqlQuestionRepository) answerClaimColumnsToSelect() string {
+	return `user_id, question_id, claimed_by, claimer_name, chat_id, message_id, claimed_at, expires_at`
+}
+
+func (s sqlQuestionRepository) scanAnswerClaim(row scannable, claim *domain.AnswerClaim) error {
+	return row.Scan(&claim.UserID, &claim.QuestionID, &claim.Corrector.ID, &claim.Corrector.Name, &claim.ChatID, &claim.MessageID, &claim.ClaimedAt, &claim.ExpiresAt)
+}
+
+func (s sqlQuestionRepository) ClaimAnswer(ctx context.Context, claim domain.AnswerClaim) (domain.AnswerClaim, error) {
+	var current domain.AnswerClaim
+	err := s.scanAnswerClaim(s.db.QueryRowContext(ctx,
+		`INSERT INTO answer_claims (user_id, question_id, claimed_by, claimer_name, chat_id, message_id, claimed_at, expires_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		 ON CONFLICT (question_id, user_id) DO UPDATE SET
+		     claimed_by = EXCLUDED.claimed_by, claimer_name = EXCLUDED.claimer_name, chat_id = EXCLUDED.chat_id,
+		     message_id = EXCLUDED.message_id, claimed_at = EXCLUDED.claimed_at, expires_at = EXCLUDED.expires_at
+		 WHERE answer_claims.claimed_by = EXCLUDED.claimed_by OR answer_claims.expires_at < EXCLUDED.claimed_at
+		 RETURNING `+s.answerClaimColumnsToSelect(),
+		claim.UserID, claim.QuestionID, claim.Corrector.ID, claim.Corrector.Name, claim.ChatID, claim.MessageID, claim.ClaimedAt.UTC(), claim.ExpiresAt.UTC(),
+	), &current)
+	if errors.Is(err, sql.ErrNoRows) {
+		var found bool
+		current, found, err = s.GetAnswerClaim(ctx, claim.UserID, claim.QuestionID)
+		if err == nil && !found {
+			err = errors.New("answer claim disappeared while claiming")
+		}
+	}
+	if err != nil {
+		return current, fmt.Errorf("failed to claim answer: %w", err)
+	}
+	return current, nil
+}
+
+func (s sqlQuestionRepository) GetAnswerClaim(ctx context.Context, userId int32, questionId string) (claim domain.AnswerClaim, found bool, err error) {
+	err = s.scanAnswerClaim(s.db.QueryRowContext(ctx,
+		`SELECT `+s.answerClaimColumnsToSelect()+` FROM answer_claims WHERE user_id = $1 AND question_id = $2`,
+		userId, questionId,
+	), &claim)
+	found = err == nil
+	if errors.Is(err, sql.ErrNoRows) {
+		err = nil
+	}
+	return
+}
+
+func (s sqlQuestionRepository) ReleaseAnswerClaim(ctx context.Context, claim domain.AnswerClaim) (bool, error) {
+	cmd, err := s.db.ExecContext(ctx,
+		`DELETE FROM answer_claims WHERE user_id = $1 AND question_id = $2 AND claimed_by = $3 AND claimed_at = $4 ;`,
+		claim.UserID, claim.QuestionID, claim.Corrector.ID, claim.ClaimedAt.UTC(),
+	)
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, err := cmd.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected > 0, nil
+}
+
+func (s sqlQuestionRepository) GetExpiredAnswerClaims(ctx context.Context, before time.Time) (result []domain.AnswerClaim, err error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT c.user_id, c.question_id, c.claimed_by, c.claimer_name, c.chat_id, c.message_id, c.claimed_at, c.expires_at
+		 FROM answer_claims c JOIN answers a ON a.user_id = c.user_id AND a.question_id = c.question_id
+		 WHERE c.expires_at < $1 AND a.status = $2 AND NOT EXISTS (
+		     SELECT 1 FROM corrections r WHERE r.user_id = c.user_id AND r.question_id = c.question_id AND r.status = $3
+		 ) ;`,
+		before.UTC(), domain.AnswerStatusPending, domain.CorrectionStatusPending,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		closeErr := rows.Close()
+		err = errors.Join(err, closeErr)
+	}()
+	for rows.Next() {
+		var claim domain.AnswerClaim
+		if err := s.scanAnswerClaim(rows, &claim); err != nil {
+			return nil, err
+		}
+		result = append(result, claim)
+	}
+	return result, rows.Err()
+}
+
+func (s sqlQuestionRepository) GetFinalizedCorrections(ctx context.Context, since time.Time) (result []domain.CorrectionRecord, err error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT corrector_id, corrector_name, new_status, submitted_at, finalized_at FROM corrections WHERE status != $1 AND finalized_at >= $2 ;`,
+		domain.CorrectionStatusDraft, since.UTC(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		closeErr := rows.Close()
+		err = errors.Join(err, closeErr)
+	}()
+	for rows.Next() {
+		var record domain.CorrectionRecord
+		var submittedAt, finalizedAt sql.NullTime
+		if err := rows.Scan(&record.Corrector.ID, &record.Corrector.Name, &record.NewStatus, &submittedAt, &finalizedAt); err != nil {
+			return nil, err
+		}
+		record.SubmittedAt = submittedAt.Time
+		record.FinalizedAt = finalizedAt.Time
+		result = append(result, record)
+	}
+	return result, rows.Err()
+}
@@ -23,7 +23,7 @@ CREATE TABLE IF NOT EXISTS territories (
 )
 
 type sqlTerritoryRepository struct {
-	db *sql.DB
+	db conn
 }
 
 func NewSqlTerritoryRepository(db *sql.DB) (domain.TerritoryStore, error) {
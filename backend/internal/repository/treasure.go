@@ -35,7 +35,7 @@ CREATE INDEX IF NOT EXISTS idx_user_treasures_user_id ON user_treasures (user_id
 )
 
 type sqlTreasureRepository struct {
-	db *sql.DB
+	db conn
 }
 
 func NewSqlTreasureRepository(db *sql.DB) (domain.TreasureStore, error) {
@@ -53,7 +53,7 @@ func NewSqlTreasureRepository(db *sql.DB) (domain.TreasureStore, error) {
 }
 
 func (s sqlTreasureRepository) BindTreasuresToBook(ctx context.Context, bookId string, treasures []domain.Treasure) (err error) {
-	tx, err := s.db.BeginTx(ctx, nil)
+	tx, err := beginTx(ctx, s.db)
 	if err != nil {
 		return fmt.Errorf("start transaction: %w", err)
 	}
@@ -0,0 +1,126 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/Rastaiha/bermudia/internal/domain"
+	"sync/atomic"
+)
+
+// conn is what a store runs its queries on: the database itself,
+// or a transaction when the store is bound to one.
+type conn interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+type txConn interface {
+	conn
+	Commit() error
+	Rollback() error
+}
+
+var savepointSeq atomic.Int64
+
+// beginTx starts a transaction on c. If c is already a transaction, a savepoint is
+// used instead so that the store method stays all-or-nothing inside the larger transaction.
+func beginTx(ctx context.Context, c conn) (txConn, error) {
+	switch c := c.(type) {
+	case *sql.DB:
+		return c.BeginTx(ctx, nil)
+	case *sql.Tx:
+		name := fmt.Sprintf("sp_%d", savepointSeq.Add(1))
+		if _, err := c.ExecContext(ctx, "SAVEPOINT "+name); err != nil {
+			return nil, err
+		}
+		return savepoint{Tx: c, ctx: ctx, name: name}, nil
+	}
+	return nil, fmt.Errorf("can not begin transaction on %T", c)
+}
+
+type savepoint struct {
+	*sql.Tx
+	ctx  context.Context
+	name string
+}
+
+func (s savepoint) Commit() error {
+	_, err := s.Tx.ExecContext(s.ctx, "RELEASE SAVEPOINT "+s.name)
+	return err
+}
+
+func (s savepoint) Rollback() error {
+	_, err := s.Tx.ExecContext(s.ctx, "ROLLBACK TO SAVEPOINT "+s.name)
+	return err
+}
+
+type sqlGameTransactor struct {
+	db *sql.DB
+}
+
+// NewSqlGameTransactor returns a transactor for stores that were created on db.
+func NewSqlGameTransactor(db *sql.DB) domain.GameTransactor {
+	return sqlGameTransactor{db: db}
+}
+
+func (t sqlGameTransactor) InGameTx(ctx context.Context, f func(stores domain.GameStores) error) (err error) {
+	tx, err := t.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("start transaction: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			err = errors.Join(err, tx.Rollback())
+		} else {
+			err = tx.Commit()
+		}
+	}()
+	return f(domain.GameStores{
+		Tx:        tx,
+		User:      sqlUser{db: tx},
+		Player:    sqlPlayerRepository{db: tx},
+		Territory: sqlTerritoryRepository{db: tx},
+		Question:  sqlQuestionRepository{db: tx},
+		Island:    sqlIslandRepository{db: tx},
+		Treasure:  sqlTreasureRepository{db: tx},
+		Market:    sqlMarketRepository{db: tx},
+		Inbox:     sqlInboxRepository{db: tx},
+		Invest:    &sqlInvestStore{db: tx},
+	})
+}
+
+type sqlContentTransactor struct {
+	db *sql.DB
+}
+
+// NewSqlContentTransactor returns a transactor for stores that were created on db.
+func NewSqlContentTransactor(db *sql.DB) domain.ContentTransactor {
+	return sqlContentTransactor{db: db}
+}
+
+func (t sqlContentTransactor) InContentTx(ctx context.Context, f func(stores domain.ContentStores) error) (err error) {
+	tx, err := t.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("start transaction: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			err = errors.Join(err, tx.Rollback())
+		} else {
+			err = tx.Commit()
+		}
+	}()
+	return f(domain.ContentStores{
+		Territory:        sqlTerritoryRepository{db: tx},
+		Island:           sqlIslandRepository{db: tx},
+		User:             sqlUser{db: tx},
+		Player:           sqlPlayerRepository{db: tx},
+		Question:         sqlQuestionRepository{db: tx},
+		Treasure:         sqlTreasureRepository{db: tx},
+		FeedbackTemplate: sqlFeedbackTemplateRepository{db: tx},
+		ContentVersion:   sqlContentVersionRepository{db: tx},
+	})
+}
@@ -17,13 +17,14 @@ CREATE TABLE IF NOT EXISTS users (
     username VARCHAR(255) NOT NULL UNIQUE,
     meet_link VARCHAR(255) NOT NULL,
     name TEXT NOT NULL,
+    role VARCHAR(32) NOT NULL DEFAULT 'player',
     hashed_password BYTEA NOT NULL
 );
 `
 )
 
 type sqlUser struct {
-	db *sql.DB
+	db conn
 }
 
 func NewSqlUser(db *sql.DB) (domain.UserStore, error) {
@@ -31,17 +32,21 @@ func NewSqlUser(db *sql.DB) (domain.UserStore, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to create users table: %w", err)
 	}
+	err = addColumns(db, "users", "role VARCHAR(32) NOT NULL DEFAULT 'player'")
+	if err != nil {
+		return nil, err
+	}
 	return sqlUser{
 		db: db,
 	}, nil
 }
 
 func (s sqlUser) columns() string {
-	return "SELECT id, username_display, meet_link, hashed_password, name FROM users"
+	return "SELECT id, username_display, meet_link, hashed_password, name, role FROM users"
 }
 
 func (s sqlUser) scan(row *sql.Row, user *domain.User) error {
-	err := row.Scan(&user.ID, &user.Username, &user.MeetLink, &user.HashedPassword, &user.Name)
+	err := row.Scan(&user.ID, &user.Username, &user.MeetLink, &user.HashedPassword, &user.Name, &user.Role)
 	if errors.Is(err, sql.ErrNoRows) {
 		return domain.ErrUserNotFound
 	}
@@ -49,18 +54,37 @@ func (s sqlUser) scan(row *sql.Row, user *domain.User) error {
 }
 
 func (s sqlUser) Create(ctx context.Context, user *domain.User) error {
-	err := s.db.QueryRowContext(ctx, `INSERT INTO users (id, username_display, username, meet_link, hashed_password, name) VALUES ($1, $2, $3, $4, $5, $6)
-ON CONFLICT (username) DO UPDATE SET username_display = $2, username = $3, meet_link = $4, hashed_password = $5, name = $6 RETURNING id`,
+	if user.Role == "" {
+		user.Role = domain.RolePlayer
+	}
+	err := s.db.QueryRowContext(ctx, `INSERT INTO users (id, username_display, username, meet_link, hashed_password, name, role) VALUES ($1, $2, $3, $4, $5, $6, $7)
+ON CONFLICT (username) DO UPDATE SET username_display = $2, username = $3, meet_link = $4, hashed_password = $5, name = $6, role = $7 RETURNING id`,
 		n(user.ID),
 		n(user.Username),
 		n(strings.ToLower(user.Username)),
 		user.MeetLink,
 		user.HashedPassword,
 		user.Name,
+		user.Role,
 	).Scan(&user.ID)
 	return err
 }
 
+func (s sqlUser) SetRole(ctx context.Context, id int32, role domain.Role) error {
+	result, err := s.db.ExecContext(ctx, `UPDATE users SET role = $1 WHERE id = $2`, role, id)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return domain.ErrUserNotFound
+	}
+	return nil
+}
+
 func (s sqlUser) Get(ctx context.Context, id int32) (*domain.User, error) {
 	var result domain.User
 	err := s.scan(s.db.QueryRowContext(ctx, s.columns()+" WHERE id = $1", id), &result)
@@ -3,6 +3,7 @@ package service
 import (
 	"context"
 	cRand "crypto/rand"
+	"database/sql"
 	"encoding/base64"
 	"errors"
 	"fmt"
@@ -10,6 +11,7 @@ import (
 	"github.com/Rastaiha/bermudia/internal/domain"
 	"math/rand"
 	"slices"
+	"strings"
 )
 
 type Admin struct {
@@ -20,9 +22,13 @@ type Admin struct {
 	playerStore    domain.PlayerStore
 	questionStore  domain.QuestionStore
 	treasureStore  domain.TreasureStore
+	templateStore  domain.FeedbackTemplateStore
+	versionStore   domain.ContentVersionStore
+	transactor     domain.ContentTransactor
+	playerService  *Player
 }
 
-func NewAdmin(cfg config.Config, territoryStore domain.TerritoryStore, islandStore domain.IslandStore, userStore domain.UserStore, playerStore domain.PlayerStore, questionStore domain.QuestionStore, treasureStore domain.TreasureStore) *Admin {
+func NewAdmin(cfg config.Config, territoryStore domain.TerritoryStore, islandStore domain.IslandStore, userStore domain.UserStore, playerStore domain.PlayerStore, questionStore domain.QuestionStore, treasureStore domain.TreasureStore, templateStore domain.FeedbackTemplateStore, versionStore domain.ContentVersionStore, transactor domain.ContentTransactor, playerService *Player) *Admin {
 	return &Admin{
 		cfg:            cfg,
 		territoryStore: territoryStore,
@@ -31,10 +37,15 @@ func NewAdmin(cfg config.Config, territoryStore domain.TerritoryStore, islandSto
 		playerStore:    playerStore,
 		questionStore:  questionStore,
 		treasureStore:  treasureStore,
+		templateStore:  templateStore,
+		versionStore:   versionStore,
+		transactor:     transactor,
+		playerService:  playerService,
 	}
 }
 
-func (a *Admin) SetTerritory(ctx context.Context, territory domain.Territory) error {
+// ValidateTerritory checks the territory without storing anything.
+func ValidateTerritory(territory domain.Territory) error {
 	for _, island := range territory.Islands {
 		if island.ID == "" {
 			return fmt.Errorf("empty island id in island list")
@@ -82,7 +93,13 @@ func (a *Admin) SetTerritory(ctx context.Context, territory domain.Territory) er
 			}
 		}
 	}
+	return nil
+}
 
+func (a *Admin) SetTerritory(ctx context.Context, territory domain.Territory) error {
+	if err := ValidateTerritory(territory); err != nil {
+		return err
+	}
 	for _, island := range territory.Islands {
 		if err := a.islandStore.ReserveIDForTerritory(ctx, territory.ID, island.ID, island.Name); err != nil {
 			return err
@@ -112,17 +129,32 @@ type BookInputComponent struct {
 
 type IslandInputQuestion struct {
 	domain.Question
-	KnowledgeAmount int32  `json:"knowledgeAmount"`
-	RewardSource    string `json:"rewardSource,omitempty"`
-	Context         string `json:"correctionHintMessage,omitempty"`
+	KnowledgeAmount   int32    `json:"knowledgeAmount"`
+	RewardSource      string   `json:"rewardSource,omitempty"`
+	Context           string   `json:"correctionHintMessage,omitempty"`
+	FeedbackTemplates []string `json:"feedbackTemplates,omitempty"`
 }
 
-func (a *Admin) SetBookAndBindToIsland(ctx context.Context, islandId string, input BookInput) (BookInput, error) {
+// SetBookAndBindToIsland stores the book and binds it to the island.
+// Unless force is set, it refuses to delete or rebind questions that have answers,
+// including replacing the book of the island when the replaced book has answers.
+func (a *Admin) SetBookAndBindToIsland(ctx context.Context, islandId string, input BookInput, force bool) (BookInput, error) {
 	territoryId, err := a.islandStore.GetTerritory(ctx, islandId)
 	if err != nil {
 		return input, fmt.Errorf("island %q does not have territory", islandId)
 	}
-	input, err = a.setBook(ctx, input)
+	if !force {
+		header, err := a.islandStore.GetIslandHeader(ctx, islandId)
+		if err != nil {
+			return input, err
+		}
+		if header.BookID != "" && header.BookID != input.BookId {
+			if err := a.checkUnanswered(ctx, header.BookID, nil); err != nil {
+				return input, fmt.Errorf("island %q: %w", islandId, err)
+			}
+		}
+	}
+	input, err = a.setBook(ctx, input, force)
 	if err != nil {
 		return input, err
 	}
@@ -138,11 +170,11 @@ func (a *Admin) SetBookAndBindToIsland(ctx context.Context, islandId string, inp
 	return input, nil
 }
 
-func (a *Admin) SetBookAndBindToPool(ctx context.Context, poolId string, input BookInput) (BookInput, error) {
+func (a *Admin) SetBookAndBindToPool(ctx context.Context, poolId string, input BookInput, force bool) (BookInput, error) {
 	if !domain.IsPoolIdValid(poolId) {
 		return input, fmt.Errorf("invalid poolId %q", poolId)
 	}
-	input, err := a.setBook(ctx, input)
+	input, err := a.setBook(ctx, input, force)
 	if err != nil {
 		return input, err
 	}
@@ -153,39 +185,67 @@ func (a *Admin) SetBookAndBindToPool(ctx context.Context, poolId string, input B
 	return input, nil
 }
 
-func (a *Admin) setBook(ctx context.Context, input BookInput) (BookInput, error) {
-	if input.BookId == "" || !domain.IdHasType(input.BookId, domain.ResourceTypeBook) {
-		input.BookId = domain.NewID(domain.ResourceTypeBook)
-	}
-	book := domain.Book{ID: input.BookId, Components: make([]domain.BookComponent, 0)}
-	var questions []domain.BookQuestion
+// ValidateBook checks the book without storing anything. Missing ids are not an error; they are generated on set.
+func ValidateBook(input BookInput) error {
+	book := domain.Book{ID: input.BookId}
 	for i, c := range input.Components {
 		if c.IFrame != nil {
 			if c.IFrame.Url == "" {
-				return input, fmt.Errorf("empty url for book %q iframe component at index %d", book.ID, i)
+				return fmt.Errorf("empty url for book %q iframe component at index %d", book.ID, i)
 			}
-			book.Components = append(book.Components, domain.BookComponent{IFrame: c.IFrame})
 			continue
 		}
 		if c.Question != nil {
 			if c.Question.InputType == "" {
-				return input, fmt.Errorf("empty inputType for book %q question at index %d", book.ID, i)
+				return fmt.Errorf("empty inputType for book %q question at index %d", book.ID, i)
 			}
 			if c.Question.InputType == "file" && len(c.Question.InputAccept) == 0 {
-				return input, fmt.Errorf("empty inputAccept for book %q question at index %d", book.ID, i)
+				return fmt.Errorf("empty inputAccept for book %q question at index %d", book.ID, i)
+			}
+			if c.Question.MaxFileSize < 0 {
+				return fmt.Errorf("negative maxFileSize for book %q question at index %d", book.ID, i)
 			}
 			if c.Question.KnowledgeAmount < 0 {
-				return input, fmt.Errorf("negative knowledgeAmount for book %q question at index %d", book.ID, i)
+				return fmt.Errorf("negative knowledgeAmount for book %q question at index %d", book.ID, i)
 			}
 			if !domain.IsValidRewardSource(c.Question.RewardSource) {
-				return input, fmt.Errorf("invalid reward source %q", c.Question.RewardSource)
+				return fmt.Errorf("invalid reward source %q", c.Question.RewardSource)
 			}
 			if c.Question.Text == "" {
-				return input, fmt.Errorf("empty text for book %q question at index %d", book.ID, i)
+				return fmt.Errorf("empty text for book %q question at index %d", book.ID, i)
+			}
+			for _, t := range c.Question.FeedbackTemplates {
+				if strings.TrimSpace(t) == "" {
+					return fmt.Errorf("empty feedback template for book %q question at index %d", book.ID, i)
+				}
 			}
+			continue
+		}
+		return fmt.Errorf("unknown component for book %q at index %d", book.ID, i)
+	}
+	return nil
+}
+
+func (a *Admin) setBook(ctx context.Context, input BookInput, force bool) (BookInput, error) {
+	if input.BookId == "" || !domain.IdHasType(input.BookId, domain.ResourceTypeBook) {
+		input.BookId = domain.NewID(domain.ResourceTypeBook)
+	}
+	if err := ValidateBook(input); err != nil {
+		return input, err
+	}
+	book := domain.Book{ID: input.BookId, Components: make([]domain.BookComponent, 0)}
+	var questions []domain.BookQuestion
+	feedbackTemplates := make(map[string][]string)
+	for _, c := range input.Components {
+		if c.IFrame != nil {
+			book.Components = append(book.Components, domain.BookComponent{IFrame: c.IFrame})
+			continue
+		}
+		if c.Question != nil {
 			if c.Question.ID == "" || !domain.IdHasType(c.Question.ID, domain.ResourceTypeQuestion) {
 				c.Question.ID = domain.NewID(domain.ResourceTypeQuestion)
 			}
+			feedbackTemplates[c.Question.ID] = c.Question.FeedbackTemplates
 			questions = append(questions, domain.BookQuestion{
 				QuestionID:      c.Question.ID,
 				BookID:          input.BookId,
@@ -193,11 +253,18 @@ func (a *Admin) setBook(ctx context.Context, input BookInput) (BookInput, error)
 				KnowledgeAmount: c.Question.KnowledgeAmount,
 				RewardSource:    c.Question.RewardSource,
 				Context:         c.Question.Context,
+				InputType:       c.Question.InputType,
+				InputAccept:     c.Question.InputAccept,
+				MaxFileSize:     c.Question.MaxFileSize,
 			})
 			book.Components = append(book.Components, domain.BookComponent{Question: &c.Question.Question})
 			continue
 		}
-		return input, fmt.Errorf("unknown component for book %q at index %d", book.ID, i)
+	}
+	if !force {
+		if err := a.checkQuestionsKept(ctx, input.BookId, questions); err != nil {
+			return input, err
+		}
 	}
 	for _, t := range input.Treasures {
 		if t.ID == "" || !domain.IdHasType(t.ID, domain.ResourceTypeTreasure) {
@@ -213,6 +280,12 @@ func (a *Admin) setBook(ctx context.Context, input BookInput) (BookInput, error)
 	if err != nil {
 		return input, fmt.Errorf("failed to bind questions to book: %w", err)
 	}
+	for _, q := range questions {
+		err = a.templateStore.SetQuestionTemplates(ctx, q.QuestionID, feedbackTemplates[q.QuestionID])
+		if err != nil {
+			return input, fmt.Errorf("failed to set feedback templates of question %q: %w", q.QuestionID, err)
+		}
+	}
 	err = a.treasureStore.BindTreasuresToBook(ctx, book.ID, book.Treasures)
 	if err != nil {
 		return input, fmt.Errorf("failed to bind treasures to book: %w", err)
@@ -240,10 +313,14 @@ func (a *Admin) GetTerritoryIslandBindings(ctx context.Context, territoryId stri
 			binding.PooledIslands = append(binding.PooledIslands, h.ID)
 		}
 		if !h.FromPool && h.BookID == "" {
-			binding.PooledIslands = append(binding.EmptyIslands, h.ID)
+			binding.EmptyIslands = append(binding.EmptyIslands, h.ID)
 		}
 	}
 	settings, err := a.islandStore.GetTerritoryPoolSettings(ctx, territoryId)
+	if errors.Is(err, sql.ErrNoRows) {
+		// the territory has no pool
+		return binding, nil
+	}
 	if err != nil {
 		return binding, err
 	}
@@ -251,10 +328,34 @@ func (a *Admin) GetTerritoryIslandBindings(ctx context.Context, territoryId stri
 	return binding, nil
 }
 
-func (a *Admin) SetTerritoryIslandBindings(ctx context.Context, bindings TerritoryIslandBindings) (TerritoryIslandBindings, error) {
+// ValidateTerritoryIslandBindings checks the bindings without storing anything.
+func ValidateTerritoryIslandBindings(bindings TerritoryIslandBindings) error {
 	pooledCount := int32(len(bindings.PooledIslands))
 	if pooledCount != bindings.PoolSettings.TotalCount() {
-		return bindings, fmt.Errorf("number of pooled islands don't match pool settings: %d vs %d", pooledCount, bindings.PoolSettings.TotalCount())
+		return fmt.Errorf("number of pooled islands don't match pool settings: %d vs %d", pooledCount, bindings.PoolSettings.TotalCount())
+	}
+	return nil
+}
+
+// SetTerritoryIslandBindings makes the islands empty or pooled. Unless force is set,
+// it refuses to unbind a book that has answers from its island.
+func (a *Admin) SetTerritoryIslandBindings(ctx context.Context, bindings TerritoryIslandBindings, force bool) (TerritoryIslandBindings, error) {
+	if err := ValidateTerritoryIslandBindings(bindings); err != nil {
+		return bindings, err
+	}
+	if !force {
+		for _, id := range slices.Concat(bindings.EmptyIslands, bindings.PooledIslands) {
+			header, err := a.islandStore.GetIslandHeader(ctx, id)
+			if err != nil {
+				return bindings, fmt.Errorf("failed to get header of island %q: %w", id, err)
+			}
+			if header.BookID == "" {
+				continue
+			}
+			if err := a.checkUnanswered(ctx, header.BookID, nil); err != nil {
+				return bindings, fmt.Errorf("island %q: %w", id, err)
+			}
+		}
 	}
 	err := a.islandStore.SetTerritoryPoolSettings(ctx, bindings.TerritoryId, bindings.PoolSettings)
 	if err != nil {
@@ -291,12 +392,20 @@ type User struct {
 	Password          string `json:"password"`
 	StartingTerritory string `json:"startingTerritory"`
 	MeetLink          string `json:"meetLink"`
+	Role              string `json:"role,omitempty"`
 }
 
 func (a *Admin) CreateUser(ctx context.Context, index int, user User) (User, error) {
 	if user.Username == "" {
 		return User{}, fmt.Errorf("username is required")
 	}
+	role := domain.RolePlayer
+	if user.Role != "" {
+		role = domain.Role(user.Role)
+	}
+	if !domain.IsValidRole(role) {
+		return user, fmt.Errorf("invalid role %q", user.Role)
+	}
 	if user.Password == "" {
 		b := make([]byte, 8)
 		_, _ = cRand.Read(b)
@@ -331,10 +440,116 @@ func (a *Admin) CreateUser(ctx context.Context, index int, user User) (User, err
 		Username:       user.Username,
 		Name:           user.Name,
 		MeetLink:       user.MeetLink,
+		Role:           role,
 		HashedPassword: hp,
 	}
 	if err := a.userStore.Create(ctx, u); err != nil {
 		return user, err
 	}
+	if role != domain.RolePlayer {
+		return user, nil
+	}
 	return user, a.playerStore.Create(ctx, domain.NewPlayer(u.ID, &startingTerritory))
 }
+
+func (a *Admin) GetUser(ctx context.Context, username string) (*domain.User, error) {
+	return a.userStore.GetByUsername(ctx, username)
+}
+
+// SetUserRole changes the role of the user. Tokens issued before the change stop working.
+// Only users that were created as players can be given the player role back.
+func (a *Admin) SetUserRole(ctx context.Context, username string, role domain.Role) (*domain.User, error) {
+	if !domain.IsValidRole(role) {
+		return nil, fmt.Errorf("invalid role %q", role)
+	}
+	user, err := a.userStore.GetByUsername(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	if role == domain.RolePlayer && user.Role != domain.RolePlayer {
+		if _, err := a.playerStore.Get(ctx, user.ID); err != nil {
+			return nil, fmt.Errorf("user %q has no player: %w", username, err)
+		}
+	}
+	if err := a.userStore.SetRole(ctx, user.ID, role); err != nil {
+		return nil, err
+	}
+	user.Role = role
+	return user, nil
+}
+
+// GrantResources gives the items of grant to the player of the user.
+// The update is pushed to the player like any other player update.
+func (a *Admin) GrantResources(ctx context.Context, username string, grant domain.Cost) (domain.Player, error) {
+	user, err := a.userStore.GetByUsername(ctx, username)
+	if err != nil {
+		return domain.Player{}, err
+	}
+	return a.playerService.GrantResources(ctx, user.ID, grant)
+}
+
+type PlayerInspection struct {
+	User          *domain.User          `json:"user"`
+	Player        *domain.Player        `json:"player,omitempty"`
+	KnowledgeBars []domain.KnowledgeBar `json:"knowledgeBars,omitempty"`
+}
+
+func (a *Admin) InspectPlayer(ctx context.Context, username string) (PlayerInspection, error) {
+	user, err := a.userStore.GetByUsername(ctx, username)
+	if err != nil {
+		return PlayerInspection{}, err
+	}
+	result := PlayerInspection{User: user}
+	if user.Role != domain.RolePlayer {
+		return result, nil
+	}
+	player, err := a.playerStore.Get(ctx, user.ID)
+	if err != nil {
+		return result, err
+	}
+	result.Player = &player
+	result.KnowledgeBars, err = a.questionStore.GetKnowledgeBars(ctx, user.ID)
+	if err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+type StateExport struct {
+	Territories []domain.Territory        `json:"territories"`
+	Bindings    []TerritoryIslandBindings `json:"bindings"`
+	Players     []PlayerInspection        `json:"players"`
+}
+
+// ExportState returns the territories and the state of every player.
+func (a *Admin) ExportState(ctx context.Context) (StateExport, error) {
+	var result StateExport
+	territories, err := a.territoryStore.ListTerritories(ctx)
+	if err != nil {
+		return result, err
+	}
+	result.Territories = territories
+	for _, t := range territories {
+		bindings, err := a.GetTerritoryIslandBindings(ctx, t.ID)
+		if err != nil {
+			return result, err
+		}
+		result.Bindings = append(result.Bindings, bindings)
+	}
+	userIds, err := a.playerStore.GetAll(ctx)
+	if err != nil {
+		return result, err
+	}
+	for _, id := range userIds {
+		user, err := a.userStore.Get(ctx, id)
+		if err != nil {
+			return result, err
+		}
+		inspection, err := a.InspectPlayer(ctx, user.Username)
+		if err != nil {
+			return result, fmt.Errorf("failed to inspect player %q: %w", user.Username, err)
+		}
+		result.Players = append(result.Players, inspection)
+	}
+	return result, nil
+}
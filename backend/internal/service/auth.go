@@ -30,6 +30,7 @@ func (a *Auth) Login(ctx context.Context, username, password string) (string, er
 	}
 	token := jwt.NewWithClaims(jwt.SigningMethodHS512, jwt.MapClaims{
 		"user_id": fmt.Sprint(user.ID),
+		"role":    string(user.Role),
 		"iat":     float64(time.Now().UTC().UnixNano()) / 1e9,
 	})
 	tokenString, err := token.SignedString(a.cfg.TokenSigningKeyBytes())
@@ -76,9 +77,21 @@ func (a *Auth) ValidateToken(ctx context.Context, tokenStr string) (*domain.User
 		slog.Error("failed to find valid user by id", "user_id", userId)
 		return nil, false
 	}
+	// tokens issued before the role was added are player tokens
+	role, _ := claims["role"].(string)
+	if role == "" {
+		role = string(domain.RolePlayer)
+	}
+	if domain.Role(role) != user.Role {
+		return nil, false
+	}
 	return user, true
 }
 
 func (a *Auth) IsGamePaused(ctx context.Context) (bool, error) {
 	return a.gameStateStore.GetIsPaused(ctx)
 }
+
+func (a *Auth) SetGamePaused(ctx context.Context, paused bool) error {
+	return a.gameStateStore.SetIsPaused(ctx, paused)
+}
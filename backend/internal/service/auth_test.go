@@ -0,0 +1,103 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/Rastaiha/bermudia/internal/config"
+	"github.com/Rastaiha/bermudia/internal/domain"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type memoryUserStore struct {
+	domain.UserStore
+	users map[int32]*domain.User
+}
+
+func (s *memoryUserStore) Get(_ context.Context, id int32) (*domain.User, error) {
+	u, ok := s.users[id]
+	if !ok {
+		return nil, domain.ErrUserNotFound
+	}
+	copied := *u
+	return &copied, nil
+}
+
+func (s *memoryUserStore) GetByUsername(_ context.Context, username string) (*domain.User, error) {
+	for _, u := range s.users {
+		if u.Username == username {
+			copied := *u
+			return &copied, nil
+		}
+	}
+	return nil, domain.ErrUserNotFound
+}
+
+func (s *memoryUserStore) SetRole(_ context.Context, id int32, role domain.Role) error {
+	u, ok := s.users[id]
+	if !ok {
+		return domain.ErrUserNotFound
+	}
+	u.Role = role
+	return nil
+}
+
+func TestValidateTokenRole(t *testing.T) {
+	ctx := context.Background()
+	cfg := config.Config{TokenSigningKey: base64.StdEncoding.EncodeToString([]byte("test-signing-key"))}
+	password, err := domain.HashPassword("pass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	users := &memoryUserStore{users: map[int32]*domain.User{
+		1: {ID: 1, Username: "player", Role: domain.RolePlayer, HashedPassword: password},
+		2: {ID: 2, Username: "corrector", Role: domain.RoleCorrector, HashedPassword: password},
+	}}
+	auth := NewAuth(cfg, users, nil)
+
+	sign := func(claims jwt.MapClaims) string {
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS512, claims).SignedString(cfg.TokenSigningKeyBytes())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	now := float64(time.Now().Unix())
+
+	tests := []struct {
+		name  string
+		token string
+		want  bool
+	}{
+		{name: "current role", token: sign(jwt.MapClaims{"user_id": "2", "role": "corrector", "iat": now}), want: true},
+		{name: "stale role", token: sign(jwt.MapClaims{"user_id": "2", "role": "admin", "iat": now})},
+		{name: "stale player role", token: sign(jwt.MapClaims{"user_id": "2", "role": "player", "iat": now})},
+		{name: "token without role of a player", token: sign(jwt.MapClaims{"user_id": "1", "iat": now}), want: true},
+		{name: "token without role of a corrector", token: sign(jwt.MapClaims{"user_id": "2", "iat": now})},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, ok := auth.ValidateToken(ctx, tt.token); ok != tt.want {
+				t.Errorf("ValidateToken() = %v, want %v", ok, tt.want)
+			}
+		})
+	}
+
+	t.Run("role changed after login", func(t *testing.T) {
+		token, err := auth.Login(ctx, "player", "pass")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := auth.ValidateToken(ctx, token); !ok {
+			t.Fatal("ValidateToken rejected a fresh token")
+		}
+		if err := users.SetRole(ctx, 1, domain.RoleMentor); err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := auth.ValidateToken(ctx, token); ok {
+			t.Error("ValidateToken accepted a token issued before the role changed")
+		}
+	})
+}
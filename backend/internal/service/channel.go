@@ -0,0 +1,84 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/Rastaiha/bermudia/internal/config"
+	"github.com/Rastaiha/bermudia/internal/domain"
+	"time"
+)
+
+// CorrectionChannel delivers submitted answers to correctors and correction related events to admins.
+type CorrectionChannel interface {
+	HandleNewAnswer(username string, territory string, question domain.BookQuestion, answer domain.Answer)
+	HandleHelpRequest(territory string, user *domain.User, question domain.BookQuestion) error
+	HandlePendingBacklog(backlog map[string]int)
+	HandleClaimReleased(claim domain.AnswerClaim)
+	HandleStatsDigest(stats []domain.CorrectorStats, since time.Time)
+	HandleCorrectionDispute(dispute domain.CorrectionDispute)
+}
+
+// ConnectCorrectionChannel registers the channel as the receiver of the correction related callbacks.
+// In dev mode, answers that can be auto corrected never reach the channel.
+func ConnectCorrectionChannel(cfg config.Config, channel CorrectionChannel, island *Island, correction *Correction) {
+	island.OnNewAnswer(func(username string, territory string, question domain.BookQuestion, answer domain.Answer) {
+		if cfg.DevMode {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			if correction.AutoCorrect(ctx, answer) {
+				return
+			}
+		}
+		channel.HandleNewAnswer(username, territory, question, answer)
+	})
+	island.OnHelpRequest(channel.HandleHelpRequest)
+	island.OnPendingBacklog(channel.HandlePendingBacklog)
+	correction.OnClaimReleased(channel.HandleClaimReleased)
+	correction.OnStatsDigest(channel.HandleStatsDigest)
+	correction.OnDispute(channel.HandleCorrectionDispute)
+}
+
+type fanoutChannel []CorrectionChannel
+
+// FanoutCorrectionChannel returns a channel that delivers every event to all the given channels.
+func FanoutCorrectionChannel(channels ...CorrectionChannel) CorrectionChannel {
+	return fanoutChannel(channels)
+}
+
+func (f fanoutChannel) HandleNewAnswer(username string, territory string, question domain.BookQuestion, answer domain.Answer) {
+	for _, c := range f {
+		c.HandleNewAnswer(username, territory, question, answer)
+	}
+}
+
+func (f fanoutChannel) HandleHelpRequest(territory string, user *domain.User, question domain.BookQuestion) error {
+	var err error
+	for _, c := range f {
+		err = errors.Join(err, c.HandleHelpRequest(territory, user, question))
+	}
+	return err
+}
+
+func (f fanoutChannel) HandlePendingBacklog(backlog map[string]int) {
+	for _, c := range f {
+		c.HandlePendingBacklog(backlog)
+	}
+}
+
+func (f fanoutChannel) HandleClaimReleased(claim domain.AnswerClaim) {
+	for _, c := range f {
+		c.HandleClaimReleased(claim)
+	}
+}
+
+func (f fanoutChannel) HandleStatsDigest(stats []domain.CorrectorStats, since time.Time) {
+	for _, c := range f {
+		c.HandleStatsDigest(stats, since)
+	}
+}
+
+func (f fanoutChannel) HandleCorrectionDispute(dispute domain.CorrectionDispute) {
+	for _, c := range f {
+		c.HandleCorrectionDispute(dispute)
+	}
+}
@@ -0,0 +1,482 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Rastaiha/bermudia/internal/domain"
+	"maps"
+	"slices"
+	"time"
+)
+
+var errDryRun = errors.New("dry run")
+
+// InTransaction runs f with an Admin whose writes all happen in a single transaction.
+// If f fails, nothing it wrote is kept. In a dry run the transaction is always rolled back,
+// which lets every check of the admin methods run against the stored content without changing it.
+// Postgres does not roll back sequences though, so a dry run still consumes the ids of serial columns it inserts into.
+func (a *Admin) InTransaction(ctx context.Context, dryRun bool, f func(tx *Admin) error) error {
+	err := a.transactor.InContentTx(ctx, func(stores domain.ContentStores) error {
+		tx := &Admin{
+			cfg:            a.cfg,
+			territoryStore: stores.Territory,
+			islandStore:    stores.Island,
+			userStore:      stores.User,
+			playerStore:    stores.Player,
+			questionStore:  stores.Question,
+			treasureStore:  stores.Treasure,
+			templateStore:  stores.FeedbackTemplate,
+			versionStore:   stores.ContentVersion,
+			transactor:     a.transactor,
+		}
+		if err := f(tx); err != nil {
+			return err
+		}
+		if dryRun {
+			return errDryRun
+		}
+		return nil
+	})
+	if dryRun && errors.Is(err, errDryRun) {
+		return nil
+	}
+	return err
+}
+
+// ContentDiff describes how a content upload differs from the stored content.
+type ContentDiff struct {
+	Territories  []TerritoryDiff `json:"territories,omitempty"`
+	Books        []BookDiff      `json:"books,omitempty"`
+	NewUsers     []string        `json:"newUsers,omitempty"`
+	UpdatedUsers []string        `json:"updatedUsers,omitempty"`
+}
+
+type TerritoryDiff struct {
+	TerritoryID    string   `json:"territoryId"`
+	New            bool     `json:"new,omitempty"`
+	AddedIslands   []string `json:"addedIslands,omitempty"`
+	RemovedIslands []string `json:"removedIslands,omitempty"`
+}
+
+type BookDiff struct {
+	// Target is the island or the pool the book is bound to.
+	Target           string           `json:"target"`
+	BookID           string           `json:"bookId,omitempty"`
+	New              bool             `json:"new,omitempty"`
+	ReplacedBookID   string           `json:"replacedBookId,omitempty"`
+	AddedQuestions   int              `json:"addedQuestions,omitempty"`
+	RemovedQuestions []string         `json:"removedQuestions,omitempty"`
+	ChangedQuestions []QuestionChange `json:"changedQuestions,omitempty"`
+	// Answers counts the submitted answers of the stored book, or of the replaced one.
+	Answers int `json:"answers,omitempty"`
+}
+
+type QuestionChange struct {
+	QuestionID string   `json:"questionId"`
+	Fields     []string `json:"fields"`
+	Answers    int      `json:"answers,omitempty"`
+}
+
+func (d TerritoryDiff) changed() bool {
+	return d.New || len(d.AddedIslands) > 0 || len(d.RemovedIslands) > 0
+}
+
+func (d BookDiff) changed() bool {
+	return d.New || d.ReplacedBookID != "" || d.AddedQuestions > 0 || len(d.RemovedQuestions) > 0 || len(d.ChangedQuestions) > 0
+}
+
+// DiffTerritory adds the differences between the territory and its stored version to diff.
+func (a *Admin) DiffTerritory(ctx context.Context, territory domain.Territory, diff *ContentDiff) error {
+	d := TerritoryDiff{TerritoryID: territory.ID}
+	var storedIslands []domain.Island
+	stored, err := a.territoryStore.GetTerritoryByID(ctx, territory.ID)
+	if errors.Is(err, domain.ErrTerritoryNotFound) {
+		d.New = true
+	} else if err != nil {
+		return err
+	} else {
+		storedIslands = stored.Islands
+	}
+	hasIsland := func(islands []domain.Island, id string) bool {
+		return slices.ContainsFunc(islands, func(island domain.Island) bool { return island.ID == id })
+	}
+	for _, island := range territory.Islands {
+		if !hasIsland(storedIslands, island.ID) {
+			d.AddedIslands = append(d.AddedIslands, island.ID)
+		}
+	}
+	for _, island := range storedIslands {
+		if !hasIsland(territory.Islands, island.ID) {
+			d.RemovedIslands = append(d.RemovedIslands, island.ID)
+		}
+	}
+	if d.changed() {
+		diff.Territories = append(diff.Territories, d)
+	}
+	return nil
+}
+
+// DiffIslandBook adds the differences between the book and the book currently bound to the island to diff.
+func (a *Admin) DiffIslandBook(ctx context.Context, islandId string, input BookInput, diff *ContentDiff) error {
+	d := BookDiff{Target: islandId, BookID: input.BookId}
+	header, err := a.islandStore.GetIslandHeader(ctx, islandId)
+	if err != nil && !errors.Is(err, domain.ErrIslandNotFound) {
+		return err
+	}
+	// a new island has no book to replace
+	if err == nil && header.BookID != "" && header.BookID != input.BookId {
+		d.ReplacedBookID = header.BookID
+		answers, err := a.questionStore.CountBookAnswers(ctx, header.BookID)
+		if err != nil {
+			return err
+		}
+		for _, count := range answers {
+			d.Answers += count
+		}
+	}
+	return a.diffBook(ctx, d, input, diff)
+}
+
+// DiffPoolBook adds the differences between the book and its stored version to diff.
+func (a *Admin) DiffPoolBook(ctx context.Context, poolId string, input BookInput, diff *ContentDiff) error {
+	return a.diffBook(ctx, BookDiff{Target: poolId, BookID: input.BookId}, input, diff)
+}
+
+func (a *Admin) diffBook(ctx context.Context, d BookDiff, input BookInput, diff *ContentDiff) error {
+	var stored *domain.Book
+	if input.BookId != "" && domain.IdHasType(input.BookId, domain.ResourceTypeBook) {
+		var err error
+		stored, err = a.islandStore.GetBook(ctx, input.BookId)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+	}
+	if stored == nil {
+		d.New = true
+		d.BookID = ""
+		for _, c := range input.Components {
+			if c.Question != nil {
+				d.AddedQuestions++
+			}
+		}
+		diff.Books = append(diff.Books, d)
+		return nil
+	}
+
+	answers, err := a.questionStore.CountBookAnswers(ctx, stored.ID)
+	if err != nil {
+		return err
+	}
+	inputQuestions := make(map[string]*IslandInputQuestion)
+	for _, c := range input.Components {
+		if c.Question == nil {
+			continue
+		}
+		if c.Question.ID == "" || !domain.IdHasType(c.Question.ID, domain.ResourceTypeQuestion) {
+			d.AddedQuestions++
+			continue
+		}
+		inputQuestions[c.Question.ID] = c.Question
+	}
+	storedQuestionIds := make(map[string]bool)
+	for _, c := range stored.Components {
+		if c.Question == nil {
+			continue
+		}
+		storedQuestionIds[c.Question.ID] = true
+		q, ok := inputQuestions[c.Question.ID]
+		if !ok {
+			d.RemovedQuestions = append(d.RemovedQuestions, c.Question.ID)
+			d.Answers += answers[c.Question.ID]
+			continue
+		}
+		storedQuestion, err := a.questionStore.GetQuestion(ctx, c.Question.ID)
+		if err != nil {
+			return fmt.Errorf("failed to get question %q: %w", c.Question.ID, err)
+		}
+		if fields := changedQuestionFields(storedQuestion, q); len(fields) > 0 {
+			d.ChangedQuestions = append(d.ChangedQuestions, QuestionChange{
+				QuestionID: c.Question.ID,
+				Fields:     fields,
+				Answers:    answers[c.Question.ID],
+			})
+			d.Answers += answers[c.Question.ID]
+		}
+	}
+	for id := range inputQuestions {
+		if !storedQuestionIds[id] {
+			d.AddedQuestions++
+		}
+	}
+	if d.changed() {
+		diff.Books = append(diff.Books, d)
+	}
+	return nil
+}
+
+func changedQuestionFields(stored domain.BookQuestion, q *IslandInputQuestion) []string {
+	var fields []string
+	if stored.Text != q.Text {
+		fields = append(fields, "text")
+	}
+	if stored.InputType != q.InputType {
+		fields = append(fields, "inputType")
+	}
+	if !slices.Equal(stored.InputAccept, q.InputAccept) && (len(stored.InputAccept) > 0 || len(q.InputAccept) > 0) {
+		fields = append(fields, "inputAccept")
+	}
+	if stored.MaxFileSize != q.MaxFileSize {
+		fields = append(fields, "maxFileSize")
+	}
+	if stored.KnowledgeAmount != q.KnowledgeAmount {
+		fields = append(fields, "knowledgeAmount")
+	}
+	if stored.RewardSource != q.RewardSource {
+		fields = append(fields, "rewardSource")
+	}
+	if stored.Context != q.Context {
+		fields = append(fields, "correctionHintMessage")
+	}
+	return fields
+}
+
+// DiffUser records whether the user is new or an existing one that will be updated.
+func (a *Admin) DiffUser(ctx context.Context, user User, diff *ContentDiff) error {
+	_, err := a.userStore.GetByUsername(ctx, user.Username)
+	if errors.Is(err, domain.ErrUserNotFound) {
+		diff.NewUsers = append(diff.NewUsers, user.Username)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	diff.UpdatedUsers = append(diff.UpdatedUsers, user.Username)
+	return nil
+}
+
+// GameContent is the stored content in the form SetGameContent consumes it.
+type GameContent struct {
+	Territories []domain.Territory `json:"territories"`
+	// IslandBooks maps island ids to the book bound to the island.
+	IslandBooks map[string]BookInput `json:"islandBooks"`
+	// PoolBooks maps pool ids to the books of the pool.
+	PoolBooks map[string][]BookInput    `json:"poolBooks"`
+	Bindings  []TerritoryIslandBindings `json:"bindings"`
+}
+
+// ExportContent reads the content from the stores, with all ids filled in.
+func (a *Admin) ExportContent(ctx context.Context) (GameContent, error) {
+	content := GameContent{
+		IslandBooks: make(map[string]BookInput),
+		PoolBooks:   make(map[string][]BookInput),
+	}
+	territories, err := a.territoryStore.ListTerritories(ctx)
+	if err != nil {
+		return content, err
+	}
+	content.Territories = territories
+	for _, t := range territories {
+		headers, err := a.islandStore.GetIslandHeadersByTerritory(ctx, t.ID)
+		if err != nil {
+			return content, err
+		}
+		for _, h := range headers {
+			if h.BookID == "" || h.FromPool {
+				continue
+			}
+			book, err := a.exportBook(ctx, h.BookID)
+			if err != nil {
+				return content, fmt.Errorf("failed to export book of island %q: %w", h.ID, err)
+			}
+			content.IslandBooks[h.ID] = book
+		}
+		bindings, err := a.GetTerritoryIslandBindings(ctx, t.ID)
+		if err != nil {
+			return content, err
+		}
+		if len(bindings.EmptyIslands) > 0 || len(bindings.PooledIslands) > 0 || bindings.PoolSettings.TotalCount() > 0 {
+			content.Bindings = append(content.Bindings, bindings)
+		}
+	}
+	pools, err := a.islandStore.GetPoolBooks(ctx)
+	if err != nil {
+		return content, err
+	}
+	for poolId, bookIds := range pools {
+		for _, bookId := range bookIds {
+			book, err := a.exportBook(ctx, bookId)
+			if err != nil {
+				return content, fmt.Errorf("failed to export book %q of pool %q: %w", bookId, poolId, err)
+			}
+			content.PoolBooks[poolId] = append(content.PoolBooks[poolId], book)
+		}
+	}
+	return content, nil
+}
+
+func (a *Admin) exportBook(ctx context.Context, bookId string) (BookInput, error) {
+	input := BookInput{BookId: bookId, Components: make([]*BookInputComponent, 0)}
+	book, err := a.islandStore.GetBook(ctx, bookId)
+	if err != nil {
+		return input, err
+	}
+	for _, c := range book.Components {
+		if c.IFrame != nil {
+			input.Components = append(input.Components, &BookInputComponent{IFrame: c.IFrame})
+			continue
+		}
+		if c.Question == nil {
+			continue
+		}
+		q, err := a.questionStore.GetQuestion(ctx, c.Question.ID)
+		if err != nil {
+			return input, fmt.Errorf("failed to get question %q: %w", c.Question.ID, err)
+		}
+		templates, err := a.templateStore.GetTemplates(ctx, c.Question.ID, "")
+		if err != nil {
+			return input, fmt.Errorf("failed to get feedback templates of question %q: %w", c.Question.ID, err)
+		}
+		var feedbackTemplates []string
+		for _, t := range templates {
+			if t.FromContent {
+				feedbackTemplates = append(feedbackTemplates, t.Text)
+			}
+		}
+		input.Components = append(input.Components, &BookInputComponent{Question: &IslandInputQuestion{
+			Question:          *c.Question,
+			KnowledgeAmount:   q.KnowledgeAmount,
+			RewardSource:      q.RewardSource,
+			Context:           q.Context,
+			FeedbackTemplates: feedbackTemplates,
+		}})
+	}
+	for _, t := range book.Treasures {
+		input.Treasures = append(input.Treasures, &BookTreasureComponent{ID: t.ID})
+	}
+	return input, nil
+}
+
+// checkUnanswered fails if a question of the book other than the kept ones has answers.
+func (a *Admin) checkUnanswered(ctx context.Context, bookId string, kept map[string]bool) error {
+	answers, err := a.questionStore.CountBookAnswers(ctx, bookId)
+	if err != nil {
+		return err
+	}
+	for questionId, count := range answers {
+		if count > 0 && !kept[questionId] {
+			return fmt.Errorf("%w: question %q of book %q has %d answers; use force to apply anyway",
+				domain.ErrAnsweredQuestionChange, questionId, bookId, count)
+		}
+	}
+	return nil
+}
+
+// checkQuestionsKept fails if binding the questions to the book would delete a question of the book
+// that has answers, or move a question that has answers from another book.
+func (a *Admin) checkQuestionsKept(ctx context.Context, bookId string, questions []domain.BookQuestion) error {
+	kept := make(map[string]bool)
+	for _, q := range questions {
+		kept[q.QuestionID] = true
+		stored, err := a.questionStore.GetQuestion(ctx, q.QuestionID)
+		if errors.Is(err, domain.ErrQuestionNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if stored.BookID == bookId {
+			continue
+		}
+		answers, err := a.questionStore.CountBookAnswers(ctx, stored.BookID)
+		if err != nil {
+			return err
+		}
+		if answers[q.QuestionID] > 0 {
+			return fmt.Errorf("%w: question %q with %d answers would move from book %q to %q; use force to apply anyway",
+				domain.ErrAnsweredQuestionChange, q.QuestionID, answers[q.QuestionID], stored.BookID, bookId)
+		}
+	}
+	return a.checkUnanswered(ctx, bookId, kept)
+}
+
+// ApplyContent stores exported content. Users are not touched.
+func (a *Admin) ApplyContent(ctx context.Context, content GameContent, force bool) error {
+	for _, t := range content.Territories {
+		if err := a.SetTerritory(ctx, t); err != nil {
+			return fmt.Errorf("failed to set territory %q: %w", t.ID, err)
+		}
+	}
+	// the maps are applied in key order, so that the same content always fails at the same item
+	for _, islandId := range slices.Sorted(maps.Keys(content.IslandBooks)) {
+		if _, err := a.SetBookAndBindToIsland(ctx, islandId, content.IslandBooks[islandId], force); err != nil {
+			return fmt.Errorf("failed to set book of island %q: %w", islandId, err)
+		}
+	}
+	for _, poolId := range slices.Sorted(maps.Keys(content.PoolBooks)) {
+		for _, book := range content.PoolBooks[poolId] {
+			if _, err := a.SetBookAndBindToPool(ctx, poolId, book, force); err != nil {
+				return fmt.Errorf("failed to set book %q of pool %q: %w", book.BookId, poolId, err)
+			}
+		}
+	}
+	for _, bindings := range content.Bindings {
+		if _, err := a.SetTerritoryIslandBindings(ctx, bindings, force); err != nil {
+			return fmt.Errorf("failed to set island bindings of territory %q: %w", bindings.TerritoryId, err)
+		}
+	}
+	return nil
+}
+
+// RecordContentVersion stores a snapshot of the current content as a new version.
+func (a *Admin) RecordContentVersion(ctx context.Context, author string) (domain.ContentVersion, error) {
+	content, err := a.ExportContent(ctx)
+	if err != nil {
+		return domain.ContentVersion{}, err
+	}
+	snapshot, err := json.Marshal(content)
+	if err != nil {
+		return domain.ContentVersion{}, err
+	}
+	checksum := sha256.Sum256(snapshot)
+	version := domain.ContentVersion{
+		Author:    author,
+		CreatedAt: time.Now().UTC(),
+		Checksum:  hex.EncodeToString(checksum[:]),
+		Content:   snapshot,
+	}
+	if err := a.versionStore.Create(ctx, &version); err != nil {
+		return version, err
+	}
+	return version, nil
+}
+
+func (a *Admin) ListContentVersions(ctx context.Context) ([]domain.ContentVersion, error) {
+	return a.versionStore.List(ctx)
+}
+
+// RollbackContent applies the content of the version and records the result as a new version.
+// Books, questions and territories added after the version are left as they are,
+// but islands and questions of the version are bound back the way they were.
+func (a *Admin) RollbackContent(ctx context.Context, version int32, author string, force bool) (result domain.ContentVersion, err error) {
+	err = a.InTransaction(ctx, false, func(tx *Admin) error {
+		v, err := tx.versionStore.Get(ctx, version)
+		if err != nil {
+			return err
+		}
+		var content GameContent
+		if err := json.Unmarshal(v.Content, &content); err != nil {
+			return fmt.Errorf("failed to read content of version %d: %w", version, err)
+		}
+		if err := tx.ApplyContent(ctx, content, force); err != nil {
+			return err
+		}
+		result, err = tx.RecordContentVersion(ctx, fmt.Sprintf("%s (rollback to %d)", author, version))
+		return err
+	})
+	return result, err
+}
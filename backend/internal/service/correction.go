@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"github.com/Rastaiha/bermudia/internal/config"
 	"github.com/Rastaiha/bermudia/internal/domain"
+	"github.com/go-co-op/gocron/v2"
 	"log/slog"
 	"slices"
 	"strings"
@@ -13,23 +14,292 @@ import (
 )
 
 type Correction struct {
-	cfg           config.Config
-	questionStore domain.QuestionStore
+	cfg             config.Config
+	island          *Island
+	questionStore   domain.QuestionStore
+	islandStore     domain.IslandStore
+	templateStore   domain.FeedbackTemplateStore
+	userStore       domain.UserStore
+	onClaimReleased ClaimReleasedCallback
+	onStatsDigest   StatsDigestCallback
+	onDispute       CorrectionDisputeCallback
+	cron            gocron.Scheduler
 }
 
-func NewCorrection(cfg config.Config, questionStore domain.QuestionStore) *Correction {
+type ClaimReleasedCallback func(claim domain.AnswerClaim)
+
+type StatsDigestCallback func(stats []domain.CorrectorStats, since time.Time)
+
+type CorrectionDisputeCallback func(dispute domain.CorrectionDispute)
+
+var autoCorrector = domain.Corrector{Name: "auto"}
+
+func NewCorrection(cfg config.Config, island *Island, questionStore domain.QuestionStore, islandStore domain.IslandStore, templateStore domain.FeedbackTemplateStore, userStore domain.UserStore) *Correction {
 	return &Correction{
 		cfg:           cfg,
+		island:        island,
 		questionStore: questionStore,
+		islandStore:   islandStore,
+		templateStore: templateStore,
+		userStore:     userStore,
+	}
+}
+
+func (c *Correction) Start() {
+	var err error
+	c.cron, err = gocron.NewScheduler(gocron.WithLimitConcurrentJobs(1, gocron.LimitModeReschedule))
+	if err != nil {
+		panic(err)
+	}
+	_, err = c.cron.NewJob(gocron.DurationJob(c.cfg.ClaimReleaseInterval), gocron.NewTask(c.releaseExpiredClaims))
+	if err != nil {
+		panic(err)
+	}
+	_, err = c.cron.NewJob(
+		gocron.WeeklyJob(1, gocron.NewWeekdays(time.Saturday), gocron.NewAtTimes(gocron.NewAtTime(6, 0, 0))),
+		gocron.NewTask(c.sendStatsDigest),
+	)
+	if err != nil {
+		panic(err)
 	}
+	c.cron.Start()
+}
+
+func (c *Correction) Stop() {
+	if err := c.cron.Shutdown(); err != nil {
+		slog.Error("failed to stop cron", slog.String("error", err.Error()))
+	}
+}
+
+func (c *Correction) OnClaimReleased(f ClaimReleasedCallback) {
+	c.onClaimReleased = f
+}
+
+func (c *Correction) OnStatsDigest(f StatsDigestCallback) {
+	c.onStatsDigest = f
+}
+
+func (c *Correction) OnDispute(f CorrectionDisputeCallback) {
+	c.onDispute = f
+}
+
+func (c *Correction) sendStatsDigest(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+
+	since := time.Now().UTC().AddDate(0, 0, -7)
+	stats, err := c.GetCorrectorStats(ctx, since)
+	if err != nil {
+		slog.Error("failed to get corrector stats", slog.String("error", err.Error()))
+		return
+	}
+	if c.onStatsDigest != nil {
+		c.onStatsDigest(stats, since)
+	}
+}
+
+// GetCorrectorStats returns statistics of corrections finalized since the given time.
+func (c *Correction) GetCorrectorStats(ctx context.Context, since time.Time) ([]domain.CorrectorStats, error) {
+	records, err := c.questionStore.GetFinalizedCorrections(ctx, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get finalized corrections: %w", err)
+	}
+	return domain.GetCorrectorStats(records), nil
+}
+
+func (c *Correction) releaseExpiredClaims(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+
+	claims, err := c.questionStore.GetExpiredAnswerClaims(ctx, time.Now().UTC())
+	if err != nil {
+		slog.Error("failed to get expired answer claims", slog.String("error", err.Error()))
+		return
+	}
+	for _, claim := range claims {
+		released, err := c.questionStore.ReleaseAnswerClaim(ctx, claim)
+		if err != nil {
+			slog.Error("failed to release expired answer claim", slog.String("error", err.Error()))
+			continue
+		}
+		if released {
+			c.claimReleased(ctx, claim)
+		}
+	}
+	if len(claims) > 0 {
+		slog.Info("released expired answer claims", slog.Int("count", len(claims)))
+	}
+}
+
+// Claim marks the pending answer as being corrected by the corrector.
+// The message identified by chatId and messageId is the one the corrector is working on.
+func (c *Correction) Claim(ctx context.Context, corrector domain.Corrector, userId int32, questionId string, chatId int64, messageId int) (domain.AnswerClaim, error) {
+	answer, err := c.questionStore.GetAnswer(ctx, userId, questionId)
+	if err != nil {
+		return domain.AnswerClaim{}, err
+	}
+	if answer.Status != domain.AnswerStatusPending {
+		return domain.AnswerClaim{}, domain.ErrAnswerNotPending
+	}
+	if err := c.checkSecondCorrector(ctx, corrector, userId, questionId); err != nil {
+		return domain.AnswerClaim{}, err
+	}
+	now := time.Now().UTC()
+	claim, err := c.questionStore.ClaimAnswer(ctx, domain.AnswerClaim{
+		UserID:     userId,
+		QuestionID: questionId,
+		Corrector:  corrector,
+		ChatID:     chatId,
+		MessageID:  messageId,
+		ClaimedAt:  now,
+		ExpiresAt:  now.Add(c.cfg.CorrectionClaimTimeout),
+	})
+	if err != nil {
+		return claim, err
+	}
+	if claim.Corrector.ID != corrector.ID {
+		return claim, fmt.Errorf("%w: %s", domain.ErrAnswerClaimed, claim.Corrector.Name)
+	}
+	return claim, nil
+}
+
+// Unclaim releases the claim of the answer, re-posts the answer to the correctors
+// and reports the release through the ClaimReleasedCallback.
+// Only the claimant can release a claim unless force is set.
+func (c *Correction) Unclaim(ctx context.Context, corrector domain.Corrector, userId int32, questionId string, force bool) error {
+	claim, found, err := c.questionStore.GetAnswerClaim(ctx, userId, questionId)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return errors.New("answer is not claimed")
+	}
+	if !force && claim.Corrector.ID != corrector.ID {
+		return fmt.Errorf("%w: %s", domain.ErrAnswerClaimed, claim.Corrector.Name)
+	}
+	released, err := c.questionStore.ReleaseAnswerClaim(ctx, claim)
+	if err != nil {
+		return err
+	}
+	if !released {
+		return errors.New("answer claim changed concurrently; try again")
+	}
+	c.claimReleased(ctx, claim)
+	return nil
+}
+
+// claimReleased re-posts the answer of the released claim, so that another corrector can claim it.
+func (c *Correction) claimReleased(ctx context.Context, claim domain.AnswerClaim) {
+	if err := c.island.ResendAnswer(ctx, claim.UserID, claim.QuestionID); err != nil {
+		slog.Error("failed to resend released answer", slog.String("error", err.Error()))
+	}
+	if c.onClaimReleased != nil {
+		c.onClaimReleased(claim)
+	}
+}
+
+// GetQueue returns the answers waiting to be corrected that match the filter, oldest first.
+func (c *Correction) GetQueue(ctx context.Context, filter domain.CorrectionQueueFilter) ([]domain.QueuedAnswer, error) {
+	queue, err := c.questionStore.GetCorrectionQueue(ctx)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]domain.QueuedAnswer, 0)
+	for _, queued := range queue {
+		if filter.Matches(queued) {
+			result = append(result, queued)
+		}
+	}
+	return result, nil
+}
+
+// GetQueuedAnswer returns the pending answer along with what a corrector needs to know about it.
+func (c *Correction) GetQueuedAnswer(ctx context.Context, userId int32, questionId string) (domain.QueuedAnswer, error) {
+	answer, err := c.questionStore.GetAnswer(ctx, userId, questionId)
+	if err != nil {
+		return domain.QueuedAnswer{}, err
+	}
+	if answer.Status != domain.AnswerStatusPending {
+		return domain.QueuedAnswer{}, domain.ErrAnswerNotPending
+	}
+	return c.queuedAnswer(ctx, answer)
+}
+
+func (c *Correction) queuedAnswer(ctx context.Context, answer domain.Answer) (domain.QueuedAnswer, error) {
+	queued := domain.QueuedAnswer{Answer: answer}
+	user, err := c.userStore.Get(ctx, answer.UserID)
+	if err != nil {
+		return queued, err
+	}
+	queued.Username = user.Username
+	queued.Question, err = c.questionStore.GetQuestion(ctx, answer.QuestionID)
+	if err != nil {
+		return queued, err
+	}
+	if islandHeader, err := c.islandStore.GetIslandHeaderByBookIdAndUserId(ctx, queued.Question.BookID, answer.UserID); err == nil {
+		queued.Territory = islandHeader.TerritoryID
+	}
+	pool, hasPool, err := c.islandStore.GetPoolOfBook(ctx, queued.Question.BookID)
+	if err != nil {
+		return queued, err
+	}
+	if hasPool {
+		queued.Pool = pool
+	}
+	claim, found, err := c.questionStore.GetAnswerClaim(ctx, answer.UserID, answer.QuestionID)
+	if err != nil {
+		return queued, err
+	}
+	if found && claim.ExpiresAt.After(time.Now().UTC()) {
+		queued.Claim = &claim
+	}
+	return queued, nil
+}
+
+func (c *Correction) checkClaim(ctx context.Context, corrector domain.Corrector, userId int32, questionId string) error {
+	claim, found, err := c.questionStore.GetAnswerClaim(ctx, userId, questionId)
+	if err != nil {
+		return err
+	}
+	if found && claim.HeldByOther(corrector, time.Now().UTC()) {
+		return fmt.Errorf("%w: %s", domain.ErrAnswerClaimed, claim.Corrector.Name)
+	}
+	return nil
+}
+
+// checkSecondCorrector rejects the corrector if they have already given the first grade of the answer.
+func (c *Correction) checkSecondCorrector(ctx context.Context, corrector domain.Corrector, userId int32, questionId string) error {
+	if !c.cfg.SecondGrading {
+		return nil
+	}
+	blind, err := c.questionStore.GetAnswerCorrections(ctx, userId, questionId, domain.CorrectionStatusBlind)
+	if err != nil {
+		return err
+	}
+	for _, b := range blind {
+		if b.Corrector.ID == corrector.ID {
+			return domain.ErrSecondGradeBySameCorrector
+		}
+	}
+	return nil
+}
+
+func (c *Correction) checkCorrectionClaim(ctx context.Context, corrector domain.Corrector, correctionId string) error {
+	correction, err := c.questionStore.GetCorrection(ctx, correctionId)
+	if err != nil {
+		return err
+	}
+	return c.checkClaim(ctx, corrector, correction.UserId, correction.QuestionId)
 }
 
 func (c *Correction) AutoCorrect(ctx context.Context, answer domain.Answer) bool {
 	correction := domain.Correction{
-		ID:         domain.NewID(domain.ResourceTypeCorrection),
-		QuestionId: answer.QuestionID,
-		UserId:     answer.UserID,
-		UpdatedAt:  time.Now().UTC(),
+		ID:          domain.NewID(domain.ResourceTypeCorrection),
+		QuestionId:  answer.QuestionID,
+		UserId:      answer.UserID,
+		Corrector:   autoCorrector,
+		SubmittedAt: answer.UpdatedAt,
+		UpdatedAt:   time.Now().UTC(),
 	}
 	create := false
 	lowerFilename := strings.ToLower(answer.Filename.String)
@@ -56,35 +326,264 @@ func (c *Correction) AutoCorrect(ctx context.Context, answer domain.Answer) bool
 	return create
 }
 
-func (c *Correction) CreateCorrection(ctx context.Context, userId int32, questionId string, newStatus domain.AnswerStatus) (string, error) {
+func (c *Correction) CreateCorrection(ctx context.Context, corrector domain.Corrector, userId int32, questionId string, newStatus domain.AnswerStatus) (string, error) {
 	if !slices.Contains(domain.CorrectionAllowedNewStatuses, newStatus) {
 		return "", errors.New("invalid new answer status")
 	}
+	if err := c.checkClaim(ctx, corrector, userId, questionId); err != nil {
+		return "", err
+	}
+	if err := c.checkSecondCorrector(ctx, corrector, userId, questionId); err != nil {
+		return "", err
+	}
+	answer, err := c.questionStore.GetAnswer(ctx, userId, questionId)
+	if err != nil {
+		return "", err
+	}
 	correction := domain.Correction{
-		ID:         domain.NewID(domain.ResourceTypeCorrection),
-		QuestionId: questionId,
-		UserId:     userId,
-		NewStatus:  newStatus,
-		UpdatedAt:  time.Now().UTC(),
+		ID:          domain.NewID(domain.ResourceTypeCorrection),
+		QuestionId:  questionId,
+		UserId:      userId,
+		NewStatus:   newStatus,
+		Corrector:   corrector,
+		SubmittedAt: answer.UpdatedAt,
+		UpdatedAt:   time.Now().UTC(),
 	}
-	err := c.questionStore.CreateCorrection(ctx, correction)
+	err = c.questionStore.CreateCorrection(ctx, correction)
 	if err != nil {
 		return correction.ID, fmt.Errorf("failed to create correction: %w", err)
 	}
 	return correction.ID, nil
 }
 
-func (c *Correction) UpdateCorrectionNewStatus(ctx context.Context, correctionId string, newStatus domain.AnswerStatus) error {
+func (c *Correction) UpdateCorrectionNewStatus(ctx context.Context, corrector domain.Corrector, correctionId string, newStatus domain.AnswerStatus) error {
 	if !slices.Contains(domain.CorrectionAllowedNewStatuses, newStatus) {
 		return errors.New("invalid new answer status")
 	}
+	if err := c.checkCorrectionClaim(ctx, corrector, correctionId); err != nil {
+		return err
+	}
 	return c.questionStore.UpdateCorrectionNewStatus(ctx, correctionId, newStatus)
 }
 
-func (c *Correction) UpdateCorrectionFeedback(ctx context.Context, correctionId string, feedback string) (domain.AnswerStatus, error) {
+func (c *Correction) UpdateCorrectionFeedback(ctx context.Context, corrector domain.Corrector, correctionId string, feedback string) (domain.AnswerStatus, error) {
+	if err := c.checkCorrectionClaim(ctx, corrector, correctionId); err != nil {
+		return 0, err
+	}
 	return c.questionStore.UpdateCorrectionFeedback(ctx, correctionId, feedback)
 }
 
-func (c *Correction) FinalizeCorrection(ctx context.Context, correctionId string) error {
-	return c.questionStore.FinalizeCorrection(ctx, correctionId)
+// FinalizeCorrection finalizes the draft correction and returns the status it ends up in.
+// If the answer needs second grading, the first grade is kept blind until another corrector grades the answer.
+// Agreeing grades are applied and disagreeing ones are escalated as a dispute.
+func (c *Correction) FinalizeCorrection(ctx context.Context, corrector domain.Corrector, correctionId string) (domain.CorrectionStatus, error) {
+	correction, err := c.questionStore.GetCorrection(ctx, correctionId)
+	if err != nil {
+		return 0, err
+	}
+	if err := c.checkClaim(ctx, corrector, correction.UserId, correction.QuestionId); err != nil {
+		return 0, err
+	}
+	question, needsSecondGrading, err := c.needsSecondGrading(ctx, correction.QuestionId)
+	if err != nil {
+		return 0, err
+	}
+	if !needsSecondGrading {
+		return domain.CorrectionStatusPending, c.questionStore.FinalizeCorrection(ctx, correctionId)
+	}
+
+	blind, err := c.questionStore.GetAnswerCorrections(ctx, correction.UserId, correction.QuestionId, domain.CorrectionStatusBlind)
+	if err != nil {
+		return 0, err
+	}
+	if len(blind) == 0 {
+		blinded, err := c.questionStore.BlindCorrection(ctx, correctionId)
+		if err != nil {
+			return 0, err
+		}
+		if blinded {
+			c.releaseClaim(ctx, correction)
+			if err := c.island.ResendAnswer(ctx, correction.UserId, correction.QuestionId); err != nil {
+				slog.Error("failed to resend answer for second grading", slog.String("error", err.Error()))
+			}
+			return domain.CorrectionStatusBlind, nil
+		}
+		// another draft of the answer became its first grade meanwhile
+		blind, err = c.questionStore.GetAnswerCorrections(ctx, correction.UserId, correction.QuestionId, domain.CorrectionStatusBlind)
+		if err != nil {
+			return 0, err
+		}
+		if len(blind) == 0 {
+			return 0, domain.ErrCorrectionStatusChanged
+		}
+	}
+	first := blind[0]
+	if first.Corrector.ID == corrector.ID {
+		return 0, domain.ErrSecondGradeBySameCorrector
+	}
+	if first.NewStatus == correction.NewStatus {
+		err = c.questionStore.ChangeCorrectionStatuses(ctx, []domain.CorrectionStatusChange{
+			{ID: first.ID, From: domain.CorrectionStatusBlind, To: domain.CorrectionStatusSuperseded},
+			{ID: correctionId, From: domain.CorrectionStatusDraft, To: domain.CorrectionStatusPending},
+		})
+		if err != nil {
+			return 0, err
+		}
+		return domain.CorrectionStatusPending, nil
+	}
+	err = c.questionStore.ChangeCorrectionStatuses(ctx, []domain.CorrectionStatusChange{
+		{ID: first.ID, From: domain.CorrectionStatusBlind, To: domain.CorrectionStatusDisputed},
+		{ID: correctionId, From: domain.CorrectionStatusDraft, To: domain.CorrectionStatusDisputed},
+	})
+	if err != nil {
+		return 0, err
+	}
+	c.releaseClaim(ctx, correction)
+	if c.onDispute != nil {
+		c.onDispute(domain.CorrectionDispute{
+			UserID:      correction.UserId,
+			Question:    question,
+			Corrections: []domain.Correction{first, correction},
+		})
+	}
+	return domain.CorrectionStatusDisputed, nil
+}
+
+func (c *Correction) needsSecondGrading(ctx context.Context, questionId string) (domain.BookQuestion, bool, error) {
+	question, err := c.questionStore.GetQuestion(ctx, questionId)
+	if err != nil {
+		return question, false, err
+	}
+	if !c.cfg.SecondGrading {
+		return question, false, nil
+	}
+	pool, hasPool, err := c.islandStore.GetPoolOfBook(ctx, question.BookID)
+	if err != nil {
+		return question, false, fmt.Errorf("failed to get pool of book: %w", err)
+	}
+	return question, domain.NeedsSecondGrading(question, pool, hasPool), nil
+}
+
+// releaseClaim lets another corrector claim the answer without reposting it.
+func (c *Correction) releaseClaim(ctx context.Context, correction domain.Correction) {
+	claim, found, err := c.questionStore.GetAnswerClaim(ctx, correction.UserId, correction.QuestionId)
+	if err == nil && found {
+		_, err = c.questionStore.ReleaseAnswerClaim(ctx, claim)
+	}
+	if err != nil {
+		slog.Error("failed to release answer claim", slog.String("error", err.Error()))
+	}
+}
+
+// ResolveDispute applies the chosen correction of a disputed answer and supersedes the others.
+func (c *Correction) ResolveDispute(ctx context.Context, correctionId string) (domain.Correction, error) {
+	correction, err := c.questionStore.GetCorrection(ctx, correctionId)
+	if err != nil {
+		return correction, err
+	}
+	disputed, err := c.questionStore.GetAnswerCorrections(ctx, correction.UserId, correction.QuestionId, domain.CorrectionStatusDisputed)
+	if err != nil {
+		return correction, err
+	}
+	if !slices.ContainsFunc(disputed, func(d domain.Correction) bool { return d.ID == correctionId }) {
+		return correction, errors.New("correction is not disputed")
+	}
+	changes := []domain.CorrectionStatusChange{
+		{ID: correctionId, From: domain.CorrectionStatusDisputed, To: domain.CorrectionStatusPending},
+	}
+	for _, d := range disputed {
+		if d.ID != correctionId {
+			changes = append(changes, domain.CorrectionStatusChange{ID: d.ID, From: domain.CorrectionStatusDisputed, To: domain.CorrectionStatusSuperseded})
+		}
+	}
+	return correction, c.questionStore.ChangeCorrectionStatuses(ctx, changes)
+}
+
+// GetFeedbackTemplates returns the templates that can be used as feedback of the correction.
+func (c *Correction) GetFeedbackTemplates(ctx context.Context, correctionId string) ([]domain.FeedbackTemplate, error) {
+	correction, err := c.questionStore.GetCorrection(ctx, correctionId)
+	if err != nil {
+		return nil, err
+	}
+	territoryId, err := c.correctionTerritory(ctx, correction)
+	if err != nil {
+		return nil, err
+	}
+	return c.templateStore.GetTemplates(ctx, correction.QuestionId, territoryId)
+}
+
+// correctionTerritory returns the territory of the island of the corrected question.
+// It is empty for questions of pooled islands, like the territory the answer was sent to.
+func (c *Correction) correctionTerritory(ctx context.Context, correction domain.Correction) (string, error) {
+	question, err := c.questionStore.GetQuestion(ctx, correction.QuestionId)
+	if err != nil {
+		return "", err
+	}
+	islandHeader, err := c.islandStore.GetIslandHeaderByBookIdAndUserId(ctx, question.BookID, correction.UserId)
+	if err != nil {
+		return "", fmt.Errorf("failed to get island of question: %w", err)
+	}
+	if islandHeader.FromPool {
+		return "", nil
+	}
+	return islandHeader.TerritoryID, nil
+}
+
+// ApplyFeedbackTemplate sets the text of the template as feedback of the correction.
+func (c *Correction) ApplyFeedbackTemplate(ctx context.Context, corrector domain.Corrector, correctionId string, templateId string) (domain.AnswerStatus, error) {
+	template, err := c.templateStore.GetTemplate(ctx, templateId)
+	if err != nil {
+		return 0, err
+	}
+	correction, err := c.questionStore.GetCorrection(ctx, correctionId)
+	if err != nil {
+		return 0, err
+	}
+	territoryId, err := c.correctionTerritory(ctx, correction)
+	if err != nil {
+		return 0, err
+	}
+	if !template.AppliesTo(correction.QuestionId, territoryId) {
+		return 0, domain.ErrFeedbackTemplateNotApplicable
+	}
+	newStatus, err := c.UpdateCorrectionFeedback(ctx, corrector, correctionId, template.Text)
+	if err != nil {
+		return 0, err
+	}
+	if err := c.templateStore.IncrementUsage(ctx, templateId); err != nil {
+		slog.Error("failed to increment feedback template usage", slog.String("error", err.Error()))
+	}
+	return newStatus, nil
+}
+
+// SaveFeedbackTemplate saves the text as a template for the question of the correction,
+// or for its whole territory if forTerritory is set.
+func (c *Correction) SaveFeedbackTemplate(ctx context.Context, corrector domain.Corrector, correctionId string, text string, forTerritory bool) (domain.FeedbackTemplate, error) {
+	template := domain.FeedbackTemplate{
+		ID:        domain.NewID(domain.ResourceTypeFeedbackTemplate),
+		Text:      strings.TrimSpace(text),
+		CreatedBy: corrector,
+		CreatedAt: time.Now().UTC(),
+	}
+	if template.Text == "" {
+		return template, errors.New("empty feedback template")
+	}
+	correction, err := c.questionStore.GetCorrection(ctx, correctionId)
+	if err != nil {
+		return template, err
+	}
+	if forTerritory {
+		template.TerritoryID, err = c.correctionTerritory(ctx, correction)
+		if err != nil {
+			return template, err
+		}
+	}
+	// questions of pooled islands have no territory, so their templates are saved for the question
+	if template.TerritoryID == "" {
+		template.QuestionID = correction.QuestionId
+	}
+	if err := c.templateStore.CreateTemplate(ctx, template); err != nil {
+		return template, fmt.Errorf("failed to create feedback template: %w", err)
+	}
+	return template, nil
 }
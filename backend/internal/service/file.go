@@ -0,0 +1,147 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/Rastaiha/bermudia/internal/domain"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+type File struct {
+	fileStore     domain.FileStore
+	metadataStore domain.FileMetadataStore
+}
+
+func NewFile(fileStore domain.FileStore, metadataStore domain.FileMetadataStore) *File {
+	return &File{
+		fileStore:     fileStore,
+		metadataStore: metadataStore,
+	}
+}
+
+// Upload stores the content of the file and records its size, hash and MIME type.
+// The file is rejected before being stored if it violates the rule.
+func (f *File) Upload(ctx context.Context, ownerId int32, filename string, data io.Reader, rule domain.FileRule) (domain.StoredFile, error) {
+	file := domain.StoredFile{
+		ID:        domain.NewID(domain.ResourceTypeAnswerFile),
+		OwnerID:   ownerId,
+		Filename:  filepath.Base(filename),
+		CreatedAt: time.Now().UTC(),
+	}
+	// the content is spooled to disk because the hash and size must be known before storing it
+	tmp, err := os.CreateTemp("", "bermudia-upload-*")
+	if err != nil {
+		return file, err
+	}
+	defer func() {
+		_ = tmp.Close()
+		if err := os.Remove(tmp.Name()); err != nil {
+			slog.Error("failed to remove temp upload file", slog.String("error", err.Error()))
+		}
+	}()
+	if rule.MaxSize > 0 {
+		// read one more byte to detect files larger than the limit
+		data = io.LimitReader(data, rule.MaxSize+1)
+	}
+	hash := sha256.New()
+	file.Size, err = io.Copy(io.MultiWriter(tmp, hash), data)
+	if err != nil {
+		return file, fmt.Errorf("failed to read uploaded file: %w", err)
+	}
+	if rule.MaxSize > 0 && file.Size > rule.MaxSize {
+		return file, domain.ErrFileTooLarge(rule.MaxSize)
+	}
+	file.SHA256 = hex.EncodeToString(hash.Sum(nil))
+
+	head := make([]byte, 512)
+	n, err := tmp.ReadAt(head, 0)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return file, err
+	}
+	file.MimeType = detectMimeType(file.Filename, head[:n])
+	if err := rule.Check(file); err != nil {
+		return file, err
+	}
+
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return file, err
+	}
+	if err := f.fileStore.Put(ctx, file, tmp); err != nil {
+		return file, fmt.Errorf("failed to store file: %w", err)
+	}
+	if err := f.metadataStore.CreateFile(ctx, file); err != nil {
+		return file, fmt.Errorf("failed to save file metadata: %w", err)
+	}
+	return file, nil
+}
+
+var executableSignatures = [][]byte{
+	[]byte("MZ"),             // Windows PE
+	[]byte("\x7fELF"),        // ELF
+	{0xfe, 0xed, 0xfa, 0xce}, // Mach-O 32 bit
+	{0xfe, 0xed, 0xfa, 0xcf}, // Mach-O 64 bit
+	{0xce, 0xfa, 0xed, 0xfe}, // Mach-O 32 bit, reverse byte order
+	{0xcf, 0xfa, 0xed, 0xfe}, // Mach-O 64 bit, reverse byte order
+	[]byte("#!"),             // scripts
+}
+
+// detectMimeType sniffs the content and falls back to the extension when sniffing is inconclusive.
+// Executable signatures are only looked for in binary content and in files declared as executables,
+// as plain text may start with the same characters.
+func detectMimeType(filename string, head []byte) string {
+	ext := filepath.Ext(filename)
+	sniffed := http.DetectContentType(head)
+	if !strings.HasPrefix(sniffed, "text/") || domain.IsExecutableExtension(ext) {
+		for _, signature := range executableSignatures {
+			if bytes.HasPrefix(head, signature) {
+				return domain.MimeTypeExecutable
+			}
+		}
+	}
+	if sniffed != "application/octet-stream" {
+		return sniffed
+	}
+	if byExt := domain.MimeTypeByExtension(ext); byExt != "" {
+		return byExt
+	}
+	return sniffed
+}
+
+// Open returns the metadata and content of the file. The caller must close the content.
+func (f *File) Open(ctx context.Context, id string) (domain.StoredFile, io.ReadCloser, error) {
+	file, err := f.metadataStore.GetFile(ctx, id)
+	if err != nil {
+		return file, nil, err
+	}
+	content, err := f.fileStore.Get(ctx, id)
+	if err != nil {
+		return file, nil, err
+	}
+	return file, content, nil
+}
+
+// OpenOwned is like Open, but only lets the owner of the file open it.
+func (f *File) OpenOwned(ctx context.Context, userId int32, id string) (domain.StoredFile, io.ReadCloser, error) {
+	file, err := f.metadataStore.GetFile(ctx, id)
+	if err != nil {
+		return file, nil, err
+	}
+	if file.OwnerID != userId {
+		return file, nil, domain.ErrFileNotFound
+	}
+	content, err := f.fileStore.Get(ctx, id)
+	if err != nil {
+		return file, nil, err
+	}
+	return file, content, nil
+}
@@ -0,0 +1,39 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/Rastaiha/bermudia/internal/domain"
+)
+
+func TestDetectMimeType(t *testing.T) {
+	tests := []struct {
+		name     string
+		filename string
+		head     []byte
+		want     string
+	}{
+		{name: "windows executable", filename: "a.pdf", head: []byte("MZ\x90\x00\x03\x00"), want: domain.MimeTypeExecutable},
+		{name: "elf", filename: "a.png", head: []byte("\x7fELF\x02\x01\x01"), want: domain.MimeTypeExecutable},
+		{name: "mach-o 32 bit", filename: "a", head: []byte{0xfe, 0xed, 0xfa, 0xce, 0x00}, want: domain.MimeTypeExecutable},
+		{name: "mach-o 64 bit", filename: "a", head: []byte{0xfe, 0xed, 0xfa, 0xcf, 0x00}, want: domain.MimeTypeExecutable},
+		{name: "mach-o 32 bit reversed", filename: "a", head: []byte{0xce, 0xfa, 0xed, 0xfe, 0x00}, want: domain.MimeTypeExecutable},
+		{name: "mach-o 64 bit reversed", filename: "a", head: []byte{0xcf, 0xfa, 0xed, 0xfe, 0x00}, want: domain.MimeTypeExecutable},
+		{name: "script", filename: "a.sh", head: []byte("#!/bin/sh\nrm -rf /\n"), want: domain.MimeTypeExecutable},
+		{name: "text starting with a script signature", filename: "a.py", head: []byte("#!/usr/bin/env python3\nprint(1)\n"), want: "text/plain; charset=utf-8"},
+		{name: "text starting with an executable signature", filename: "a.txt", head: []byte("MZ is how my answer starts"), want: "text/plain; charset=utf-8"},
+		{name: "signature not at start", filename: "a.txt", head: []byte("text with MZ in it"), want: "text/plain; charset=utf-8"},
+		{name: "pdf", filename: "a.pdf", head: []byte("%PDF-1.4\n"), want: "application/pdf"},
+		{name: "png", filename: "a.png", head: []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x0dIHDR"), want: "image/png"},
+		{name: "inconclusive content uses extension", filename: "a.pdf", head: []byte{0x00, 0x01, 0x02, 0x03}, want: "application/pdf"},
+		{name: "extension in upper case", filename: "A.DOCX", head: []byte{0x00, 0x01, 0x02, 0x03}, want: "application/vnd.openxmlformats-officedocument.wordprocessingml.document"},
+		{name: "inconclusive content without extension", filename: "a", head: []byte{0x00, 0x01, 0x02, 0x03}, want: "application/octet-stream"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := detectMimeType(tt.filename, tt.head); got != tt.want {
+				t.Errorf("detectMimeType(%q) = %q, want %q", tt.filename, got, tt.want)
+			}
+		})
+	}
+}
@@ -4,16 +4,19 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"github.com/Rastaiha/bermudia/internal/config"
 	"github.com/Rastaiha/bermudia/internal/domain"
-	"github.com/go-telegram/bot"
-	"github.com/go-telegram/bot/models"
+	"github.com/go-co-op/gocron/v2"
 	"io"
 	"log/slog"
+	"sync"
 	"time"
 )
 
 type Island struct {
-	bot                 *bot.Bot
+	cfg                 config.Config
+	uow                 *UnitOfWork
+	fileService         *File
 	userStore           domain.UserStore
 	islandStore         domain.IslandStore
 	questionStore       domain.QuestionStore
@@ -23,6 +26,10 @@ type Island struct {
 	onNewAnswer         NewAnswerCallback
 	onNewPortableIsland NewPortableIslandCallback
 	onHelpRequest       HelpRequestCallback
+	onPendingBacklog    PendingBacklogCallback
+	escalationLock      sync.Mutex
+	lastEscalation      time.Time
+	cron                gocron.Scheduler
 }
 
 type NewAnswerCallback func(username string, territory string, question domain.BookQuestion, answer domain.Answer)
@@ -31,9 +38,14 @@ type NewPortableIslandCallback func(userId int32)
 
 type HelpRequestCallback func(territory string, user *domain.User, question domain.BookQuestion) error
 
-func NewIsland(bot *bot.Bot, userStore domain.UserStore, islandStore domain.IslandStore, questionStore domain.QuestionStore, playerStore domain.PlayerStore, treasureStore domain.TreasureStore, gameStateStore domain.GameStateStore) *Island {
+// PendingBacklogCallback receives the number of pending answers per territory.
+type PendingBacklogCallback func(backlog map[string]int)
+
+func NewIsland(cfg config.Config, uow *UnitOfWork, fileService *File, userStore domain.UserStore, islandStore domain.IslandStore, questionStore domain.QuestionStore, playerStore domain.PlayerStore, treasureStore domain.TreasureStore, gameStateStore domain.GameStateStore) *Island {
 	return &Island{
-		bot:            bot,
+		cfg:            cfg,
+		uow:            uow,
+		fileService:    fileService,
 		userStore:      userStore,
 		islandStore:    islandStore,
 		questionStore:  questionStore,
@@ -44,106 +56,202 @@ func NewIsland(bot *bot.Bot, userStore domain.UserStore, islandStore domain.Isla
 }
 
 func (i *Island) Start() {
-	_ = func(now time.Time) {
-		ctx, cancel := context.WithTimeout(context.Background(), time.Second*60)
-		defer cancel()
+	var err error
+	i.cron, err = gocron.NewScheduler(gocron.WithLimitConcurrentJobs(1, gocron.LimitModeReschedule))
+	if err != nil {
+		panic(err)
+	}
+	_, err = i.cron.NewJob(gocron.DurationJob(i.cfg.ReminderJobInterval), gocron.NewTask(i.remindPendingAnswers))
+	if err != nil {
+		panic(err)
+	}
+	i.cron.Start()
+}
 
-		if paused, err := i.gameStateStore.GetIsPaused(ctx); err != nil || paused {
-			return
+func (i *Island) Stop() {
+	if err := i.cron.Shutdown(); err != nil {
+		slog.Error("failed to stop cron", slog.String("error", err.Error()))
+	}
+}
+
+func (i *Island) remindPendingAnswers(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, time.Second*60)
+	defer cancel()
+
+	if paused, err := i.gameStateStore.GetIsPaused(ctx); err != nil || paused {
+		return
+	}
+
+	now := time.Now().UTC()
+	threshold := now.Add(-i.cfg.ReminderThreshold)
+	answers, err := i.questionStore.GetAnswersToRemind(ctx, threshold, threshold)
+	if err != nil {
+		slog.Error("failed to get answers to remind", slog.String("error", err.Error()))
+		return
+	}
+
+	for _, a := range answers {
+		if err := i.resendAnswer(ctx, a); err != nil {
+			slog.Error("failed to resend pending answer", slog.String("error", err.Error()))
+			continue
+		}
+		if err := i.questionStore.MarkAnswerReminded(ctx, a.UserID, a.QuestionID, now); err != nil {
+			slog.Error("failed to mark answer as reminded", slog.String("error", err.Error()))
 		}
+	}
+	if len(answers) > 0 {
+		slog.Info("reminded pending answers", slog.Int("count", len(answers)))
+	}
 
-		answers, err := i.questionStore.GetPendingAnswers(ctx, now.UTC().Add(-20*time.Minute))
-		if err != nil {
-			slog.Error("failed to get pending answers", slog.String("error", err.Error()))
+	i.checkPendingBacklog(ctx, now)
+}
+
+func (i *Island) checkPendingBacklog(ctx context.Context, now time.Time) {
+	i.escalationLock.Lock()
+	defer i.escalationLock.Unlock()
+	if i.onPendingBacklog == nil || now.Sub(i.lastEscalation) < i.cfg.EscalationInterval {
+		return
+	}
+	backlog, err := i.GetPendingBacklog(ctx)
+	if err != nil {
+		slog.Error("failed to get pending backlog", slog.String("error", err.Error()))
+		return
+	}
+	for _, count := range backlog {
+		if count > i.cfg.PendingBacklogLimit {
+			i.lastEscalation = now
+			i.onPendingBacklog(backlog)
 			return
 		}
+	}
+}
 
-		for _, a := range answers {
-			user, err := i.userStore.Get(ctx, a.UserID)
-			if err != nil {
-				continue
-			}
-			question, err := i.questionStore.GetQuestion(ctx, a.QuestionID)
-			if err != nil {
-				continue
-			}
-			territory := ""
-			if islandHeader, err := i.islandStore.GetIslandHeaderByBookIdAndUserId(ctx, question.BookID, user.ID); err == nil {
-				if !islandHeader.FromPool {
-					territory = islandHeader.TerritoryID
-				}
-			}
-			i.onNewAnswer(user.Username, territory, question, a)
+// GetPendingBacklog returns the number of pending answers per territory.
+func (i *Island) GetPendingBacklog(ctx context.Context) (map[string]int, error) {
+	backlog, err := i.questionStore.GetPendingBacklog(ctx, time.Now().UTC())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pending backlog: %w", err)
+	}
+	return backlog, nil
+}
+
+// ResendAnswer re-posts a pending answer to the correctors through the NewAnswerCallback.
+func (i *Island) ResendAnswer(ctx context.Context, userId int32, questionId string) error {
+	answer, err := i.questionStore.GetAnswer(ctx, userId, questionId)
+	if err != nil {
+		return err
+	}
+	if answer.Status != domain.AnswerStatusPending {
+		return domain.ErrAnswerNotPending
+	}
+	return i.resendAnswer(ctx, answer)
+}
+
+func (i *Island) resendAnswer(ctx context.Context, a domain.Answer) error {
+	user, err := i.userStore.Get(ctx, a.UserID)
+	if err != nil {
+		return err
+	}
+	question, err := i.questionStore.GetQuestion(ctx, a.QuestionID)
+	if err != nil {
+		return err
+	}
+	i.onNewAnswer(user.Username, i.answerTerritory(ctx, user.ID, question), question, a)
+	return nil
+}
+
+// answerTerritory returns the territory whose correctors should correct the answer.
+// It is empty for questions of pooled islands.
+func (i *Island) answerTerritory(ctx context.Context, userId int32, question domain.BookQuestion) string {
+	if islandHeader, err := i.islandStore.GetIslandHeaderByBookIdAndUserId(ctx, question.BookID, userId); err == nil {
+		if !islandHeader.FromPool {
+			return islandHeader.TerritoryID
 		}
 	}
-	//go func() {
-	//	resend(time.Now())
-	//	for now := range time.Tick(20 * time.Minute) {
-	//		resend(now)
-	//	}
-	//}()
+	return ""
 }
 
 func (i *Island) GetIsland(ctx context.Context, userId int32, islandId string) (*domain.IslandContent, error) {
-	player, err := i.playerStore.Get(ctx, userId)
+	var content *domain.IslandContent
+	var madePortable bool
+	err := i.uow.Do(ctx, func(s domain.GameStores) (err error) {
+		content, madePortable, err = i.readIsland(ctx, s, userId, islandId)
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
-	isPortable, err := i.islandStore.IsIslandPortable(ctx, userId, islandId)
+	if madePortable {
+		i.onNewPortableIsland(userId)
+	}
+	return content, nil
+}
+
+// readIsland returns the content of the island for the user, creating the books, answers and treasures
+// of the user that it has for the first time. madePortable is set if the island is made portable for the user.
+func (i *Island) readIsland(ctx context.Context, s domain.GameStores, userId int32, islandId string) (content *domain.IslandContent, madePortable bool, err error) {
+	player, err := s.Player.Get(ctx, userId)
 	if err != nil {
-		return nil, err
+		return nil, false, err
+	}
+	isPortable, err := s.Island.IsIslandPortable(ctx, userId, islandId)
+	if err != nil {
+		return nil, false, err
 	}
 	if err := domain.CheckPlayerAccessToIslandContent(player, islandId, isPortable); err != nil {
-		return nil, err
+		return nil, false, err
 	}
 
-	islandHeader, err := i.islandStore.GetIslandHeader(ctx, islandId)
+	islandHeader, err := s.Island.GetIslandHeader(ctx, islandId)
 	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
 
 	if domain.ShouldBeMadePortableOnAccess(islandHeader) {
-		added, err := i.islandStore.AddPortableIsland(ctx, userId, islandId)
+		added, err := s.Island.AddPortableIsland(ctx, userId, islandId)
 		if err != nil {
-			return nil, err
-		}
-		if added {
-			i.onNewPortableIsland(userId)
+			return nil, false, err
 		}
+		madePortable = added
 	}
 
-	bookId, err := i.islandStore.GetBookOfIsland(ctx, islandId, userId)
+	bookId, err := s.Island.GetBookOfIsland(ctx, islandId, userId)
 	if errors.Is(err, domain.ErrNoBookAssignedFromPool) {
-		bookId, err = i.islandStore.AssignBookToIslandFromPool(ctx, islandHeader.TerritoryID, islandId, userId)
+		bookId, err = s.Island.AssignBookToIslandFromPool(ctx, islandHeader.TerritoryID, islandId, userId)
 	}
 	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
-	book, err := i.islandStore.GetBook(ctx, bookId)
+	book, err := s.Island.GetBook(ctx, bookId)
 	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
 
-	content := &domain.IslandContent{}
+	content = &domain.IslandContent{}
 	for _, c := range book.Components {
 		if c.IFrame != nil {
 			content.Components = append(content.Components, domain.IslandComponent{IFrame: c.IFrame})
 			continue
 		}
 		if c.Question != nil {
-			question, err := i.questionStore.GetQuestion(ctx, c.Question.ID)
+			question, err := s.Question.GetQuestion(ctx, c.Question.ID)
 			if err != nil {
-				return nil, err
+				return nil, false, err
 			}
-			answer, err := i.questionStore.GetOrCreateAnswer(ctx, userId, c.Question.ID)
+			answer, err := s.Question.GetOrCreateAnswer(ctx, userId, c.Question.ID)
 			if err != nil {
-				return nil, err
+				return nil, false, err
+			}
+			var maxSize int64
+			if c.Question.InputType == "file" {
+				maxSize = i.fileRule(question).MaxSize
 			}
 			content.Components = append(content.Components, domain.IslandComponent{
 				Input: &domain.IslandInput{
 					ID:              c.Question.ID,
 					Type:            c.Question.InputType,
 					Accept:          c.Question.InputAccept,
+					MaxSize:         maxSize,
 					Description:     c.Question.Text,
 					SubmissionState: domain.GetSubmissionState(question, answer),
 				},
@@ -152,14 +260,14 @@ func (i *Island) GetIsland(ctx context.Context, userId int32, islandId string) (
 		}
 	}
 	for _, t := range book.Treasures {
-		userTreasure, err := i.treasureStore.GetOrCreateUserTreasure(ctx, userId, t.ID)
+		userTreasure, err := s.Treasure.GetOrCreateUserTreasure(ctx, userId, t.ID)
 		if err != nil {
-			return nil, err
+			return nil, false, err
 		}
 		content.Treasures = append(content.Treasures, domain.GetIslandTreasureOfUserTreasure(userTreasure, player.AtIsland == islandId))
 	}
 
-	return content, nil
+	return content, madePortable, nil
 }
 
 func (i *Island) SubmitAnswer(ctx context.Context, user *domain.User, questionId string, file io.ReadCloser, filename string, textContent string) (*domain.SubmissionState, error) {
@@ -200,20 +308,15 @@ func (i *Island) SubmitAnswer(ctx context.Context, user *domain.User, questionId
 
 	fileId := ""
 	if file != nil {
-		msg, err := i.bot.SendDocument(ctx, &bot.SendDocumentParams{
-			ChatID: i.bot.ID(),
-			Document: &models.InputFileUpload{
-				Data:     file,
-				Filename: filename,
-			},
-		})
-		if err != nil {
-			return nil, fmt.Errorf("failed to upload file by bot sendDocument: %w", err)
+		// questions bound before input types were stored have an empty input type
+		if question.InputType != "" && question.InputType != "file" {
+			return nil, domain.ErrFileNotAccepted
 		}
-		if msg == nil || msg.Document == nil || msg.Document.FileID == "" {
-			return nil, fmt.Errorf("failed to upload file by bot sendDocument: document is empty")
+		storedFile, err := i.fileService.Upload(ctx, user.ID, filename, file, i.fileRule(question))
+		if err != nil {
+			return nil, fmt.Errorf("failed to upload answer file: %w", err)
 		}
-		fileId = msg.Document.FileID
+		fileId = storedFile.ID
 	}
 
 	answer, err = i.questionStore.SubmitAnswer(ctx, user.ID, questionId, fileId, filename, textContent, answer.UpdatedAt)
@@ -227,6 +330,16 @@ func (i *Island) SubmitAnswer(ctx context.Context, user *domain.User, questionId
 	return &r, nil
 }
 
+// fileRule returns the rule for answer files of the question.
+// The size limit of the question can only tighten the global limit.
+func (i *Island) fileRule(question domain.BookQuestion) domain.FileRule {
+	maxSize := i.cfg.MaxAnswerFileSize
+	if question.MaxFileSize > 0 && (maxSize <= 0 || question.MaxFileSize < maxSize) {
+		maxSize = question.MaxFileSize
+	}
+	return domain.FileRule{Accept: question.InputAccept, MaxSize: maxSize}
+}
+
 func (i *Island) OnNewAnswer(f NewAnswerCallback) {
 	i.onNewAnswer = f
 }
@@ -239,6 +352,10 @@ func (i *Island) OnHelpRequest(f HelpRequestCallback) {
 	i.onHelpRequest = f
 }
 
+func (i *Island) OnPendingBacklog(f PendingBacklogCallback) {
+	i.onPendingBacklog = f
+}
+
 func (i *Island) RequestHelpToAnswer(ctx context.Context, user *domain.User, questionId string) (string, error) {
 	if user.MeetLink == "" {
 		return "", domain.ErrMeetUnavailable
@@ -0,0 +1,180 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/Rastaiha/bermudia/internal/domain"
+	"log/slog"
+	"time"
+)
+
+const (
+	outboxPollInterval = 2 * time.Second
+	outboxBatchSize    = 100
+	// outboxClaimTimeout is how long a dispatcher owns a message it claimed. If it crashes meanwhile,
+	// the message is dispatched again afterward.
+	outboxClaimTimeout = 30 * time.Second
+	outboxMaxAttempts  = 10
+	outboxMaxBackoff   = time.Minute
+	outboxRetention    = time.Hour
+)
+
+// Outbox dispatches events that are stored in the transactions of the changes they tell about,
+// so an event is sent only once its changes are committed, and is retried until it is sent.
+// Every replica may run a dispatcher; a message is claimed before it is dispatched.
+type Outbox struct {
+	store       domain.OutboxStore
+	handlers    map[string]func(payload []byte) error
+	notify      chan struct{}
+	cancel      context.CancelFunc
+	done        chan struct{}
+	lastCleanup time.Time
+}
+
+func NewOutbox(store domain.OutboxStore) *Outbox {
+	return &Outbox{
+		store:    store,
+		handlers: make(map[string]func(payload []byte) error),
+		notify:   make(chan struct{}, 1),
+	}
+}
+
+// Handle sets the handler of the messages of a kind. It must be called before Start.
+func (o *Outbox) Handle(kind string, handler func(payload []byte) error) {
+	o.handlers[kind] = handler
+}
+
+// Add stores a message of the kind in tx, or on its own if tx is nil.
+// Call Notify after tx is committed to dispatch it without waiting for the next poll.
+func (o *Outbox) Add(ctx context.Context, tx domain.Tx, kind string, payload any) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("marshal outbox message of kind %q: %w", kind, err)
+	}
+	return o.store.Add(ctx, tx, domain.OutboxMessage{
+		ID:        domain.NewID(domain.ResourceTypeOutboxMessage),
+		Kind:      kind,
+		Payload:   data,
+		CreatedAt: time.Now().UTC(),
+	})
+}
+
+// Notify wakes the dispatcher up.
+func (o *Outbox) Notify() {
+	select {
+	case o.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (o *Outbox) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	o.cancel = cancel
+	o.done = make(chan struct{})
+	go o.run(ctx)
+}
+
+func (o *Outbox) Stop() {
+	if o.cancel == nil {
+		return
+	}
+	o.cancel()
+	<-o.done
+}
+
+func (o *Outbox) run(ctx context.Context) {
+	defer close(o.done)
+	ticker := time.NewTicker(outboxPollInterval)
+	defer ticker.Stop()
+	for {
+		o.dispatch(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-o.notify:
+		}
+	}
+}
+
+func (o *Outbox) dispatch(ctx context.Context) {
+	now := time.Now().UTC()
+	messages, err := o.store.GetDue(ctx, now, outboxBatchSize)
+	if err != nil {
+		slog.Error("failed to get outbox messages", slog.String("error", err.Error()))
+		return
+	}
+	for _, msg := range messages {
+		o.dispatchMessage(ctx, msg)
+	}
+	if len(messages) == outboxBatchSize {
+		o.Notify()
+	}
+
+	if now.Sub(o.lastCleanup) > outboxRetention/4 {
+		o.lastCleanup = now
+		if err := o.store.DeleteDispatchedBefore(ctx, now.Add(-outboxRetention)); err != nil {
+			slog.Error("failed to delete dispatched outbox messages", slog.String("error", err.Error()))
+		}
+	}
+}
+
+func (o *Outbox) dispatchMessage(ctx context.Context, msg domain.OutboxMessage) {
+	now := time.Now().UTC()
+	attempts, ok, err := o.store.Claim(ctx, msg.ID, now, now.Add(outboxClaimTimeout))
+	if err != nil {
+		slog.Error("failed to claim outbox message",
+			slog.String("id", msg.ID),
+			slog.String("error", err.Error()),
+		)
+		return
+	}
+	if !ok {
+		return
+	}
+
+	err = o.handle(msg)
+	if err == nil {
+		err = o.store.MarkDispatched(ctx, msg.ID, time.Now().UTC())
+		if err != nil {
+			slog.Error("failed to mark outbox message dispatched",
+				slog.String("id", msg.ID),
+				slog.String("error", err.Error()),
+			)
+		}
+		return
+	}
+
+	var nextAttemptAt *time.Time
+	if attempts < outboxMaxAttempts {
+		next := time.Now().UTC().Add(min(time.Second<<(attempts-1), outboxMaxBackoff))
+		nextAttemptAt = &next
+	}
+	slog.Error("failed to dispatch outbox message",
+		slog.String("id", msg.ID),
+		slog.String("kind", msg.Kind),
+		slog.Int("attempts", attempts),
+		slog.Bool("abandoned", nextAttemptAt == nil),
+		slog.String("error", err.Error()),
+	)
+	if err := o.store.MarkFailed(ctx, msg.ID, err.Error(), nextAttemptAt); err != nil {
+		slog.Error("failed to mark outbox message failed",
+			slog.String("id", msg.ID),
+			slog.String("error", err.Error()),
+		)
+	}
+}
+
+func (o *Outbox) handle(msg domain.OutboxMessage) (err error) {
+	handler, ok := o.handlers[msg.Kind]
+	if !ok {
+		return fmt.Errorf("no handler for outbox messages of kind %q", msg.Kind)
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("outbox handler panicked: %v", r)
+		}
+	}()
+	return handler(msg.Payload)
+}
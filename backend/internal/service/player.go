@@ -2,7 +2,7 @@ package service
 
 import (
 	"context"
-	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/Rastaiha/bermudia/internal/config"
@@ -10,6 +10,7 @@ import (
 	"github.com/go-co-op/gocron/v2"
 	"github.com/patrickmn/go-cache"
 	"log/slog"
+	"slices"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -17,7 +18,9 @@ import (
 
 type Player struct {
 	cfg                        config.Config
-	db                         *sql.DB
+	uow                        *UnitOfWork
+	bus                        domain.EventBus
+	outbox                     *Outbox
 	userStore                  domain.UserStore
 	playerStore                domain.PlayerStore
 	territoryStore             domain.TerritoryStore
@@ -27,22 +30,24 @@ type Player struct {
 	marketStore                domain.MarketStore
 	inboxStore                 domain.InboxStore
 	investStore                domain.InvestStore
-	playerUpdateEventHandler   func(event *domain.FullPlayerUpdateEvent)
+	playerUpdateEventHandler   func(event *domain.FullPlayerUpdateEvent) error
 	tradeEventBroadcastHandler TradeEventBroadcastHandler
-	inboxEventHandler          func(e *domain.InboxEvent)
 	broadcastMessageHandler    MessageBroadcastHandler
+	presenceEventHandler       PresenceEventHandler
 	playerLocationsCache       *cache.Cache
 	cron                       gocron.Scheduler
 }
 
-type TradeEventBroadcastHandler func(func(userId int32) *domain.TradeEvent)
+type TradeEventBroadcastHandler func(event domain.TradeEventBroadcast) error
 
-type MessageBroadcastHandler func(func(userId int32) *domain.InboxMessageView)
+type MessageBroadcastHandler func(events []*domain.InboxEvent) error
 
-func NewPlayer(cfg config.Config, db *sql.DB, userStore domain.UserStore, playerStore domain.PlayerStore, territoryStore domain.TerritoryStore, questionStore domain.QuestionStore, islandStore domain.IslandStore, treasureStore domain.TreasureStore, marketStore domain.MarketStore, inboxStore domain.InboxStore, investStore domain.InvestStore) *Player {
-	return &Player{
+func NewPlayer(cfg config.Config, uow *UnitOfWork, bus domain.EventBus, outbox *Outbox, userStore domain.UserStore, playerStore domain.PlayerStore, territoryStore domain.TerritoryStore, questionStore domain.QuestionStore, islandStore domain.IslandStore, treasureStore domain.TreasureStore, marketStore domain.MarketStore, inboxStore domain.InboxStore, investStore domain.InvestStore) *Player {
+	p := &Player{
 		cfg:                  cfg,
-		db:                   db,
+		uow:                  uow,
+		bus:                  bus,
+		outbox:               outbox,
 		userStore:            userStore,
 		playerStore:          playerStore,
 		territoryStore:       territoryStore,
@@ -54,6 +59,47 @@ func NewPlayer(cfg config.Config, db *sql.DB, userStore domain.UserStore, player
 		investStore:          investStore,
 		playerLocationsCache: cache.New(20*time.Second, time.Minute),
 	}
+	bus.Subscribe(topicCacheInvalidation, p.handleCacheInvalidation)
+	outbox.Handle(outboxPlayerUpdate, p.dispatchPlayerUpdate)
+	outbox.Handle(outboxTradeBroadcast, p.dispatchTradeBroadcast)
+	outbox.Handle(outboxInboxEvents, p.dispatchInboxEvents)
+	return p
+}
+
+const (
+	topicCacheInvalidation = "cache_invalidation"
+	cachePlayerLocations   = "player_locations"
+)
+
+// cacheInvalidation removes keys of a local cache in every replica.
+type cacheInvalidation struct {
+	Cache string   `json:"cache"`
+	Keys  []string `json:"keys"`
+}
+
+func (p *Player) handleCacheInvalidation(payload []byte) {
+	var invalidation cacheInvalidation
+	if err := json.Unmarshal(payload, &invalidation); err != nil {
+		slog.Error("invalid cache invalidation event", slog.String("error", err.Error()))
+		return
+	}
+	if invalidation.Cache == cachePlayerLocations {
+		for _, key := range invalidation.Keys {
+			p.playerLocationsCache.Delete(key)
+		}
+	}
+}
+
+func (p *Player) invalidatePlayerLocations(ctx context.Context, territoryIDs ...string) {
+	err := p.bus.Publish(ctx, topicCacheInvalidation, cacheInvalidation{
+		Cache: cachePlayerLocations,
+		Keys:  slices.Compact(territoryIDs),
+	})
+	if err != nil {
+		slog.Error("failed to invalidate player locations",
+			slog.String("error", err.Error()),
+		)
+	}
 }
 
 func (p *Player) Start() {
@@ -85,7 +131,7 @@ func (p *Player) Start() {
 
 func (p *Player) Stop() {
 	if err := p.cron.Shutdown(); err != nil {
-		slog.Error("failed to stop cron", err)
+		slog.Error("failed to stop cron", slog.String("error", err.Error()))
 	}
 }
 
@@ -94,7 +140,22 @@ func (p *Player) GetPlayer(ctx context.Context, user *domain.User) (domain.FullP
 	if err != nil {
 		return domain.FullPlayer{}, err
 	}
-	return p.getFullPlayer(ctx, player)
+	return p.getFullPlayer(ctx, p.stores(), player)
+}
+
+// stores returns the stores of the service, which are not bound to a transaction.
+func (p *Player) stores() domain.GameStores {
+	return domain.GameStores{
+		User:      p.userStore,
+		Player:    p.playerStore,
+		Territory: p.territoryStore,
+		Question:  p.questionStore,
+		Island:    p.islandStore,
+		Treasure:  p.treasureStore,
+		Market:    p.marketStore,
+		Inbox:     p.inboxStore,
+		Invest:    p.investStore,
+	}
 }
 
 func (p *Player) TravelCheck(ctx context.Context, user *domain.User, fromIsland, toIsland string) (*domain.TravelCheckResult, error) {
@@ -106,7 +167,7 @@ func (p *Player) TravelCheck(ctx context.Context, user *domain.User, fromIsland,
 	if err != nil {
 		return nil, err
 	}
-	isDestinationIslandUnlocked, err := p.isIslandUnlocked(ctx, user.ID, *territory, toIsland)
+	isDestinationIslandUnlocked, err := p.isIslandUnlocked(ctx, p.stores(), user.ID, *territory, toIsland)
 	if err != nil {
 		return nil, err
 	}
@@ -115,10 +176,10 @@ func (p *Player) TravelCheck(ctx context.Context, user *domain.User, fromIsland,
 	return &checkResult, nil
 }
 
-func (p *Player) isIslandUnlocked(ctx context.Context, userId int32, territory domain.Territory, islandId string) (bool, error) {
+func (p *Player) isIslandUnlocked(ctx context.Context, s domain.GameStores, userId int32, territory domain.Territory, islandId string) (bool, error) {
 	prerequisites := territory.IslandPrerequisites[islandId]
 	for _, pre := range prerequisites {
-		hasAnsweredIsland, err := p.questionStore.HasAnsweredIsland(ctx, userId, pre)
+		hasAnsweredIsland, err := s.Question.HasAnsweredIsland(ctx, userId, pre)
 		if err != nil {
 			return false, fmt.Errorf("failed to check if user answered all island: %w", err)
 		}
@@ -130,24 +191,17 @@ func (p *Player) isIslandUnlocked(ctx context.Context, userId int32, territory d
 }
 
 func (p *Player) Travel(ctx context.Context, user *domain.User, fromIsland string, toIsland string) error {
-	player, err := p.playerStore.Get(ctx, user.ID)
-	if err != nil {
-		return err
-	}
-	territory, err := p.territoryStore.GetTerritoryByID(ctx, player.AtTerritory)
-	if err != nil {
-		return err
-	}
-	isDestinationIslandUnlocked, err := p.isIslandUnlocked(ctx, user.ID, *territory, toIsland)
-	if err != nil {
-		return err
-	}
-
-	event, err := domain.Travel(player, fromIsland, toIsland, territory, isDestinationIslandUnlocked)
-	if err != nil {
-		return err
-	}
-	return p.applyAndSendPlayerUpdateEvent(ctx, player, event)
+	return p.updatePlayer(ctx, user.ID, func(s domain.GameStores, player domain.Player) (*domain.PlayerUpdateEvent, error) {
+		territory, err := s.Territory.GetTerritoryByID(ctx, player.AtTerritory)
+		if err != nil {
+			return nil, err
+		}
+		isDestinationIslandUnlocked, err := p.isIslandUnlocked(ctx, s, user.ID, *territory, toIsland)
+		if err != nil {
+			return nil, err
+		}
+		return domain.Travel(player, fromIsland, toIsland, territory, isDestinationIslandUnlocked)
+	})
 }
 
 func (p *Player) RefuelCheck(ctx context.Context, userId int32) (*domain.RefuelCheckResult, error) {
@@ -165,20 +219,13 @@ func (p *Player) RefuelCheck(ctx context.Context, userId int32) (*domain.RefuelC
 }
 
 func (p *Player) Refuel(ctx context.Context, userId int32, amount int32) error {
-	player, err := p.playerStore.Get(ctx, userId)
-	if err != nil {
-		return err
-	}
-	territory, err := p.territoryStore.GetTerritoryByID(ctx, player.AtTerritory)
-	if err != nil {
-		return err
-	}
-
-	event, err := domain.Refuel(player, territory, amount)
-	if err != nil {
-		return err
-	}
-	return p.applyAndSendPlayerUpdateEvent(ctx, player, event)
+	return p.updatePlayer(ctx, userId, func(s domain.GameStores, player domain.Player) (*domain.PlayerUpdateEvent, error) {
+		territory, err := s.Territory.GetTerritoryByID(ctx, player.AtTerritory)
+		if err != nil {
+			return nil, err
+		}
+		return domain.Refuel(player, territory, amount)
+	})
 }
 
 func (p *Player) AnchorCheck(ctx context.Context, userId int32, islandID string) (*domain.AnchorCheckResult, error) {
@@ -191,33 +238,138 @@ func (p *Player) AnchorCheck(ctx context.Context, userId int32, islandID string)
 }
 
 func (p *Player) Anchor(ctx context.Context, userId int32, islandID string) error {
-	player, err := p.playerStore.Get(ctx, userId)
-	if err != nil {
+	return p.updatePlayer(ctx, userId, func(_ domain.GameStores, player domain.Player) (*domain.PlayerUpdateEvent, error) {
+		return domain.Anchor(player, islandID)
+	})
+}
+
+func (p *Player) SetMapVisibility(ctx context.Context, userId int32, hidden bool) error {
+	return p.updatePlayer(ctx, userId, func(_ domain.GameStores, player domain.Player) (*domain.PlayerUpdateEvent, error) {
+		if player.HiddenOnMap == hidden {
+			return nil, nil
+		}
+		return domain.SetMapVisibility(player, hidden), nil
+	})
+}
+
+// GrantResources gives the items of grant to the player and returns the updated player.
+func (p *Player) GrantResources(ctx context.Context, userId int32, grant domain.Cost) (domain.Player, error) {
+	var updated domain.Player
+	err := p.updatePlayer(ctx, userId, func(_ domain.GameStores, player domain.Player) (*domain.PlayerUpdateEvent, error) {
+		event, err := domain.GrantResources(player, grant)
+		if err != nil {
+			return nil, err
+		}
+		updated = *event.Player
+		return event, nil
+	})
+	return updated, err
+}
+
+func (p *Player) OnPlayerUpdate(eventHandler func(event *domain.FullPlayerUpdateEvent) error) {
+	p.playerUpdateEventHandler = eventHandler
+}
+
+// updatePlayer applies the event that decide makes for the current state of the player in a unit of work.
+// Nothing is changed if the event is nil.
+func (p *Player) updatePlayer(ctx context.Context, userId int32, decide func(s domain.GameStores, player domain.Player) (*domain.PlayerUpdateEvent, error)) error {
+	var oldPlayer domain.Player
+	var event *domain.PlayerUpdateEvent
+	err := p.uow.Do(ctx, func(s domain.GameStores) (err error) {
+		oldPlayer, err = s.Player.Get(ctx, userId)
+		if err != nil {
+			return err
+		}
+		event, err = decide(s, oldPlayer)
+		if err != nil || event == nil {
+			return err
+		}
+		return p.applyPlayerUpdateEvent(ctx, s, oldPlayer, event)
+	})
+	if err != nil || event == nil {
 		return err
 	}
-	event, err := domain.Anchor(player, islandID)
-	if err != nil {
+	if oldPlayer.AtTerritory != event.Player.AtTerritory || oldPlayer.AtIsland != event.Player.AtIsland || oldPlayer.HiddenOnMap != event.Player.HiddenOnMap {
+		// after the commit, for the new location to be read
+		p.invalidatePlayerLocations(ctx, oldPlayer.AtTerritory, event.Player.AtTerritory)
+		p.sendPresenceEvent(ctx, oldPlayer, *event.Player)
+	}
+	return nil
+}
+
+// applyPlayerUpdateEvent updates the player and queues the event in the transaction of s.
+func (p *Player) applyPlayerUpdateEvent(ctx context.Context, s domain.GameStores, oldPlayer domain.Player, event *domain.PlayerUpdateEvent) error {
+	if err := s.Player.Update(ctx, s.Tx, oldPlayer, *event.Player); err != nil {
 		return err
 	}
-	return p.applyAndSendPlayerUpdateEvent(ctx, player, event)
+	return p.queuePlayerUpdateEvent(ctx, s, event)
 }
 
-func (p *Player) OnPlayerUpdate(eventHandler func(event *domain.FullPlayerUpdateEvent)) {
-	p.playerUpdateEventHandler = eventHandler
+// Kinds of the outbox messages of the player service.
+const (
+	outboxPlayerUpdate   = "player_update"
+	outboxTradeBroadcast = "trade_broadcast"
+	outboxInboxEvents    = "inbox_events"
+)
+
+// playerUpdateMessage is a FullPlayerUpdateEvent in the outbox, with the fields it leaves out of JSON.
+type playerUpdateMessage struct {
+	UserId int32                         `json:"userId"`
+	Seq    int64                         `json:"seq"`
+	Event  *domain.FullPlayerUpdateEvent `json:"event"`
+}
+
+// inboxEventMessage is an InboxEvent in the outbox, with the fields it leaves out of JSON.
+type inboxEventMessage struct {
+	UserId int32              `json:"userId"`
+	Seq    int64              `json:"seq"`
+	Event  *domain.InboxEvent `json:"event"`
 }
 
-func (p *Player) applyAndSendPlayerUpdateEvent(ctx context.Context, oldPlayer domain.Player, event *domain.PlayerUpdateEvent) error {
-	if err := p.playerStore.Update(ctx, nil, oldPlayer, *event.Player); err != nil {
+func (p *Player) dispatchPlayerUpdate(payload []byte) error {
+	var msg playerUpdateMessage
+	if err := json.Unmarshal(payload, &msg); err != nil {
 		return err
 	}
-	if err := p.sendPlayerUpdateEventErr(ctx, event); err != nil {
+	msg.Event.Seq = msg.Seq
+	msg.Event.Player.UserId = msg.UserId
+	return p.playerUpdateEventHandler(msg.Event)
+}
+
+func (p *Player) dispatchTradeBroadcast(payload []byte) error {
+	var event domain.TradeEventBroadcast
+	if err := json.Unmarshal(payload, &event); err != nil {
 		return err
 	}
-	return nil
+	return p.tradeEventBroadcastHandler(event)
+}
+
+func (p *Player) dispatchInboxEvents(payload []byte) error {
+	var messages []inboxEventMessage
+	if err := json.Unmarshal(payload, &messages); err != nil {
+		return err
+	}
+	events := make([]*domain.InboxEvent, 0, len(messages))
+	for _, msg := range messages {
+		msg.Event.UserId = msg.UserId
+		msg.Event.Seq = msg.Seq
+		events = append(events, msg.Event)
+	}
+	return p.broadcastMessageHandler(events)
 }
 
-func (p *Player) sendPlayerUpdateEventErr(ctx context.Context, event *domain.PlayerUpdateEvent) error {
-	fullPlayer, err := p.getFullPlayer(ctx, *event.Player)
+func (p *Player) queueInboxEvents(ctx context.Context, tx domain.Tx, events ...*domain.InboxEvent) error {
+	messages := make([]inboxEventMessage, 0, len(events))
+	for _, e := range events {
+		messages = append(messages, inboxEventMessage{UserId: e.UserId, Seq: e.Seq, Event: e})
+	}
+	return p.outbox.Add(ctx, tx, outboxInboxEvents, messages)
+}
+
+// queuePlayerUpdateEvent stores the event of the player in the transaction of s and queues it in the outbox,
+// to be sent once the transaction is committed.
+func (p *Player) queuePlayerUpdateEvent(ctx context.Context, s domain.GameStores, event *domain.PlayerUpdateEvent) error {
+	fullPlayer, err := p.getFullPlayer(ctx, s, *event.Player)
 	if err != nil {
 		slog.Error("failed to send player update event",
 			slog.String("error", err.Error()),
@@ -226,41 +378,55 @@ func (p *Player) sendPlayerUpdateEventErr(ctx context.Context, event *domain.Pla
 		return fmt.Errorf("failed to send player update event: %w", err)
 	}
 
-	if event.Reason != domain.PlayerUpdateEventInitial {
-		err = p.playerStore.CreatePlayerEvent(ctx, event.Player.UserId, time.Now().UTC(), event.Reason, fullPlayer)
-		if err != nil {
-			slog.Error("failed to create player event",
-				slog.String("error", err.Error()),
-				slog.Int("userId", int(event.Player.UserId)),
-			)
-			return fmt.Errorf("failed to create player event: %w", err)
-		}
+	seq, err := s.Player.CreatePlayerEvent(ctx, s.Tx, event.Player.UserId, time.Now().UTC(), event.Reason, fullPlayer)
+	if err != nil {
+		slog.Error("failed to create player event",
+			slog.String("error", err.Error()),
+			slog.Int("userId", int(event.Player.UserId)),
+		)
+		return fmt.Errorf("failed to create player event: %w", err)
 	}
 
-	p.playerUpdateEventHandler(&domain.FullPlayerUpdateEvent{
-		Reason: event.Reason,
-		Player: &fullPlayer,
+	return p.outbox.Add(ctx, s.Tx, outboxPlayerUpdate, playerUpdateMessage{
+		UserId: event.Player.UserId,
+		Seq:    seq,
+		Event: &domain.FullPlayerUpdateEvent{
+			Seq:    seq,
+			Reason: event.Reason,
+			Player: &fullPlayer,
+		},
 	})
-	return nil
 }
 
-func (p *Player) SendInitialEvents(ctx context.Context, userId int32) error {
+// GetInitialPlayerEvent returns the current state of the player. Its seq is that of the last event
+// of the user, so a client can resume from it.
+func (p *Player) GetInitialPlayerEvent(ctx context.Context, userId int32) (*domain.FullPlayerUpdateEvent, error) {
+	// the seq is read first so that the state is at least as new as it
+	seq, err := p.playerStore.GetLastEventSeq(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
 	player, err := p.playerStore.Get(ctx, userId)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	fullPlayer, err := p.getFullPlayer(ctx, p.stores(), player)
+	if err != nil {
+		return nil, err
 	}
-	return p.sendPlayerUpdateEventErr(ctx, &domain.PlayerUpdateEvent{
+	return &domain.FullPlayerUpdateEvent{
+		Seq:    seq,
 		Reason: domain.PlayerUpdateEventInitial,
-		Player: &player,
-	})
+		Player: &fullPlayer,
+	}, nil
 }
 
-func (p *Player) getFullPlayer(ctx context.Context, player domain.Player) (domain.FullPlayer, error) {
-	portableIslands, err := p.islandStore.GetPortableIslands(ctx, player.UserId)
+func (p *Player) getFullPlayer(ctx context.Context, s domain.GameStores, player domain.Player) (domain.FullPlayer, error) {
+	portableIslands, err := s.Island.GetPortableIslands(ctx, player.UserId)
 	if err != nil {
 		return domain.FullPlayer{}, fmt.Errorf("failed to get portable islands: %w", err)
 	}
-	territories, err := p.territoryStore.ListTerritories(ctx)
+	territories, err := s.Territory.ListTerritories(ctx)
 	if err != nil {
 		return domain.FullPlayer{}, fmt.Errorf("failed to get territories: %w", err)
 	}
@@ -278,7 +444,7 @@ func (p *Player) getFullPlayer(ctx context.Context, player domain.Player) (domai
 			TerritoryName:  territoryName,
 		})
 	}
-	knowledgeBars, err := p.questionStore.GetKnowledgeBars(ctx, player.UserId)
+	knowledgeBars, err := s.Question.GetKnowledgeBars(ctx, player.UserId)
 	if err != nil {
 		return domain.FullPlayer{}, fmt.Errorf("failed to get knowledge bars: %w", err)
 	}
@@ -295,7 +461,7 @@ func (p *Player) applyCorrections(ctx context.Context) {
 
 	corrections, err := p.questionStore.GetUnappliedCorrections(ctx, time.Now().Add(-p.cfg.CorrectionRevertWindow).UTC())
 	if err != nil {
-		slog.Error("failed to GetUnappliedCorrections from db", err)
+		slog.Error("failed to GetUnappliedCorrections from db", slog.String("error", err.Error()))
 		return
 	}
 
@@ -312,7 +478,7 @@ func (p *Player) applyCorrections(ctx context.Context) {
 			}()
 			ok, err := p.applyCorrection(ctx, c)
 			if err != nil {
-				slog.Error("failed to ApplyCorrection from db", err)
+				slog.Error("failed to ApplyCorrection from db", slog.String("error", err.Error()))
 				return
 			}
 			if ok {
@@ -328,88 +494,66 @@ func (p *Player) applyCorrections(ctx context.Context) {
 }
 
 func (p *Player) applyCorrection(ctx context.Context, c domain.Correction) (ok bool, err error) {
-	tx, err := p.db.BeginTx(ctx, nil)
-	if err != nil {
-		return false, fmt.Errorf("failed to begin transaction: %w", err)
-	}
-	var event *domain.PlayerUpdateEvent
-	defer func() {
-		if err != nil || event == nil {
-			return
-		}
-		if err := p.sendPlayerUpdateEventErr(ctx, event); err != nil {
-			err = fmt.Errorf("failed to send player update event: %w", err)
+	err = p.uow.Do(ctx, func(s domain.GameStores) error {
+		var answer domain.Answer
+		var err error
+		answer, ok, err = s.Question.ApplyCorrection(ctx, s.Tx, time.Now().Add(-p.cfg.MinCorrectionDelay).UTC(), c)
+		if err != nil || !ok {
+			return err
 		}
-	}()
-	defer func() {
+
+		question, err := s.Question.GetQuestion(ctx, c.QuestionId)
 		if err != nil {
-			err = errors.Join(err, tx.Rollback())
-		} else {
-			err = tx.Commit()
+			return err
 		}
-	}()
-
-	var answer domain.Answer
-	answer, ok, err = p.questionStore.ApplyCorrection(ctx, tx, time.Now().Add(-p.cfg.MinCorrectionDelay).UTC(), c)
-	if err != nil {
-		return false, err
-	}
-	if !ok {
-		return false, nil
-	}
-
-	question, err := p.questionStore.GetQuestion(ctx, c.QuestionId)
-	if err != nil {
-		return false, err
-	}
 
-	currentPlayer, err := p.playerStore.Get(ctx, c.UserId)
-	if err != nil {
-		return false, err
-	}
+		currentPlayer, err := s.Player.Get(ctx, c.UserId)
+		if err != nil {
+			return err
+		}
 
-	pool, hasPool, err := p.islandStore.GetPoolOfBook(ctx, question.BookID)
-	if err != nil {
-		return false, err
-	}
+		pool, hasPool, err := s.Island.GetPoolOfBook(ctx, question.BookID)
+		if err != nil {
+			return err
+		}
 
-	event, reward, rewarded := domain.GetRewardOfCorrection(currentPlayer, question, c, pool, hasPool)
-	if rewarded {
-		if err := p.playerStore.Update(ctx, tx, currentPlayer, *event.Player); err != nil {
-			return false, err
+		event, reward, rewarded := domain.GetRewardOfCorrection(currentPlayer, question, c, pool, hasPool)
+		if rewarded {
+			if err := p.applyPlayerUpdateEvent(ctx, s, currentPlayer, event); err != nil {
+				return err
+			}
 		}
-	}
 
-	islandHeader, err := p.islandStore.GetIslandHeaderByBookIdAndUserId(ctx, question.BookID, answer.UserID)
-	if err != nil {
-		return false, err
-	}
-	territory, err := p.territoryStore.GetTerritoryByID(ctx, islandHeader.TerritoryID)
-	if err != nil {
-		return false, err
-	}
+		islandHeader, err := s.Island.GetIslandHeaderByBookIdAndUserId(ctx, question.BookID, answer.UserID)
+		if err != nil {
+			return err
+		}
+		territory, err := s.Territory.GetTerritoryByID(ctx, islandHeader.TerritoryID)
+		if err != nil {
+			return err
+		}
 
-	err = p.createAndSendInboxMessage(ctx, tx, domain.InboxMessage{
-		ID:        domain.NewID(domain.ResourceTypeInboxMessage),
-		UserID:    c.UserId,
-		CreatedAt: time.Now().UTC(),
-		Content: domain.InboxMessageContent{
-			NewCorrection: &domain.InboxMessageNewCorrection{
-				TerritoryID:   territory.ID,
-				TerritoryName: territory.Name,
-				IslandID:      islandHeader.ID,
-				IslandName:    islandHeader.Name,
-				InputID:       answer.QuestionID,
-				NewState:      domain.GetSubmissionState(question, answer),
-				Reward:        reward,
+		return p.createAndSendInboxMessage(ctx, s, domain.InboxMessage{
+			ID:        domain.NewID(domain.ResourceTypeInboxMessage),
+			UserID:    c.UserId,
+			CreatedAt: time.Now().UTC(),
+			Content: domain.InboxMessageContent{
+				NewCorrection: &domain.InboxMessageNewCorrection{
+					TerritoryID:   territory.ID,
+					TerritoryName: territory.Name,
+					IslandID:      islandHeader.ID,
+					IslandName:    islandHeader.Name,
+					InputID:       answer.QuestionID,
+					NewState:      domain.GetSubmissionState(question, answer),
+					Reward:        reward,
+				},
 			},
-		},
+		})
 	})
 	if err != nil {
 		return false, err
 	}
-
-	return true, nil
+	return ok, nil
 }
 
 func (p *Player) MigrateCheck(ctx context.Context, userId int32) (*domain.MigrateCheckResult, error) {
@@ -435,28 +579,21 @@ func (p *Player) MigrateCheck(ctx context.Context, userId int32) (*domain.Migrat
 }
 
 func (p *Player) Migrate(ctx context.Context, userId int32, toTerritory string) error {
-	player, err := p.playerStore.Get(ctx, userId)
-	if err != nil {
-		return err
-	}
-	territories, err := p.territoryStore.ListTerritories(ctx)
-	if err != nil {
-		return err
-	}
-	currentTerritory, err := p.territoryStore.GetTerritoryByID(ctx, player.AtTerritory)
-	if err != nil {
-		return err
-	}
-	knowledgeBars, err := p.questionStore.GetKnowledgeBars(ctx, userId)
-	if err != nil {
-		return err
-	}
-
-	event, err := domain.Migrate(player, knowledgeBars, *currentTerritory, territories, toTerritory)
-	if err != nil {
-		return err
-	}
-	return p.applyAndSendPlayerUpdateEvent(ctx, player, event)
+	return p.updatePlayer(ctx, userId, func(s domain.GameStores, player domain.Player) (*domain.PlayerUpdateEvent, error) {
+		territories, err := s.Territory.ListTerritories(ctx)
+		if err != nil {
+			return nil, err
+		}
+		currentTerritory, err := s.Territory.GetTerritoryByID(ctx, player.AtTerritory)
+		if err != nil {
+			return nil, err
+		}
+		knowledgeBars, err := s.Question.GetKnowledgeBars(ctx, userId)
+		if err != nil {
+			return nil, err
+		}
+		return domain.Migrate(player, knowledgeBars, *currentTerritory, territories, toTerritory)
+	})
 }
 
 func (p *Player) UnlockTreasureCheck(ctx context.Context, userId int32, treasureId string) (*domain.UnlockTreasureCheckResult, error) {
@@ -484,49 +621,53 @@ func (p *Player) UnlockTreasureCheck(ctx context.Context, userId int32, treasure
 }
 
 func (p *Player) UnlockTreasure(ctx context.Context, userId int32, treasureId string, chosenCost string) (*domain.IslandTreasure, error) {
-	player, err := p.playerStore.Get(ctx, userId)
-	if err != nil {
-		return nil, err
-	}
-	treasure, err := p.treasureStore.GetTreasure(ctx, treasureId)
-	if err != nil {
-		return nil, err
-	}
-	bookId, err := p.islandStore.GetBookOfIsland(ctx, player.AtIsland, userId)
-	if errors.Is(err, domain.ErrNoBookAssignedFromPool) {
-		err = nil
-		bookId = ""
-	} else if err != nil {
-		return nil, err
-	}
-	userTreasure, err := p.treasureStore.GetUserTreasure(ctx, userId, treasureId)
-	if err != nil {
-		return nil, err
-	}
-	event, updatedUserTreasure, err := domain.UnlockTreasure(player, treasure, userTreasure, bookId, chosenCost)
-	if err != nil {
-		return nil, err
-	}
-	err = p.treasureStore.UpdateUserTreasure(ctx, userTreasure, updatedUserTreasure)
+	var islandTreasure domain.IslandTreasure
+	err := p.updatePlayer(ctx, userId, func(s domain.GameStores, player domain.Player) (*domain.PlayerUpdateEvent, error) {
+		treasure, err := s.Treasure.GetTreasure(ctx, treasureId)
+		if err != nil {
+			return nil, err
+		}
+		bookId, err := s.Island.GetBookOfIsland(ctx, player.AtIsland, userId)
+		if errors.Is(err, domain.ErrNoBookAssignedFromPool) {
+			err = nil
+			bookId = ""
+		} else if err != nil {
+			return nil, err
+		}
+		userTreasure, err := s.Treasure.GetUserTreasure(ctx, userId, treasureId)
+		if err != nil {
+			return nil, err
+		}
+		event, updatedUserTreasure, err := domain.UnlockTreasure(player, treasure, userTreasure, bookId, chosenCost)
+		if err != nil {
+			return nil, err
+		}
+		err = s.Treasure.UpdateUserTreasure(ctx, userTreasure, updatedUserTreasure)
+		if err != nil {
+			return nil, err
+		}
+		islandTreasure = domain.GetIslandTreasureOfUserTreasure(updatedUserTreasure, true)
+		return event, nil
+	})
 	if err != nil {
 		return nil, err
 	}
-	islandTreasure := domain.GetIslandTreasureOfUserTreasure(updatedUserTreasure, true)
-	return &islandTreasure, p.applyAndSendPlayerUpdateEvent(ctx, player, event)
+	return &islandTreasure, nil
 }
 
 func (p *Player) HandleNewPortableIsland(userId int32) {
 	go func() {
 		ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
 		defer cancel()
-		player, err := p.playerStore.Get(ctx, userId)
-		if err != nil {
-			slog.Error("failed to get player for sending new portable island update", "error", err.Error())
-			return
-		}
-		err = p.sendPlayerUpdateEventErr(ctx, &domain.PlayerUpdateEvent{
-			Reason: domain.PlayerUpdateEventNewBook,
-			Player: &player,
+		err := p.uow.Do(ctx, func(s domain.GameStores) error {
+			player, err := s.Player.Get(ctx, userId)
+			if err != nil {
+				return fmt.Errorf("failed to get player: %w", err)
+			}
+			return p.queuePlayerUpdateEvent(ctx, s, &domain.PlayerUpdateEvent{
+				Reason: domain.PlayerUpdateEventNewBook,
+				Player: &player,
+			})
 		})
 		if err != nil {
 			slog.Error("failed to send new portable island update", "error", err.Error())
@@ -548,191 +689,149 @@ func (p *Player) MakeOfferCheck(ctx context.Context, userId int32) (*domain.Make
 	return &check, nil
 }
 
-func (p *Player) MakeOffer(ctx context.Context, offerer *domain.User, offered, requested domain.Cost) (result *domain.TradeOfferView, err error) {
-	player, err := p.playerStore.Get(ctx, offerer.ID)
-	if err != nil {
-		return nil, err
-	}
-	count, err := p.marketStore.GetOffersCountOfUser(ctx, offerer.ID)
-	if err != nil {
-		return nil, err
-	}
-	event, tradeOffer, err := domain.MakeOffer(player, count, offered, requested)
-	if err != nil {
-		return nil, err
-	}
-
-	tx, err := p.db.BeginTx(ctx, nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to start transaction: %w", err)
-	}
-	defer func() {
+func (p *Player) MakeOffer(ctx context.Context, offerer *domain.User, offered, requested domain.Cost) (*domain.TradeOfferView, error) {
+	var view domain.TradeOfferView
+	err := p.uow.Do(ctx, func(s domain.GameStores) error {
+		player, err := s.Player.Get(ctx, offerer.ID)
 		if err != nil {
-			err = errors.Join(err, tx.Rollback())
-		} else {
-			err = tx.Commit()
+			return err
 		}
-	}()
-	err = p.marketStore.CreateOffer(ctx, tx, tradeOffer)
-	if err != nil {
-		return nil, err
-	}
-	err = p.playerStore.Update(ctx, tx, player, *event.Player)
-	if err != nil {
-		return nil, err
-	}
-	err = p.sendPlayerUpdateEventErr(ctx, event)
+		count, err := s.Market.GetOffersCountOfUser(ctx, offerer.ID)
+		if err != nil {
+			return err
+		}
+		event, tradeOffer, err := domain.MakeOffer(player, count, offered, requested)
+		if err != nil {
+			return err
+		}
+
+		err = s.Market.CreateOffer(ctx, s.Tx, tradeOffer)
+		if err != nil {
+			return err
+		}
+		err = p.applyPlayerUpdateEvent(ctx, s, player, event)
+		if err != nil {
+			return err
+		}
+		newOfferEvent := func(userId int32) *domain.TradeEvent {
+			return &domain.TradeEvent{
+				NewOffer: &domain.NewOfferTradeEvent{
+					Offer: domain.TradeOfferViewForPlayer(userId, offerer.Name, tradeOffer),
+				},
+			}
+		}
+		err = p.outbox.Add(ctx, s.Tx, outboxTradeBroadcast, domain.TradeEventBroadcast{
+			Offerer:    offerer.ID,
+			ForOfferer: newOfferEvent(offerer.ID),
+			// no player has id zero, so it stands for the other players
+			ForOthers: newOfferEvent(0),
+		})
+		if err != nil {
+			return err
+		}
+		view = domain.TradeOfferViewForPlayer(offerer.ID, offerer.Name, tradeOffer)
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
-	p.tradeEventBroadcastHandler(func(userId int32) *domain.TradeEvent {
-		return &domain.TradeEvent{
-			NewOffer: &domain.NewOfferTradeEvent{
-				Offer: domain.TradeOfferViewForPlayer(userId, offerer.Name, tradeOffer),
-			},
-		}
-	})
-	view := domain.TradeOfferViewForPlayer(offerer.ID, offerer.Name, tradeOffer)
 	return &view, nil
 }
 
-func (p *Player) AcceptOffer(ctx context.Context, userId int32, tradeOfferId string) (err error) {
-	acceptor, err := p.playerStore.Get(ctx, userId)
-	if err != nil {
-		return err
-	}
-
-	offer, err := p.marketStore.GetOffer(ctx, tradeOfferId)
-	if err != nil {
-		return err
-	}
+func (p *Player) AcceptOffer(ctx context.Context, userId int32, tradeOfferId string) error {
+	return p.uow.Do(ctx, func(s domain.GameStores) error {
+		acceptor, err := s.Player.Get(ctx, userId)
+		if err != nil {
+			return err
+		}
 
-	offerer, err := p.playerStore.Get(ctx, offer.By)
-	if err != nil {
-		return err
-	}
+		offer, err := s.Market.GetOffer(ctx, tradeOfferId)
+		if err != nil {
+			return err
+		}
 
-	acceptorEvent, offererEvent, err := domain.AcceptOffer(acceptor, offerer, offer)
-	if err != nil {
-		return err
-	}
+		offerer, err := s.Player.Get(ctx, offer.By)
+		if err != nil {
+			return err
+		}
 
-	tx, err := p.db.BeginTx(ctx, nil)
-	if err != nil {
-		return fmt.Errorf("failed to start transaction: %w", err)
-	}
-	defer func() {
+		acceptorEvent, offererEvent, err := domain.AcceptOffer(acceptor, offerer, offer)
 		if err != nil {
-			err = errors.Join(err, tx.Rollback())
-		} else {
-			err = tx.Commit()
+			return err
 		}
-	}()
 
-	err = p.marketStore.DeleteOffer(ctx, tx, tradeOfferId)
-	if err != nil {
-		return err
-	}
+		err = s.Market.DeleteOffer(ctx, s.Tx, tradeOfferId)
+		if err != nil {
+			return err
+		}
 
-	err = p.playerStore.Update(ctx, tx, acceptor, *acceptorEvent.Player)
-	if err != nil {
-		return err
-	}
+		err = s.Player.Update(ctx, s.Tx, acceptor, *acceptorEvent.Player)
+		if err != nil {
+			return err
+		}
 
-	err = p.playerStore.Update(ctx, tx, offerer, *offererEvent.Player)
-	if err != nil {
-		return err
-	}
+		err = s.Player.Update(ctx, s.Tx, offerer, *offererEvent.Player)
+		if err != nil {
+			return err
+		}
 
-	err = p.createAndSendInboxMessage(ctx, tx, domain.InboxMessage{
-		ID:        domain.NewID(domain.ResourceTypeInboxMessage),
-		UserID:    offer.By,
-		CreatedAt: time.Now().UTC(),
-		Content: domain.InboxMessageContent{
-			OwnOfferAccepted: &domain.InboxMessageOwnOfferAccepted{
-				Offer: domain.TradeOfferViewForPlayer(offer.By, "", offer),
+		err = p.createAndSendInboxMessage(ctx, s, domain.InboxMessage{
+			ID:        domain.NewID(domain.ResourceTypeInboxMessage),
+			UserID:    offer.By,
+			CreatedAt: time.Now().UTC(),
+			Content: domain.InboxMessageContent{
+				OwnOfferAccepted: &domain.InboxMessageOwnOfferAccepted{
+					Offer: domain.TradeOfferViewForPlayer(offer.By, "", offer),
+				},
 			},
-		},
-	})
-	if err != nil {
-		return err
-	}
-
-	err = p.sendPlayerUpdateEventErr(ctx, acceptorEvent)
-	if err != nil {
-		return err
-	}
+		})
+		if err != nil {
+			return err
+		}
 
-	err = p.sendPlayerUpdateEventErr(ctx, offererEvent)
-	if err != nil {
-		return err
-	}
+		err = p.queuePlayerUpdateEvent(ctx, s, acceptorEvent)
+		if err != nil {
+			return err
+		}
 
-	p.tradeEventBroadcastHandler(func(userId int32) *domain.TradeEvent {
-		return &domain.TradeEvent{
-			DeletedOffer: &domain.DeletedOfferTradeEvent{
-				OfferID: offer.ID,
-				ByMe:    userId == offer.By,
-			},
+		err = p.queuePlayerUpdateEvent(ctx, s, offererEvent)
+		if err != nil {
+			return err
 		}
-	})
 
-	return nil
+		return p.outbox.Add(ctx, s.Tx, outboxTradeBroadcast, deletedOfferBroadcast(offer))
+	})
 }
 
-func (p *Player) DeleteOffer(ctx context.Context, userId int32, tradeOfferId string) (err error) {
-	player, err := p.playerStore.Get(ctx, userId)
-	if err != nil {
-		return err
-	}
-
-	offer, err := p.marketStore.GetOffer(ctx, tradeOfferId)
-	if err != nil {
-		return err
-	}
-
-	event, err := domain.DeleteOffer(player, offer)
-	if err != nil {
-		return err
-	}
-
-	tx, err := p.db.BeginTx(ctx, nil)
-	if err != nil {
-		return fmt.Errorf("failed to start transaction: %w", err)
-	}
-	defer func() {
+func (p *Player) DeleteOffer(ctx context.Context, userId int32, tradeOfferId string) error {
+	return p.uow.Do(ctx, func(s domain.GameStores) error {
+		player, err := s.Player.Get(ctx, userId)
 		if err != nil {
-			err = errors.Join(err, tx.Rollback())
-		} else {
-			err = tx.Commit()
+			return err
 		}
-	}()
 
-	err = p.marketStore.DeleteOffer(ctx, tx, tradeOfferId)
-	if err != nil {
-		return err
-	}
+		offer, err := s.Market.GetOffer(ctx, tradeOfferId)
+		if err != nil {
+			return err
+		}
 
-	err = p.playerStore.Update(ctx, tx, player, *event.Player)
-	if err != nil {
-		return err
-	}
+		event, err := domain.DeleteOffer(player, offer)
+		if err != nil {
+			return err
+		}
 
-	err = p.sendPlayerUpdateEventErr(ctx, event)
-	if err != nil {
-		return err
-	}
+		err = s.Market.DeleteOffer(ctx, s.Tx, tradeOfferId)
+		if err != nil {
+			return err
+		}
 
-	p.tradeEventBroadcastHandler(func(userId int32) *domain.TradeEvent {
-		return &domain.TradeEvent{
-			DeletedOffer: &domain.DeletedOfferTradeEvent{
-				OfferID: offer.ID,
-				ByMe:    userId == offer.By,
-			},
+		err = p.applyPlayerUpdateEvent(ctx, s, player, event)
+		if err != nil {
+			return err
 		}
-	})
 
-	return nil
+		return p.outbox.Add(ctx, s.Tx, outboxTradeBroadcast, deletedOfferBroadcast(offer))
+	})
 }
 
 func (p *Player) GetTradeOffers(ctx context.Context, userId int32, filter domain.GetOffersByFilterType, offset int64, limit int) ([]domain.TradeOfferView, error) {
@@ -761,6 +860,22 @@ func (p *Player) GetTradeOffers(ctx context.Context, userId int32, filter domain
 	return result, nil
 }
 
+func deletedOfferBroadcast(offer domain.TradeOffer) domain.TradeEventBroadcast {
+	deletedOfferEvent := func(byMe bool) *domain.TradeEvent {
+		return &domain.TradeEvent{
+			DeletedOffer: &domain.DeletedOfferTradeEvent{
+				OfferID: offer.ID,
+				ByMe:    byMe,
+			},
+		}
+	}
+	return domain.TradeEventBroadcast{
+		Offerer:    offer.By,
+		ForOfferer: deletedOfferEvent(true),
+		ForOthers:  deletedOfferEvent(false),
+	}
+}
+
 func (p *Player) OnTradeEventBroadcast(handler TradeEventBroadcastHandler) {
 	p.tradeEventBroadcastHandler = handler
 }
@@ -773,32 +888,68 @@ func (p *Player) GetInitialTradeEvent(_ context.Context) (*domain.TradeEvent, er
 	}, nil
 }
 
-func (p *Player) OnInboxEvent(handler func(e *domain.InboxEvent)) {
-	p.inboxEventHandler = handler
-}
-
-func (p *Player) createAndSendInboxMessage(ctx context.Context, tx domain.Tx, msg domain.InboxMessage) error {
-	err := p.inboxStore.CreateMessage(ctx, tx, msg)
+// createAndSendInboxMessage stores the message in the transaction of s and queues its event in the outbox.
+func (p *Player) createAndSendInboxMessage(ctx context.Context, s domain.GameStores, msg domain.InboxMessage) error {
+	seq, err := s.Inbox.CreateMessage(ctx, s.Tx, msg)
 	if err != nil {
 		return fmt.Errorf("failed to create inbox message: %w", err)
 	}
+	msg.Seq = seq
+	return p.queueInboxEvents(ctx, s.Tx, newInboxMessageEvent(msg))
+}
+
+func newInboxMessageEvent(msg domain.InboxMessage) *domain.InboxEvent {
 	view := domain.InboxMessageToView(msg)
-	p.inboxEventHandler(&domain.InboxEvent{
+	return &domain.InboxEvent{
 		UserId:     msg.UserID,
+		Seq:        msg.Seq,
 		NewMessage: &view,
-	})
-	return nil
+	}
 }
 
-func (p *Player) GetInitialInboxEvent(_ context.Context, userId int32) (*domain.InboxEvent, error) {
+func (p *Player) GetInitialInboxEvent(ctx context.Context, userId int32) (*domain.InboxEvent, error) {
+	seq, err := p.playerStore.GetLastEventSeq(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
 	return &domain.InboxEvent{
 		UserId: userId,
+		Seq:    seq,
 		Sync: &domain.SyncInboxEvent{
 			Offset: fmt.Sprint(time.Now().UTC().UnixMilli()),
 		},
 	}, nil
 }
 
+// GetPlayerEventsAfter returns the stored player events of the user after seq, oldest first.
+// If there are more than limit of them, ok is false and the client should start over from the initial event.
+func (p *Player) GetPlayerEventsAfter(ctx context.Context, userId int32, seq int64, limit int) (events []domain.FullPlayerUpdateEvent, ok bool, err error) {
+	events, err = p.playerStore.GetPlayerEventsAfter(ctx, userId, seq, limit+1)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(events) > limit {
+		return nil, false, nil
+	}
+	return events, true, nil
+}
+
+// GetInboxEventsAfter returns the inbox messages of the user after seq as events, oldest first.
+// If there are more than limit of them, ok is false and the client should start over from the initial event.
+func (p *Player) GetInboxEventsAfter(ctx context.Context, userId int32, seq int64, limit int) (events []*domain.InboxEvent, ok bool, err error) {
+	messages, err := p.inboxStore.GetMessagesAfter(ctx, userId, seq, limit+1)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(messages) > limit {
+		return nil, false, nil
+	}
+	for _, msg := range messages {
+		events = append(events, newInboxMessageEvent(msg))
+	}
+	return events, true, nil
+}
+
 func (p *Player) GetInboxMessages(ctx context.Context, userId int32, offset int64, limit int) ([]domain.InboxMessageView, error) {
 	limit = min(max(1, limit), 100)
 	before := time.Now().UTC()
@@ -820,41 +971,41 @@ func (p *Player) OnBroadcastMessage(f MessageBroadcastHandler) {
 	p.broadcastMessageHandler = f
 }
 
-func (p *Player) BroadcastMessage(ctx context.Context, text string) (int, error) {
-	players, err := p.playerStore.GetAll(ctx)
-	if err != nil {
-		return 0, fmt.Errorf("failed to get players: %w", err)
-	}
-	var errs []error
-	count := 0
-	messages := make(map[int32]domain.InboxMessage)
-
-	for _, player := range players {
-		msg := domain.InboxMessage{
-			ID:        domain.NewID(domain.ResourceTypeInboxMessage),
-			UserID:    player,
-			CreatedAt: time.Now().UTC(),
-			Content: domain.InboxMessageContent{
-				Announcement: &domain.InboxMessageAnnouncement{Text: text},
-			},
+// BroadcastMessage sends the message to the inbox of every player, all of them or none.
+func (p *Player) BroadcastMessage(ctx context.Context, text string) (sent int, err error) {
+	err = p.uow.Do(ctx, func(s domain.GameStores) error {
+		players, err := s.Player.GetAll(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to get players: %w", err)
 		}
-		messages[player] = msg
-		err := p.inboxStore.CreateMessage(ctx, nil, msg)
-		errs = append(errs, err)
-		if err == nil {
-			count++
+
+		events := make([]*domain.InboxEvent, 0, len(players))
+		for _, player := range players {
+			msg := domain.InboxMessage{
+				ID:        domain.NewID(domain.ResourceTypeInboxMessage),
+				UserID:    player,
+				CreatedAt: time.Now().UTC(),
+				Content: domain.InboxMessageContent{
+					Announcement: &domain.InboxMessageAnnouncement{Text: text},
+				},
+			}
+			seq, err := s.Inbox.CreateMessage(ctx, s.Tx, msg)
+			if err != nil {
+				return fmt.Errorf("failed to create inbox message: %w", err)
+			}
+			msg.Seq = seq
+			events = append(events, newInboxMessageEvent(msg))
 		}
-	}
-	p.broadcastMessageHandler(func(userId int32) *domain.InboxMessageView {
-		msg, ok := messages[userId]
-		if !ok {
-			return nil
+		if err := p.queueInboxEvents(ctx, s.Tx, events...); err != nil {
+			return err
 		}
-		r := domain.InboxMessageToView(msg)
-		return &r
+		sent = len(events)
+		return nil
 	})
-
-	return count, errors.Join(errs...)
+	if err != nil {
+		return 0, err
+	}
+	return sent, nil
 }
 
 func (p *Player) InvestCheck(ctx context.Context, user *domain.User) (*domain.InvestmentCheckResult, error) {
@@ -882,173 +1033,226 @@ func (p *Player) InvestCheck(ctx context.Context, user *domain.User) (*domain.In
 
 // Invest allows a player to make an investment
 func (p *Player) Invest(ctx context.Context, user *domain.User, sessionId string, coinAmount int32) (*domain.UserInvestment, error) {
-	player, err := p.playerStore.Get(ctx, user.ID)
-	if err != nil {
-		return nil, err
-	}
-
-	session, err := p.investStore.GetSession(ctx, sessionId)
-	if err != nil {
-		return nil, err
-	}
-
-	investments, err := p.investStore.GetUserInvestments(ctx, session.ID, user.ID)
-	if err != nil {
-		return nil, err
-	}
+	var userInvestment domain.UserInvestment
+	err := p.uow.Do(ctx, func(s domain.GameStores) error {
+		player, err := s.Player.Get(ctx, user.ID)
+		if err != nil {
+			return err
+		}
 
-	event, userInvestment, err := domain.Invest(*session, investments, player, coinAmount)
-	if err != nil {
-		return nil, err
-	}
+		session, err := s.Invest.GetSession(ctx, sessionId)
+		if err != nil {
+			return err
+		}
 
-	tx, err := p.db.BeginTx(ctx, nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to start transaction: %w", err)
-	}
-	defer func() {
-		if err == nil {
-			err = p.sendPlayerUpdateEventErr(ctx, event)
+		investments, err := s.Invest.GetUserInvestments(ctx, session.ID, user.ID)
+		if err != nil {
+			return err
 		}
-	}()
-	defer func() {
+
+		var event *domain.PlayerUpdateEvent
+		event, userInvestment, err = domain.Invest(*session, investments, player, coinAmount)
 		if err != nil {
-			err = errors.Join(err, tx.Rollback())
-		} else {
-			err = tx.Commit()
+			return err
 		}
-	}()
 
-	err = p.investStore.AddUserInvestment(ctx, tx, userInvestment)
-	if err != nil {
-		return nil, err
-	}
+		err = s.Invest.AddUserInvestment(ctx, s.Tx, userInvestment)
+		if err != nil {
+			return err
+		}
 
-	err = p.playerStore.Update(ctx, tx, player, *event.Player)
+		return p.applyPlayerUpdateEvent(ctx, s, player, event)
+	})
 	if err != nil {
 		return nil, err
 	}
-
 	return &userInvestment, nil
 }
 
+// maxPlayersPerIsland is how many other players a player sees on an island of the map.
+const maxPlayersPerIsland = 10
+
 type PlayersLocation struct {
-	IslandID string `json:"islandId"`
-	Players  []struct {
-		UserID int32  `json:"-"`
-		Name   string `json:"name"`
-	} `json:"players"`
+	IslandID string          `json:"islandId"`
+	Players  []LocatedPlayer `json:"players"`
 }
 
-func (p *Player) GetPlayerLocations(ctx context.Context, userId int32, territoryID string) ([]PlayersLocation, error) {
-	filterForUser := func(result []PlayersLocation) []PlayersLocation {
-		c := make([]PlayersLocation, 0, len(result))
-		for _, location := range result {
-			l := PlayersLocation{IslandID: location.IslandID}
-			for _, player := range location.Players {
-				if player.UserID != userId && len(l.Players) < 10 {
-					l.Players = append(l.Players, player)
-				}
-			}
-			if len(l.Players) > 0 {
-				c = append(c, l)
+type LocatedPlayer struct {
+	UserID int32  `json:"-"`
+	Name   string `json:"name"`
+}
+
+// PresenceEvent tells the players of the territories that a player moved on the maps or changed their visibility.
+type PresenceEvent struct {
+	UserId int32
+	// TerritoryID is the territory of the player after the change.
+	TerritoryID string
+	Changes     []TerritoryPlayersLocations
+}
+
+// TerritoryPlayersLocations has the players of the changed islands of a territory. An island
+// without players is listed too, and an island has one player more than a player can see,
+// so that there are still enough after leaving out the player.
+type TerritoryPlayersLocations struct {
+	TerritoryID string
+	Islands     []PlayersLocation
+}
+
+type PresenceEventHandler func(event PresenceEvent)
+
+func (p *Player) OnPresence(handler PresenceEventHandler) {
+	p.presenceEventHandler = handler
+}
+
+// FilterPlayerLocations leaves out the player and caps the players of every island.
+// Islands without players are dropped unless keepEmpty is set.
+func FilterPlayerLocations(locations []PlayersLocation, userId int32, keepEmpty bool) []PlayersLocation {
+	result := make([]PlayersLocation, 0, len(locations))
+	for _, location := range locations {
+		l := PlayersLocation{IslandID: location.IslandID, Players: []LocatedPlayer{}}
+		for _, player := range location.Players {
+			if player.UserID != userId && len(l.Players) < maxPlayersPerIsland {
+				l.Players = append(l.Players, player)
 			}
 		}
-		return c
+		if len(l.Players) > 0 || keepEmpty {
+			result = append(result, l)
+		}
+	}
+	return result
+}
+
+func (p *Player) GetPlayerLocations(ctx context.Context, userId int32, territoryID string) ([]PlayersLocation, error) {
+	result, err := p.getPlayerLocations(ctx, territoryID)
+	if err != nil {
+		return nil, err
+	}
+	return FilterPlayerLocations(result, userId, false), nil
+}
+
+// GetInitialPresence returns the territory of the player and the players they see on its map.
+func (p *Player) GetInitialPresence(ctx context.Context, userId int32) (string, []PlayersLocation, error) {
+	player, err := p.playerStore.Get(ctx, userId)
+	if err != nil {
+		return "", nil, err
+	}
+	locations, err := p.GetPlayerLocations(ctx, userId, player.AtTerritory)
+	if err != nil {
+		return "", nil, err
 	}
+	return player.AtTerritory, locations, nil
+}
 
+func (p *Player) getPlayerLocations(ctx context.Context, territoryID string) ([]PlayersLocation, error) {
 	v, ok := p.playerLocationsCache.Get(territoryID)
 	if ok {
 		result, _ := v.([]PlayersLocation)
-		return filterForUser(result), nil
+		return result, nil
 	}
+	result, err := p.readPlayerLocations(ctx, territoryID)
+	if err != nil {
+		return nil, err
+	}
+	p.playerLocationsCache.SetDefault(territoryID, result)
+	return result, nil
+}
 
+// readPlayerLocations reads the players of every island of the territory,
+// keeping one more than a player can see.
+func (p *Player) readPlayerLocations(ctx context.Context, territoryID string) ([]PlayersLocation, error) {
 	locations, err := p.playerStore.GetLocations(ctx, territoryID)
 	if err != nil {
 		return nil, err
 	}
-	if len(locations) == 0 {
-		return nil, nil
+	var result []PlayersLocation
+	islands := make(map[string]int)
+	for _, l := range locations {
+		i, ok := islands[l.IslandID]
+		if !ok {
+			i = len(result)
+			islands[l.IslandID] = i
+			result = append(result, PlayersLocation{IslandID: l.IslandID})
+		}
+		if len(result[i].Players) <= maxPlayersPerIsland {
+			result[i].Players = append(result[i].Players, LocatedPlayer{UserID: l.UserId, Name: l.Name})
+		}
 	}
+	return result, nil
+}
 
-	result := make([]PlayersLocation, 0, len(locations))
-	for island, players := range locations {
-		location := PlayersLocation{
-			IslandID: island,
+// sendPresenceEvent sends the new players of the islands the player left and arrived at.
+func (p *Player) sendPresenceEvent(ctx context.Context, oldPlayer, player domain.Player) {
+	type island struct{ territoryID, islandID string }
+	changed := []island{{oldPlayer.AtTerritory, oldPlayer.AtIsland}}
+	if oldPlayer.AtTerritory != player.AtTerritory || oldPlayer.AtIsland != player.AtIsland {
+		changed = append(changed, island{player.AtTerritory, player.AtIsland})
+	}
+	event := PresenceEvent{UserId: player.UserId, TerritoryID: player.AtTerritory}
+	for _, c := range changed {
+		locations, err := p.readPlayerLocations(ctx, c.territoryID)
+		if err != nil {
+			slog.Error("failed to read player locations",
+				slog.String("territory", c.territoryID),
+				slog.String("error", err.Error()),
+			)
+			return
 		}
-		for _, userId := range players {
-			user, err := p.userStore.Get(ctx, userId)
-			if err != nil {
-				return nil, err
+		l := PlayersLocation{IslandID: c.islandID, Players: []LocatedPlayer{}}
+		for _, location := range locations {
+			if location.IslandID == c.islandID {
+				l.Players = location.Players
 			}
-			location.Players = append(location.Players, struct {
-				UserID int32  `json:"-"`
-				Name   string `json:"name"`
-			}{UserID: userId, Name: user.Name})
 		}
-		result = append(result, location)
+		if len(event.Changes) > 0 && event.Changes[0].TerritoryID == c.territoryID {
+			event.Changes[0].Islands = append(event.Changes[0].Islands, l)
+		} else {
+			event.Changes = append(event.Changes, TerritoryPlayersLocations{TerritoryID: c.territoryID, Islands: []PlayersLocation{l}})
+		}
 	}
-
-	p.playerLocationsCache.SetDefault(territoryID, result)
-	return filterForUser(result), nil
+	p.presenceEventHandler(event)
 }
 
 func (p *Player) ResolveInvestmentSession(ctx context.Context, sessionID string, coefficient float64) (affectedPlayers int, sumOfRewards int, err error) {
-	session, err := p.investStore.GetSession(ctx, sessionID)
-	if err != nil {
-		return 0, 0, err
-	}
-	investments, err := p.investStore.GetAllUserInvestments(ctx, session.ID)
-	if err != nil {
-		return 0, 0, err
-	}
+	err = p.uow.Do(ctx, func(s domain.GameStores) error {
+		affectedPlayers, sumOfRewards = 0, 0
 
-	rewards, err := domain.ResolveInvestments(*session, investments, coefficient)
-	if err != nil {
-		return 0, 0, err
-	}
-
-	tx, err := p.db.BeginTx(ctx, nil)
-	if err != nil {
-		return 0, 0, err
-	}
-
-	var events []domain.PlayerUpdateEvent
-	defer func() {
-		if err == nil {
-			for _, e := range events {
-				_ = p.sendPlayerUpdateEventErr(ctx, &e)
-			}
+		session, err := s.Invest.GetSession(ctx, sessionID)
+		if err != nil {
+			return err
 		}
-	}()
-	defer func() {
+		investments, err := s.Invest.GetAllUserInvestments(ctx, session.ID)
 		if err != nil {
-			err = errors.Join(err, tx.Rollback())
-		} else {
-			err = tx.Commit()
+			return err
 		}
-	}()
 
-	err = p.investStore.MarkResolved(ctx, tx, session.ID)
-	if err != nil {
-		return 0, 0, err
-	}
+		rewards, err := domain.ResolveInvestments(*session, investments, coefficient)
+		if err != nil {
+			return err
+		}
 
-	for userId, coinCount := range rewards {
-		player, err := p.playerStore.Get(ctx, userId)
+		err = s.Invest.MarkResolved(ctx, s.Tx, session.ID)
 		if err != nil {
-			return 0, 0, err
+			return err
 		}
-		event, ok := domain.GiveInvestmentReward(player, coinCount)
-		if ok {
-			if err := p.playerStore.Update(ctx, tx, player, *event.Player); err != nil {
-				return 0, 0, err
+
+		for userId, coinCount := range rewards {
+			player, err := s.Player.Get(ctx, userId)
+			if err != nil {
+				return err
+			}
+			event, ok := domain.GiveInvestmentReward(player, coinCount)
+			if ok {
+				if err := p.applyPlayerUpdateEvent(ctx, s, player, &event); err != nil {
+					return err
+				}
+				sumOfRewards += int(coinCount)
+				affectedPlayers++
 			}
-			sumOfRewards += int(coinCount)
-			affectedPlayers++
-			events = append(events, event)
 		}
+		return nil
+	})
+	if err != nil {
+		return 0, 0, err
 	}
-
-	return
+	return affectedPlayers, sumOfRewards, nil
 }
@@ -0,0 +1,58 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/Rastaiha/bermudia/internal/domain"
+	"log/slog"
+	"math/rand"
+	"time"
+)
+
+// unitOfWorkAttempts is how many times a unit of work is run before its conflict is returned.
+const unitOfWorkAttempts = 3
+
+// UnitOfWork runs an action of the game with stores that share a single transaction.
+// An action that conflicts with a concurrent change of a player or a treasure is run again
+// on a new transaction, so it must read what it decides on through the stores it is given
+// and leave its other side effects until after Do returns.
+type UnitOfWork struct {
+	transactor domain.GameTransactor
+	outbox     *Outbox
+}
+
+func NewUnitOfWork(transactor domain.GameTransactor, outbox *Outbox) *UnitOfWork {
+	return &UnitOfWork{
+		transactor: transactor,
+		outbox:     outbox,
+	}
+}
+
+// Do runs f in a transaction that is committed if f returns nil.
+// The messages that f added to the outbox are dispatched after the commit.
+func (u *UnitOfWork) Do(ctx context.Context, f func(stores domain.GameStores) error) error {
+	for attempt := 1; ; attempt++ {
+		err := u.transactor.InGameTx(ctx, f)
+		if err == nil {
+			u.outbox.Notify()
+			return nil
+		}
+		if attempt == unitOfWorkAttempts || !isConflict(err) {
+			return err
+		}
+		slog.Debug("retrying unit of work after conflict",
+			slog.Int("attempt", attempt),
+			slog.String("error", err.Error()),
+		)
+		// a random delay, so that the conflicting actions do not collide again
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(time.Duration(attempt) * time.Duration(5+rand.Intn(20)) * time.Millisecond):
+		}
+	}
+}
+
+func isConflict(err error) bool {
+	return errors.Is(err, domain.ErrPlayerConflict) || errors.Is(err, domain.ErrUserTreasureConflict)
+}
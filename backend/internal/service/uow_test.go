@@ -0,0 +1,219 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/Rastaiha/bermudia/internal/config"
+	"github.com/Rastaiha/bermudia/internal/domain"
+	"github.com/Rastaiha/bermudia/internal/eventbus"
+	"github.com/Rastaiha/bermudia/internal/mock"
+	"github.com/Rastaiha/bermudia/internal/repository"
+	"github.com/Rastaiha/bermudia/internal/service"
+)
+
+// staleTransactor makes the first transaction it runs read a player that a concurrent
+// change has updated in the meantime, as happens when two actions of a player race.
+type staleTransactor struct {
+	domain.GameTransactor
+	players   domain.PlayerStore
+	userId    int32
+	stale     atomic.Bool
+	conflicts atomic.Int32
+}
+
+func (t *staleTransactor) InGameTx(ctx context.Context, f func(stores domain.GameStores) error) error {
+	run := f
+	if t.stale.CompareAndSwap(true, false) {
+		old, err := t.players.Get(ctx, t.userId)
+		if err != nil {
+			return err
+		}
+		granted := old
+		granted.Coin++
+		if err := t.players.Update(ctx, nil, old, granted); err != nil {
+			return err
+		}
+		run = func(stores domain.GameStores) error {
+			stores.Player = &stalePlayerStore{PlayerStore: stores.Player, stale: &old}
+			return f(stores)
+		}
+	}
+	err := t.GameTransactor.InGameTx(ctx, run)
+	if errors.Is(err, domain.ErrPlayerConflict) {
+		t.conflicts.Add(1)
+	}
+	return err
+}
+
+// stalePlayerStore returns the stale player on its first Get.
+type stalePlayerStore struct {
+	domain.PlayerStore
+	stale *domain.Player
+}
+
+func (s *stalePlayerStore) Get(ctx context.Context, userId int32) (domain.Player, error) {
+	if s.stale != nil && s.stale.UserId == userId {
+		p := *s.stale
+		s.stale = nil
+		return p, nil
+	}
+	return s.PlayerStore.Get(ctx, userId)
+}
+
+func TestUnitOfWorkConcurrentActions(t *testing.T) {
+	ctx := context.Background()
+	t.Setenv("TMPDIR", t.TempDir())
+	db, err := repository.ConnectToSqlite()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = db.Close()
+	})
+	cfg := config.Config{}
+
+	territoryRepo := must(repository.NewSqlTerritoryRepository(db))(t)
+	islandRepo := must(repository.NewSqlIslandRepository(db))(t)
+	userRepo := must(repository.NewSqlUser(db))(t)
+	playerRepo := must(repository.NewSqlPlayerRepository(db))(t)
+	questionStore := must(repository.NewSqlQuestionRepository(db))(t)
+	treasureRepo := must(repository.NewSqlTreasureRepository(db))(t)
+	marketRepo := must(repository.NewSqlMarketRepository(db))(t)
+	inboxRepo := must(repository.NewSqlInboxRepository(db))(t)
+	investRepo := must(repository.NewSqlInvestRepository(db))(t)
+	feedbackTemplateRepo := must(repository.NewSqlFeedbackTemplateRepository(db))(t)
+	contentVersionRepo := must(repository.NewSqlContentVersionRepository(db))(t)
+	outboxRepo := must(repository.NewSqlOutboxRepository(db))(t)
+
+	transactor := &staleTransactor{GameTransactor: repository.NewSqlGameTransactor(db), players: playerRepo}
+	outbox := service.NewOutbox(outboxRepo)
+	uow := service.NewUnitOfWork(transactor, outbox)
+	playerService := service.NewPlayer(cfg, uow, eventbus.NewMemory(), outbox, userRepo, playerRepo, territoryRepo, questionStore, islandRepo, treasureRepo, marketRepo, inboxRepo, investRepo)
+	adminService := service.NewAdmin(cfg, territoryRepo, islandRepo, userRepo, playerRepo, questionStore, treasureRepo, feedbackTemplateRepo, contentVersionRepo, repository.NewSqlContentTransactor(db), playerService)
+	if err := mock.SetGameContent(adminService, mock.DataFiles, "", "pass", "test", false); err != nil {
+		t.Fatal(err)
+	}
+
+	// a player anchored at an island with a treasure, with enough of everything to pay for it
+	var treasureId, islandId, territoryId string
+	err = db.QueryRowContext(ctx,
+		`SELECT t.id, i.id, i.territory_id FROM treasures t JOIN islands i ON i.book_id = t.book_id WHERE NOT i.from_pool ORDER BY t.id LIMIT 1`,
+	).Scan(&treasureId, &islandId, &territoryId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	userIds, err := playerRepo.GetAll(ctx)
+	if err != nil || len(userIds) == 0 {
+		t.Fatalf("no players: %v", err)
+	}
+	user, err := userRepo.Get(ctx, userIds[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	player, err := playerRepo.Get(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	initial := player
+	initial.AtTerritory, initial.AtIsland, initial.Anchored = territoryId, islandId, true
+	initial.Coin, initial.RedKey, initial.BlueKey, initial.GoldenKey, initial.MasterKey = 100, 100, 100, 100, 100
+	if err := playerRepo.Update(ctx, nil, player, initial); err != nil {
+		t.Fatal(err)
+	}
+	// as when the player opens the island
+	if _, err := treasureRepo.GetOrCreateUserTreasure(ctx, user.ID, treasureId); err != nil {
+		t.Fatal(err)
+	}
+	transactor.userId = user.ID
+	transactor.stale.Store(true)
+
+	const offers = 4
+	offered := domain.Cost{Items: []domain.CostItem{{Type: domain.CostItemTypeCoin, Amount: 1}}}
+	requested := domain.Cost{Items: []domain.CostItem{{Type: domain.CostItemTypeBlueKey, Amount: 1}}}
+	var wg sync.WaitGroup
+	errs := make(chan error, offers+1)
+	wg.Add(offers + 1)
+	go func() {
+		defer wg.Done()
+		_, err := playerService.UnlockTreasure(ctx, user.ID, treasureId, "")
+		errs <- err
+	}()
+	for range offers {
+		go func() {
+			defer wg.Done()
+			_, err := playerService.MakeOffer(ctx, user, offered, requested)
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if transactor.conflicts.Load() == 0 {
+		t.Error("no conflict happened")
+	}
+	userTreasure, err := treasureRepo.GetUserTreasure(ctx, user.ID, treasureId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !userTreasure.Unlocked || userTreasure.Reward == nil {
+		t.Fatal("treasure is not unlocked")
+	}
+	want := initial
+	want.Coin++ // the concurrent grant
+	addCost(&want, userTreasure.Cost, -1)
+	addCost(&want, *userTreasure.Reward, 1)
+	addCost(&want, offered, -offers)
+	got, err := playerRepo.Get(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Coin != want.Coin || got.RedKey != want.RedKey || got.BlueKey != want.BlueKey || got.GoldenKey != want.GoldenKey || got.MasterKey != want.MasterKey || got.Fuel != want.Fuel {
+		t.Errorf("player = %+v, want %+v", got, want)
+	}
+	var count int
+	if err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM trade_offers WHERE by = $1`, user.ID).Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if count != offers {
+		t.Errorf("%d offers stored, want %d", count, offers)
+	}
+}
+
+func must[T any](v T, err error) func(t *testing.T) T {
+	return func(t *testing.T) T {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+}
+
+func addCost(p *domain.Player, cost domain.Cost, times int) {
+	for _, item := range cost.Items {
+		amount := item.Amount * int32(times)
+		switch item.Type {
+		case domain.CostItemTypeFuel:
+			p.Fuel += amount
+		case domain.CostItemTypeCoin:
+			p.Coin += amount
+		case domain.CostItemTypeBlueKey:
+			p.BlueKey += amount
+		case domain.CostItemTypeRedKey:
+			p.RedKey += amount
+		case domain.CostItemTypeGoldenKey:
+			p.GoldenKey += amount
+		case domain.CostItemTypeMasterKey:
+			p.MasterKey += amount
+		}
+	}
+}
@@ -6,7 +6,10 @@ import (
 	"github.com/Rastaiha/bermudia/api/handler"
 	"github.com/Rastaiha/bermudia/internal/config"
 	"github.com/Rastaiha/bermudia/internal/domain"
+	"github.com/Rastaiha/bermudia/internal/eventbus"
+	"github.com/Rastaiha/bermudia/internal/filestore"
 	"github.com/Rastaiha/bermudia/internal/mock"
+	"github.com/Rastaiha/bermudia/internal/notifier"
 	"github.com/Rastaiha/bermudia/internal/repository"
 	"github.com/Rastaiha/bermudia/internal/service"
 	"github.com/go-telegram/bot"
@@ -22,9 +25,26 @@ func main() {
 
 	domain.ApplyConfig(cfg)
 
-	theBot, err := bot.New(cfg.BotToken, bot.WithServerURL("https://tapi.bale.ai"))
+	var theBot *bot.Bot
+	var err error
+	if cfg.CorrectionChannel == config.CorrectionChannelBot {
+		theBot, err = bot.New(cfg.BotToken, bot.WithServerURL(cfg.BotServerURL))
+		if err != nil {
+			log.Fatal("failed to connect to bot api: ", err)
+		}
+	}
+
+	var fileStore domain.FileStore
+	switch cfg.FileStore {
+	case config.FileStoreLocal:
+		fileStore, err = filestore.NewLocal(cfg.UploadDir)
+	case config.FileStoreS3:
+		fileStore, err = filestore.NewS3(cfg.S3)
+	default:
+		log.Fatalf("unknown file store %q", cfg.FileStore)
+	}
 	if err != nil {
-		log.Fatal("failed to connect to bot api: ", err)
+		log.Fatal("failed to create file store: ", err)
 	}
 
 	var db *sql.DB
@@ -79,38 +99,117 @@ func main() {
 	if err != nil {
 		log.Fatal(err)
 	}
+	fileRepo, err := repository.NewSqlFileRepository(db)
+	if err != nil {
+		log.Fatal(err)
+	}
+	feedbackTemplateRepo, err := repository.NewSqlFeedbackTemplateRepository(db)
+	if err != nil {
+		log.Fatal(err)
+	}
+	contentVersionRepo, err := repository.NewSqlContentVersionRepository(db)
+	if err != nil {
+		log.Fatal(err)
+	}
+	outboxRepo, err := repository.NewSqlOutboxRepository(db)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var eventBus domain.EventBus
+	var postgresBus *eventbus.Postgres
+	switch cfg.EventBus {
+	case config.EventBusMemory:
+		eventBus = eventbus.NewMemory()
+	case config.EventBusPostgres:
+		if !cfg.Postgres.Enable {
+			log.Fatal("the postgres event bus needs postgres to be enabled")
+		}
+		postgresBus, err = eventbus.NewPostgres(db)
+		if err != nil {
+			log.Fatal(err)
+		}
+		eventBus = postgresBus
+	default:
+		log.Fatalf("unknown event bus %q", cfg.EventBus)
+	}
 
+	outbox := service.NewOutbox(outboxRepo)
+	uow := service.NewUnitOfWork(repository.NewSqlGameTransactor(db), outbox)
 	authService := service.NewAuth(cfg, userRepo, gameStateRepo)
 	territoryService := service.NewTerritory(territoryRepo)
-	islandService := service.NewIsland(theBot, userRepo, islandRepo, questionStore, playerRepo, treasureRepo, gameStateRepo)
-	playerService := service.NewPlayer(cfg, db, userRepo, playerRepo, territoryRepo, questionStore, islandRepo, treasureRepo, marketRepo, inboxRepo, investRepo)
-	correctionService := service.NewCorrection(cfg, questionStore)
-	adminService := service.NewAdmin(cfg, territoryRepo, islandRepo, userRepo, playerRepo, questionStore, treasureRepo)
+	fileService := service.NewFile(fileStore, fileRepo)
+	islandService := service.NewIsland(cfg, uow, fileService, userRepo, islandRepo, questionStore, playerRepo, treasureRepo, gameStateRepo)
+	playerService := service.NewPlayer(cfg, uow, eventBus, outbox, userRepo, playerRepo, territoryRepo, questionStore, islandRepo, treasureRepo, marketRepo, inboxRepo, investRepo)
+	correctionService := service.NewCorrection(cfg, islandService, questionStore, islandRepo, feedbackTemplateRepo, userRepo)
+	adminService := service.NewAdmin(cfg, territoryRepo, islandRepo, userRepo, playerRepo, questionStore, treasureRepo, feedbackTemplateRepo, contentVersionRepo, repository.NewSqlContentTransactor(db), playerService)
 
 	islandService.OnNewPortableIsland(playerService.HandleNewPortableIsland)
 
 	if cfg.DevMode && cfg.CreateMock {
-		err = mock.SetGameContent(adminService, mock.DataFiles, "", cfg.MockUsersPassword)
+		err = mock.SetGameContent(adminService, mock.DataFiles, "", cfg.MockUsersPassword, "mock", false)
 		if err != nil {
 			log.Fatal("failed to create mock data: ", err)
 		}
 	}
 
-	h := handler.New(cfg, authService, territoryService, islandService, playerService)
+	// the web queue always receives the events so that the corrector console stays live
+	correctionQueue := notifier.NewWebQueue()
 
-	adminBot := adminbot.NewBot(cfg, theBot, h, islandService, correctionService, playerService, adminService, userRepo, gameStateRepo)
+	h := handler.New(cfg, authService, territoryService, islandService, playerService, fileService, adminService, correctionService, correctionQueue, eventBus)
 
+	var adminBot *adminbot.Bot
+	var webhook *notifier.Webhook
+	var correctionChannel service.CorrectionChannel
+	switch cfg.CorrectionChannel {
+	case config.CorrectionChannelBot:
+		adminBot = adminbot.NewBot(cfg, theBot, h, islandService, correctionService, playerService, adminService, fileService, userRepo, gameStateRepo)
+		correctionChannel = adminBot
+	case config.CorrectionChannelWebhook:
+		webhook = notifier.NewWebhook(cfg.WebhookURL, cfg.WebhookSecret)
+		correctionChannel = webhook
+	case config.CorrectionChannelWeb:
+	case config.CorrectionChannelLog:
+		correctionChannel = notifier.NewLog()
+	default:
+		log.Fatalf("unknown correction channel %q", cfg.CorrectionChannel)
+	}
+	if correctionChannel != nil {
+		correctionChannel = service.FanoutCorrectionChannel(correctionChannel, correctionQueue)
+	} else {
+		correctionChannel = correctionQueue
+	}
+	service.ConnectCorrectionChannel(cfg, correctionChannel, islandService, correctionService)
+
+	if postgresBus != nil {
+		postgresBus.Start()
+	}
 	islandService.Start()
 	playerService.Start()
-	adminBot.Start()
+	correctionService.Start()
+	if adminBot != nil {
+		adminBot.Start()
+	}
 	h.Start()
+	outbox.Start()
 
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt, os.Kill, syscall.SIGTERM, syscall.SIGQUIT, syscall.SIGINT)
 	<-c
 	slog.Info("Got signal, shutting down...")
 
+	outbox.Stop()
 	h.Stop()
-	adminBot.Stop()
+	if adminBot != nil {
+		adminBot.Stop()
+	}
+	correctionService.Stop()
+	islandService.Stop()
 	playerService.Stop()
+	if webhook != nil {
+		webhook.Stop()
+	}
+	if postgresBus != nil {
+		postgresBus.Stop()
+	}
 }